@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"db-manager-backend/models"
 
@@ -61,7 +63,17 @@ func ConnectDB() {
 	}
 
 	// Auto migrate the schema for PostgreSQL
-	err = DB.AutoMigrate(
+	err = Migrate(DB)
+	if err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+
+	fmt.Println("PostgreSQL database connected and migrated successfully")
+}
+
+// Migrate creates or updates the tables of the metadata models
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
 		&models.User{},
 		&models.DatabaseConnection{},
 		&models.APIKey{},
@@ -69,12 +81,13 @@ func ConnectDB() {
 		&models.APILog{},
 		&models.DatabaseInvitation{},
 		&models.DatabaseAccess{},
+		&models.OwnershipTransfer{},
+		&models.ConnectionAudit{},
+		&models.ConnectionHealthCheck{},
+		&models.OutboundEmail{},
+		&models.SavedQuery{},
+		&models.QueryHistory{},
 	)
-	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
-	}
-
-	fmt.Println("PostgreSQL database connected and migrated successfully")
 }
 
 func initInMemoryDB() {
@@ -95,6 +108,24 @@ func GetEnv(key, defaultValue string) string {
 	return value
 }
 
+// GetEnvInt reads an integer environment variable, falling back on missing or invalid values
+func GetEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetEnvDuration reads a duration such as "10m", falling back on missing or invalid values
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 // Helper function to check if using in-memory DB
 func IsInMemoryDB() bool {
 	return DB == nil && memDB != nil
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	"db-manager-backend/utils"
+)
+
+// LoadEncryptionKeys configures the master keys protecting stored database credentials.
+// Keys come from ENCRYPTION_KEY_FILE if set, otherwise from ENCRYPTION_KEY, as
+// "version:base64key" entries; the highest version encrypts new records.
+func LoadEncryptionKeys() {
+	spec := GetEnv("ENCRYPTION_KEY", "")
+	if path := GetEnv("ENCRYPTION_KEY_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read encryption key file: %v", err)
+		}
+		spec = string(data)
+	}
+
+	keyring, err := utils.ParseKeyring(spec)
+	if err != nil {
+		log.Fatalf("Invalid encryption key configuration: %v", err)
+	}
+	utils.SetCredentialKeyring(keyring)
+
+	if !keyring.Enabled() {
+		log.Println("Warning: ENCRYPTION_KEY is not set, database credentials will be stored in plain text")
+		return
+	}
+	log.Printf("Credential encryption enabled (master key version %d)", keyring.CurrentVersion())
+}
@@ -12,14 +12,18 @@ import (
 type APIHandler struct{}
 
 type CreateAPIKeyRequest struct {
-	DatabaseID string `json:"database_id" validate:"required"`
-	Name       string `json:"name" validate:"required"`
+	DatabaseID string            `json:"database_id" validate:"required"`
+	Name       string            `json:"name" validate:"required"`
+	RowFilters models.RowFilters `json:"row_filters"` // optional, limits the key to some rows
 }
 
 type CreateEndpointRequest struct {
-	DatabaseID string `json:"database_id" validate:"required"`
-	Collection string `json:"collection" validate:"required"`
-	Method     string `json:"method" validate:"required"`
+	DatabaseID   string `json:"database_id" validate:"required"`
+	Kind         string `json:"kind"`       // collection (default) or query
+	Collection   string `json:"collection"` // collection endpoints
+	Method       string `json:"method" validate:"required"`
+	Path         string `json:"path"`           // query endpoints, relative to /api, e.g. reports/top-customers
+	SavedQueryID string `json:"saved_query_id"` // query endpoints
 }
 
 func NewAPIHandler() *APIHandler {
@@ -35,17 +39,23 @@ func (h *APIHandler) CreateAPIKey(c *fiber.Ctx) error {
 			"error": "Invalid request body",
 		})
 	}
+	if err := validateRowFilters(req.RowFilters); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 
-	// Verify database belongs to user
-	var dbConn models.DatabaseConnection
-	if err := config.DB.Where("id = ? AND user_id = ?", req.DatabaseID, userID).First(&dbConn).Error; err != nil {
+	// API keys reach every endpoint of the database, so only admins can create them
+	userUUID, _ := uuid.Parse(userID)
+	dbUUID, err := uuid.Parse(req.DatabaseID)
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Database connection not found",
 		})
 	}
-
-	userUUID, _ := uuid.Parse(userID)
-	dbUUID, _ := uuid.Parse(req.DatabaseID)
+	if _, err := authorizeAdmin(dbUUID, userUUID); err != nil {
+		return accessError(c, err)
+	}
 
 	apiKey := models.APIKey{
 		UserID:     userUUID,
@@ -53,6 +63,7 @@ func (h *APIHandler) CreateAPIKey(c *fiber.Ctx) error {
 		Name:       req.Name,
 		Key:        utils.GenerateAPIKey(),
 		IsActive:   true,
+		RowFilters: req.RowFilters,
 	}
 
 	if err := config.DB.Create(&apiKey).Error; err != nil {
@@ -98,6 +109,47 @@ func (h *APIHandler) ToggleAPIKey(c *fiber.Ctx) error {
 	return c.JSON(apiKey)
 }
 
+// UpdateAPIKeyRowFilters replaces the row filters of an API key, an empty object gives
+// it access to every row again
+func (h *APIHandler) UpdateAPIKeyRowFilters(c *fiber.Ctx) error {
+	keyID := c.Params("id")
+	userID := c.Locals("user_id").(string)
+
+	var req struct {
+		RowFilters models.RowFilters `json:"row_filters"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := validateRowFilters(req.RowFilters); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var apiKey models.APIKey
+	if err := config.DB.Where("id = ? AND user_id = ?", keyID, userID).First(&apiKey).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "API key not found",
+		})
+	}
+	// Widening the rows of a key needs the same role as creating it
+	if _, err := authorizeAdmin(apiKey.DatabaseID, apiKey.UserID); err != nil {
+		return accessError(c, err)
+	}
+
+	apiKey.RowFilters = req.RowFilters
+	if err := config.DB.Model(&apiKey).Update("row_filters", req.RowFilters).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update API key",
+		})
+	}
+
+	return c.JSON(apiKey)
+}
+
 func (h *APIHandler) CreateEndpoint(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 	
@@ -108,18 +160,32 @@ func (h *APIHandler) CreateEndpoint(c *fiber.Ctx) error {
 		})
 	}
 
-	// Verify database belongs to user
+	// Endpoints are managed by admins of the database
+	userUUID, _ := uuid.Parse(userID)
+	dbUUID, err := uuid.Parse(req.DatabaseID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Database connection not found",
+		})
+	}
+	if _, err := authorizeAdmin(dbUUID, userUUID); err != nil {
+		return accessError(c, err)
+	}
+
 	var dbConn models.DatabaseConnection
-	if err := config.DB.Where("id = ? AND user_id = ?", req.DatabaseID, userID).First(&dbConn).Error; err != nil {
+	if err := config.DB.Where("id = ?", dbUUID).First(&dbConn).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Database connection not found",
 		})
 	}
 
-	dbUUID, _ := uuid.Parse(req.DatabaseID)
-	
+	if req.Kind == models.EndpointKindQuery {
+		return h.createQueryEndpoint(c, &req, &dbConn, userID)
+	}
+
 	endpoint := models.APIEndpoint{
 		DatabaseID: dbUUID,
+		Kind:       models.EndpointKindCollection,
 		Collection: req.Collection,
 		Path:       "/api/" + req.Collection,
 		Method:     req.Method,
@@ -139,13 +205,12 @@ func (h *APIHandler) GetEndpoints(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 	databaseID := c.Query("database_id")
 
-	query := config.DB.Preload("Database")
+	// Endpoints of the databases the user administers
+	userUUID, _ := uuid.Parse(userID)
+	query := config.DB.Preload("Database").Preload("SavedQuery").
+		Scopes(accessibleDatabases("api_endpoints.database_id", userUUID, models.PermissionAdmin))
 	if databaseID != "" {
-		query = query.Joins("JOIN database_connections ON api_endpoints.database_id = database_connections.id").
-			Where("database_connections.user_id = ? AND api_endpoints.database_id = ?", userID, databaseID)
-	} else {
-		query = query.Joins("JOIN database_connections ON api_endpoints.database_id = database_connections.id").
-			Where("database_connections.user_id = ?", userID)
+		query = query.Where("api_endpoints.database_id = ?", databaseID)
 	}
 
 	var endpoints []models.APIEndpoint
@@ -163,13 +228,15 @@ func (h *APIHandler) ToggleEndpoint(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
 	var endpoint models.APIEndpoint
-	if err := config.DB.Joins("JOIN database_connections ON api_endpoints.database_id = database_connections.id").
-		Where("api_endpoints.id = ? AND database_connections.user_id = ?", endpointID, userID).
-		First(&endpoint).Error; err != nil {
+	if err := config.DB.Where("id = ?", endpointID).First(&endpoint).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Endpoint not found",
 		})
 	}
+	userUUID, _ := uuid.Parse(userID)
+	if _, err := authorizeAdmin(endpoint.DatabaseID, userUUID); err != nil {
+		return accessError(c, err)
+	}
 
 	endpoint.IsActive = !endpoint.IsActive
 	if err := config.DB.Save(&endpoint).Error; err != nil {
@@ -226,13 +293,15 @@ func (h *APIHandler) DeleteEndpoint(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
 	var endpoint models.APIEndpoint
-	if err := config.DB.Joins("JOIN database_connections ON api_endpoints.database_id = database_connections.id").
-		Where("api_endpoints.id = ? AND database_connections.user_id = ?", endpointID, userID).
-		First(&endpoint).Error; err != nil {
+	if err := config.DB.Where("id = ?", endpointID).First(&endpoint).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Endpoint not found",
 		})
 	}
+	userUUID, _ := uuid.Parse(userID)
+	if _, err := authorizeAdmin(endpoint.DatabaseID, userUUID); err != nil {
+		return accessError(c, err)
+	}
 
 	if err := config.DB.Delete(&endpoint).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"db-manager-backend/config"
+	"db-manager-backend/models"
+	"db-manager-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// errNoAccess is returned for databases that do not exist or that the user cannot see
+var errNoAccess = errors.New("database not found or access denied")
+
+// permissionError is returned when the user's role on a database is below the one
+// required by a route
+type permissionError struct {
+	level    string
+	required string
+}
+
+func (e *permissionError) Error() string {
+	return fmt.Sprintf("%s permission required, you have %s access", e.required, e.level)
+}
+
+// errRestricted is returned for operations that cannot be limited to the collections,
+// columns and rows of access grants and row filters
+var errRestricted = errors.New("not available with access limited to some collections or rows")
+
+// grantError reports a collection or column that access grants do not allow
+type grantError struct {
+	collection string
+	column     string
+	access     string
+}
+
+func (e *grantError) Error() string {
+	if e.column != "" {
+		return fmt.Sprintf("no %s access to column %s of %s", e.access, e.column, e.collection)
+	}
+	return fmt.Sprintf("no %s access to %s", e.access, e.collection)
+}
+
+// databaseAccess is the effective access of a user on a database
+type databaseAccess struct {
+	level     string
+	grants    models.AccessGrants // limits of shared access, none for owners
+	rows      models.RowFilters
+	variables map[string]string // values of the references in row filters
+}
+
+// databaseRole returns the effective access of a user on a database: "owner" for the
+// owner of the connection, otherwise the permission level, grants and row filters of
+// their shared access. Shares of deleted connections give no access.
+func databaseRole(databaseID, userID uuid.UUID) (*databaseAccess, error) {
+	var connection models.DatabaseConnection
+	found := config.DB.Select("id", "user_id").Where("id = ?", databaseID).Limit(1).Find(&connection)
+	if found.Error != nil {
+		return nil, found.Error
+	}
+	if found.RowsAffected == 0 {
+		return nil, errNoAccess
+	}
+	if connection.UserID == userID {
+		return &databaseAccess{level: models.PermissionOwner}, nil
+	}
+
+	var access models.DatabaseAccess
+	result := config.DB.Select("permission_level", "grants", "row_filters").
+		Where("database_id = ? AND user_id = ?", databaseID, userID).Limit(1).Find(&access)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errNoAccess
+	}
+	shared := &databaseAccess{level: access.PermissionLevel, grants: access.Grants, rows: access.RowFilters}
+	if len(shared.rows) > 0 {
+		variables, err := userRowVariables(userID)
+		if err != nil {
+			return nil, err
+		}
+		shared.variables = variables
+	}
+	return shared, nil
+}
+
+// authorize checks that a user has at least the required role on a database and
+// returns the user's access
+func authorize(databaseID, userID uuid.UUID, required string) (*databaseAccess, error) {
+	access, err := databaseRole(databaseID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !models.HasPermission(access.level, required) {
+		log.Printf("User %s has %s access to database %s, %s required", userID, access.level, databaseID, required)
+		return access, &permissionError{level: access.level, required: required}
+	}
+	return access, nil
+}
+
+// authorizeAdmin checks that a user administers a database without grants limiting
+// their access, as sharing it or publishing its data would escape the grants
+func authorizeAdmin(databaseID, userID uuid.UUID) (*databaseAccess, error) {
+	access, err := authorize(databaseID, userID, models.PermissionAdmin)
+	if err != nil {
+		return access, err
+	}
+	return access, access.unrestricted()
+}
+
+// restricted reports whether grants or row filters limit the access
+func (a *databaseAccess) restricted() bool {
+	return a.grants.Restricted() || len(a.rows) > 0
+}
+
+// unrestricted fails for access limited by grants or row filters, for operations
+// such as raw queries that cannot be confined to collections, columns and rows
+func (a *databaseAccess) unrestricted() error {
+	if a.restricted() {
+		return errRestricted
+	}
+	return nil
+}
+
+// checkCollection fails unless the grants allow an operation on a collection
+func (a *databaseAccess) checkCollection(collection, access string) error {
+	if !a.grants.CollectionAllowed(collection, access) {
+		return &grantError{collection: collection, access: access}
+	}
+	return nil
+}
+
+// allowedCollections returns the collections the access can read
+func (a *databaseAccess) allowedCollections(collections []string) []string {
+	if !a.restricted() {
+		return collections
+	}
+	allowed := make([]string, 0, len(collections))
+	for _, collection := range collections {
+		if a.grants.CollectionAllowed(collection, models.PermissionRead) {
+			allowed = append(allowed, collection)
+		}
+	}
+	return allowed
+}
+
+// checkColumns fails unless the grants allow an operation on every column
+func (a *databaseAccess) checkColumns(collection string, columns []string, access string) error {
+	for _, column := range columns {
+		if !a.grants.ColumnAllowed(collection, column, access) {
+			return &grantError{collection: collection, column: column, access: access}
+		}
+	}
+	return nil
+}
+
+// limitFind restricts the options of a listing to the columns of a collection the
+// access can read: filters and sorting must only use them, and only they are
+// searched and returned
+func (a *databaseAccess) limitFind(ctx context.Context, conn services.Conn, collection string, opts *services.FindOptions) error {
+	if err := a.checkCollection(collection, models.PermissionRead); err != nil {
+		return err
+	}
+	if a.grants.AllColumns(collection, models.PermissionRead) {
+		return nil
+	}
+	if err := a.checkColumns(collection, opts.Columns(), models.PermissionRead); err != nil {
+		return err
+	}
+
+	fields, err := conn.Schema(ctx, collection)
+	if err != nil {
+		return err
+	}
+	var readable []string
+	for _, field := range fields {
+		if a.grants.ColumnAllowed(collection, field.Name, models.PermissionRead) {
+			readable = append(readable, field.Name)
+		}
+	}
+	if len(readable) == 0 {
+		return &grantError{collection: collection, access: models.PermissionRead}
+	}
+	if len(opts.Select) == 0 {
+		opts.Select = readable
+	}
+	opts.SearchColumns = readable
+	return nil
+}
+
+// rowScope returns the filter limiting the rows of a collection, nil when they are
+// not limited
+func (a *databaseAccess) rowScope(collection string) (*services.FilterGroup, error) {
+	return parseRowScope(a.rows, collection, a.variables)
+}
+
+// limitRows adds the row filter of a collection to the options of a listing
+func (a *databaseAccess) limitRows(collection string, opts *services.FindOptions) error {
+	scope, err := a.rowScope(collection)
+	if err != nil {
+		return err
+	}
+	opts.Where = services.AndFilters(opts.Where, scope)
+	return nil
+}
+
+// stripDocuments removes the fields the access cannot read from documents of a
+// collection
+func (a *databaseAccess) stripDocuments(collection string, documents []services.Document) {
+	if a.grants.AllColumns(collection, models.PermissionRead) {
+		return
+	}
+	for _, document := range documents {
+		for field := range document {
+			if !a.grants.ColumnAllowed(collection, field, models.PermissionRead) {
+				delete(document, field)
+			}
+		}
+	}
+}
+
+// limitSchema removes the columns the access cannot read from a schema of a table,
+// along with the keys, indexes and constraints that involve them
+func (a *databaseAccess) limitSchema(collection string, schema *services.TableSchema) {
+	if a.grants.AllColumns(collection, models.PermissionRead) {
+		return
+	}
+	readable := func(columns []string) bool {
+		for _, column := range columns {
+			if !a.grants.ColumnAllowed(collection, column, models.PermissionRead) {
+				return false
+			}
+		}
+		return true
+	}
+
+	columns := schema.Columns[:0]
+	for _, column := range schema.Columns {
+		if readable([]string{column.Name}) {
+			columns = append(columns, column)
+		}
+	}
+	schema.Columns = columns
+	if !readable(schema.PrimaryKey) {
+		schema.PrimaryKey = nil
+	}
+	uniques := schema.UniqueConstraints[:0]
+	for _, unique := range schema.UniqueConstraints {
+		if readable(unique.Columns) {
+			uniques = append(uniques, unique)
+		}
+	}
+	schema.UniqueConstraints = uniques
+	indexes := schema.Indexes[:0]
+	for _, index := range schema.Indexes {
+		if readable(index.Columns) {
+			indexes = append(indexes, index)
+		}
+	}
+	schema.Indexes = indexes
+	foreignKeys := schema.ForeignKeys[:0]
+	for _, foreignKey := range schema.ForeignKeys {
+		if readable(foreignKey.Columns) {
+			foreignKeys = append(foreignKeys, foreignKey)
+		}
+	}
+	schema.ForeignKeys = foreignKeys
+}
+
+// accessError maps a failed authorization to an HTTP response: 404 when the user
+// cannot see the database, 403 when their role or grants do not allow the operation
+func accessError(c *fiber.Ctx, err error) error {
+	var denied *permissionError
+	var ungranted *grantError
+	switch {
+	case errors.As(err, &denied), errors.As(err, &ungranted), errors.Is(err, errRestricted):
+		return c.Status(403).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, errNoAccess):
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	default:
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to check database access",
+		})
+	}
+}
+
+// accessibleDatabases restricts a query to rows whose column references a database
+// on which the user has at least the required role
+func accessibleDatabases(column string, userID uuid.UUID, required string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		owned := config.DB.Model(&models.DatabaseConnection{}).Select("id").Where("user_id = ?", userID)
+		levels := models.SharedPermissions(required)
+		if len(levels) == 0 {
+			return db.Where(column+" IN (?)", owned)
+		}
+		// Shares outlive the connections deleted since
+		existing := config.DB.Model(&models.DatabaseConnection{}).Select("id")
+		shared := config.DB.Model(&models.DatabaseAccess{}).Select("database_id").
+			Where("user_id = ? AND permission_level IN ? AND database_id IN (?)", userID, levels, existing)
+		return db.Where(column+" IN (?) OR "+column+" IN (?)", owned, shared)
+	}
+}
@@ -1,31 +1,34 @@
 package handlers
 
 import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
 	"db-manager-backend/config"
 	"db-manager-backend/models"
 	"db-manager-backend/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type DatabaseHandler struct {
-	dbService *services.DatabaseService
+	dbService   *services.DatabaseService
+	connections *services.ConnectionManager
 }
 
 type CreateConnectionRequest struct {
-	Name     string `json:"name" validate:"required"`
-	Type     string `json:"type" validate:"required"`
-	Host     string `json:"host" validate:"required"`
-	Port     int    `json:"port" validate:"required"`
-	Database string `json:"database" validate:"required"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Name string `json:"name" validate:"required"`
+	// Connection fields, including optional SSL, connection string and SSH tunnel settings
+	services.ConnectionParams
 }
 
-func NewDatabaseHandler() *DatabaseHandler {
+func NewDatabaseHandler(connections *services.ConnectionManager) *DatabaseHandler {
 	return &DatabaseHandler{
-		dbService: services.NewDatabaseService(),
+		dbService:   services.NewDatabaseService(),
+		connections: connections,
 	}
 }
 
@@ -59,14 +62,7 @@ func (h *DatabaseHandler) CreateConnection(c *fiber.Ctx) error {
 	}
 
 	// Test connection first
-	params := services.ConnectionParams{
-		Type:     req.Type,
-		Host:     req.Host,
-		Port:     req.Port,
-		Database: req.Database,
-		Username: req.Username,
-		Password: req.Password,
-	}
+	params := req.ConnectionParams
 
 	if err := h.dbService.TestConnection(params); err != nil {
 		return c.Status(400).JSON(fiber.Map{
@@ -76,17 +72,10 @@ func (h *DatabaseHandler) CreateConnection(c *fiber.Ctx) error {
 
 	// Create database connection record
 	userUUID, _ := uuid.Parse(userID)
-	dbConn := models.DatabaseConnection{
-		UserID:   userUUID,
-		Name:     req.Name,
-		Type:     req.Type,
-		Host:     req.Host,
-		Port:     req.Port,
-		Database: req.Database,
-		Username: req.Username,
-		Password: req.Password,
-		Status:   "active",
-	}
+	dbConn := *params.Connection()
+	dbConn.UserID = userUUID
+	dbConn.Name = req.Name
+	dbConn.Status = "active"
 
 	if err := config.DB.Create(&dbConn).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -111,8 +100,53 @@ func (h *DatabaseHandler) GetConnections(c *fiber.Ctx) error {
 }
 
 func (h *DatabaseHandler) GetDatabaseInfo(c *fiber.Ctx) error {
+	connectionID := c.Params("id")
+	access, err := authorizeConnection(c, connectionID, models.PermissionRead)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	var dbConn models.DatabaseConnection
+	if err := config.DB.Where("id = ?", connectionID).First(&dbConn).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Connection not found",
+		})
+	}
+
+	info, err := h.dbService.GetDatabaseInfo(services.ConnectionParamsFrom(&dbConn))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get database info: " + err.Error(),
+		})
+	}
+	info.Collections = access.allowedCollections(info.Collections)
+	info.Tables = access.allowedCollections(info.Tables)
+
+	return c.JSON(info)
+}
+
+// writeOnlyFields are never returned to clients, so an empty value on update keeps the
+// stored one and null clears it
+var writeOnlyFields = map[string]bool{
+	"password":          true,
+	"ssl_cert":          true,
+	"ssl_key":           true,
+	"ssl_root_cert":     true,
+	"connection_string": true,
+	"ssh_password":      true,
+	"ssh_private_key":   true,
+}
+
+// UpdateConnection changes an existing connection in place, keeping its ID so that
+// API keys, endpoints and shares stay attached. Omitted fields keep their value, and
+// write-only fields are only cleared by an explicit null.
+// Only the owner can change it, as stored secrets are sent to the new host.
+func (h *DatabaseHandler) UpdateConnection(c *fiber.Ctx) error {
 	connectionID := c.Params("id")
 	userID := c.Locals("user_id").(string)
+	if _, err := authorizeConnection(c, connectionID, models.PermissionOwner); err != nil {
+		return accessError(c, err)
+	}
 
 	var dbConn models.DatabaseConnection
 	if err := config.DB.Where("id = ? AND user_id = ?", connectionID, userID).First(&dbConn).Error; err != nil {
@@ -121,28 +155,203 @@ func (h *DatabaseHandler) GetDatabaseInfo(c *fiber.Ctx) error {
 		})
 	}
 
-	params := services.ConnectionParams{
-		Type:     dbConn.Type,
-		Host:     dbConn.Host,
-		Port:     dbConn.Port,
-		Database: dbConn.Database,
-		Username: dbConn.Username,
-		Password: dbConn.Password,
+	// Decode the body over the current values so absent fields are left unchanged
+	current := services.ConnectionParamsFrom(&dbConn)
+	req := CreateConnectionRequest{Name: dbConn.Name, ConnectionParams: current}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	keepWriteOnlyFields(&req.ConnectionParams, current, clearedFields(c))
+
+	if strings.TrimSpace(req.Name) == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Name is required",
+		})
+	}
+
+	changes := connectionChanges(current, req.ConnectionParams)
+	if req.Name != dbConn.Name {
+		changes["name"] = fiber.Map{"from": dbConn.Name, "to": req.Name}
+	}
+	if len(changes) == 0 {
+		return c.JSON(dbConn)
+	}
+
+	// Re-test the new parameters before saving them
+	if err := h.dbService.TestConnection(req.ConnectionParams); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Connection failed: " + err.Error(),
+		})
 	}
 
-	info, err := h.dbService.GetDatabaseInfo(params)
+	req.ConnectionParams.Apply(&dbConn)
+	dbConn.Name = req.Name
+	dbConn.Status = "active"
+
+	userUUID, _ := uuid.Parse(userID)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User").Save(&dbConn).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ConnectionAudit{
+			DatabaseID: dbConn.ID,
+			UserID:     userUUID,
+			Action:     "update",
+			Changes:    changes,
+		}).Error
+	})
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to get database info: " + err.Error(),
+			"error": "Failed to update connection",
 		})
 	}
 
-	return c.JSON(info)
+	// Sessions opened with the old settings must not be reused
+	h.connections.Invalidate(connectionID)
+
+	return c.JSON(dbConn)
+}
+
+// GetConnectionHistory lists the recorded changes of a connection, newest first
+func (h *DatabaseHandler) GetConnectionHistory(c *fiber.Ctx) error {
+	connectionID := c.Params("id")
+	if _, err := authorizeConnection(c, connectionID, models.PermissionAdmin); err != nil {
+		return accessError(c, err)
+	}
+
+	var audits []models.ConnectionAudit
+	if err := config.DB.Preload("User").Where("database_id = ?", connectionID).
+		Order("created_at DESC").Limit(100).Find(&audits).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch connection history",
+		})
+	}
+
+	return c.JSON(audits)
+}
+
+// GetConnectionHealth returns the health check timeline of a connection, newest first
+func (h *DatabaseHandler) GetConnectionHealth(c *fiber.Ctx) error {
+	connectionID := c.Params("id")
+	if _, err := authorizeConnection(c, connectionID, models.PermissionRead); err != nil {
+		return accessError(c, err)
+	}
+
+	var dbConn models.DatabaseConnection
+	if err := config.DB.Select("id", "status").Where("id = ?", connectionID).First(&dbConn).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Connection not found",
+		})
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	var checks []models.ConnectionHealthCheck
+	if err := config.DB.Where("database_id = ?", connectionID).
+		Order("checked_at DESC").Limit(limit).Find(&checks).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch health history",
+		})
+	}
+
+	// Summarize the returned window
+	response := fiber.Map{
+		"database_id": dbConn.ID,
+		"status":      dbConn.Status,
+		"checks":      checks,
+	}
+	if len(checks) > 0 {
+		healthy := 0
+		var latency int64
+		for _, check := range checks {
+			if check.Healthy {
+				healthy++
+				latency += check.LatencyMs
+			}
+		}
+		response["last_checked_at"] = checks[0].CheckedAt
+		response["uptime_percent"] = float64(healthy) * 100 / float64(len(checks))
+		if healthy > 0 {
+			response["avg_latency_ms"] = latency / int64(healthy)
+		}
+		for _, check := range checks {
+			if !check.Healthy {
+				response["last_error"] = check.Error
+				response["last_error_at"] = check.CheckedAt
+				break
+			}
+		}
+	}
+
+	return c.JSON(response)
+}
+
+// keepWriteOnlyFields restores stored write-only values left empty in an update,
+// except the cleared ones
+func keepWriteOnlyFields(params *services.ConnectionParams, current services.ConnectionParams, cleared map[string]bool) {
+	updated := reflect.ValueOf(params).Elem()
+	stored := reflect.ValueOf(current)
+	for i := 0; i < updated.NumField(); i++ {
+		name := jsonName(updated.Type().Field(i))
+		if cleared[name] {
+			updated.Field(i).SetZero()
+		} else if writeOnlyFields[name] && updated.Field(i).IsZero() {
+			updated.Field(i).Set(stored.Field(i))
+		}
+	}
+}
+
+// clearedFields returns the write-only fields a JSON body sets to null. Decoding null
+// into a string leaves it untouched, so they cannot be told apart from omitted ones
+// after parsing.
+func clearedFields(c *fiber.Ctx) map[string]bool {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return nil
+	}
+	cleared := map[string]bool{}
+	for name, value := range body {
+		if writeOnlyFields[name] && string(value) == "null" {
+			cleared[name] = true
+		}
+	}
+	return cleared
+}
+
+// connectionChanges lists the fields that differ, reporting write-only fields without values
+func connectionChanges(before, after services.ConnectionParams) models.JSONMap {
+	changes := models.JSONMap{}
+	old := reflect.ValueOf(before)
+	updated := reflect.ValueOf(after)
+	for i := 0; i < old.NumField(); i++ {
+		if old.Field(i).Interface() == updated.Field(i).Interface() {
+			continue
+		}
+		name := jsonName(old.Type().Field(i))
+		if writeOnlyFields[name] {
+			changes[name] = "changed"
+		} else {
+			changes[name] = fiber.Map{"from": old.Field(i).Interface(), "to": updated.Field(i).Interface()}
+		}
+	}
+	return changes
+}
+
+func jsonName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("json"), ",")[0]
 }
 
 func (h *DatabaseHandler) DeleteConnection(c *fiber.Ctx) error {
 	connectionID := c.Params("id")
 	userID := c.Locals("user_id").(string)
+	if _, err := authorizeConnection(c, connectionID, models.PermissionOwner); err != nil {
+		return accessError(c, err)
+	}
 
 	if err := config.DB.Where("id = ? AND user_id = ?", connectionID, userID).Delete(&models.DatabaseConnection{}).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -150,7 +359,21 @@ func (h *DatabaseHandler) DeleteConnection(c *fiber.Ctx) error {
 		})
 	}
 
+	// Close any pooled session for the deleted connection
+	h.connections.Invalidate(connectionID)
+
 	return c.JSON(fiber.Map{
 		"message": "Connection deleted successfully",
 	})
 }
+
+// authorizeConnection checks that the current user has at least the required role on
+// the connection of a route and returns their access
+func authorizeConnection(c *fiber.Ctx, connectionID, required string) (*databaseAccess, error) {
+	databaseID, err := uuid.Parse(connectionID)
+	if err != nil {
+		return nil, errNoAccess
+	}
+	userID, _ := uuid.Parse(c.Locals("user_id").(string))
+	return authorize(databaseID, userID, required)
+}
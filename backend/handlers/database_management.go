@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,13 +18,12 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type DatabaseManagementHandler struct {
-	dbService *services.DatabaseService
+	dbService   *services.DatabaseService
+	connections *services.ConnectionManager
+	queries     *services.QueryTracker // console queries that can be cancelled
 	// Object pools for memory optimization
 	docPool      sync.Pool
 	fieldsPool   sync.Pool
@@ -31,16 +32,17 @@ type DatabaseManagementHandler struct {
 
 // Optimized response structs to reduce memory allocation
 type DocumentResponse struct {
-	Documents []interface{} `json:"documents"`
-	Total     int64         `json:"total"`
-	Page      int           `json:"page"`
-	Limit     int           `json:"limit"`
+	Documents      []interface{} `json:"documents"`
+	Total          *int64        `json:"total"` // null when not counted
+	TotalEstimated bool          `json:"total_estimated,omitempty"`
+	Page           int           `json:"page"`
+	Limit          int           `json:"limit"`
+	NextCursor     string        `json:"next_cursor,omitempty"`
+	PrevCursor     string        `json:"prev_cursor,omitempty"`
+	PrimaryKey     []string      `json:"primary_key,omitempty"` // columns addressing a document, in URL order
 }
 
-type FieldInfo struct {
-	Name string `json:"name"`
-	Type string `json:"type"`
-}
+type FieldInfo = services.FieldInfo
 
 type CollectionResponse struct {
 	Collections []string `json:"collections"`
@@ -50,9 +52,11 @@ type SchemaResponse struct {
 	Fields []FieldInfo `json:"fields"`
 }
 
-func NewDatabaseManagementHandler() *DatabaseManagementHandler {
+func NewDatabaseManagementHandler(connections *services.ConnectionManager) *DatabaseManagementHandler {
 	h := &DatabaseManagementHandler{
-		dbService: services.NewDatabaseService(),
+		dbService:   services.NewDatabaseService(),
+		connections: connections,
+		queries:     services.NewQueryTracker(),
 	}
 	
 	// Initialize object pools for memory optimization
@@ -77,35 +81,30 @@ func NewDatabaseManagementHandler() *DatabaseManagementHandler {
 	return h
 }
 
-// Helper function to check database access and get connection (optimized with minimal select)
-func (h *DatabaseManagementHandler) getDatabaseConnection(databaseID, userID uuid.UUID) (*models.DatabaseConnection, error) {
-	connection := &models.DatabaseConnection{}
-	
-	// First, try to find as owner - select only necessary fields to reduce memory
-	ownerErr := config.DB.Select("id", "type", "host", "port", "database", "username", "password", "ssl_mode", "connection_string").
-		Where("id = ? AND user_id = ?", databaseID, userID).First(connection).Error
-	if ownerErr == nil {
-		log.Printf("User has owner access to database: %s", databaseID)
-		return connection, nil
+// connectionColumns are the fields needed to open a connection, including the
+// key version and wrapped data key required to decrypt the stored secrets
+var connectionColumns = []string{
+	"id", "type", "host", "port", "database", "username", "password",
+	"auth_method", "ssl_mode", "ssl_cert", "ssl_key", "ssl_root_cert", "connection_string",
+	"ssh_host", "ssh_port", "ssh_user", "ssh_password", "ssh_private_key", "ssh_host_fingerprint",
+	"key_version", "data_key",
+}
+
+// getDatabaseConnection checks that the user has at least the required role on a
+// database and returns its connection (with minimal select) and the user's access
+func (h *DatabaseManagementHandler) getDatabaseConnection(databaseID, userID uuid.UUID, required string) (*models.DatabaseConnection, *databaseAccess, error) {
+	access, err := authorize(databaseID, userID, required)
+	if err != nil {
+		return nil, access, err
 	}
-	
-	// If not owner, check if user has shared access
-	access := &models.DatabaseAccess{}
-	sharedErr := config.DB.Select("database_id", "user_id").
-		Where("database_id = ? AND user_id = ?", databaseID, userID).First(access).Error
-	if sharedErr == nil {
-		// User has shared access, get the original connection info with minimal fields
-		if err := config.DB.Select("id", "type", "host", "port", "database", "username", "password", "ssl_mode", "connection_string").
-			Where("id = ?", databaseID).First(connection).Error; err != nil {
-			log.Printf("Shared database connection not found: %v", err)
-			return nil, fmt.Errorf("shared database connection not found")
-		}
-		log.Printf("User has shared access to database: %s", databaseID)
-		return connection, nil
+
+	// Select only necessary fields to reduce memory
+	connection := &models.DatabaseConnection{}
+	if err := config.DB.Select(connectionColumns).Where("id = ?", databaseID).First(connection).Error; err != nil {
+		log.Printf("Database connection not found: %v", err)
+		return nil, access, errNoAccess
 	}
-	
-	log.Printf("User has no access to database: %s", databaseID)
-	return nil, fmt.Errorf("database not found or access denied")
+	return connection, access, nil
 }
 
 // Helper function to extract user ID from context
@@ -128,67 +127,31 @@ func (h *DatabaseManagementHandler) getUserID(c *fiber.Ctx) (uuid.UUID, error) {
 	return userID, nil
 }
 
-// Helper function to determine input type based on field name and data type
-func determineInputType(fieldName, dataType string) string {
-	fieldNameLower := strings.ToLower(fieldName)
-	dataTypeLower := strings.ToLower(dataType)
-	
-	// Check for image/photo fields first by name
-	if strings.Contains(fieldNameLower, "photo") || 
-	   strings.Contains(fieldNameLower, "image") || 
-	   strings.Contains(fieldNameLower, "picture") ||
-	   strings.Contains(fieldNameLower, "avatar") ||
-	   strings.Contains(fieldNameLower, "thumbnail") ||
-	   strings.Contains(fieldNameLower, "logo") ||
-	   strings.Contains(fieldNameLower, "icon") {
-		return "image"
-	}
-	
-	// Check for email fields
-	if strings.Contains(fieldNameLower, "email") {
-		return "email"
-	}
-	
-	// Check for URL fields
-	if strings.Contains(fieldNameLower, "url") || strings.Contains(fieldNameLower, "link") {
-		return "url"
-	}
-	
-	// Check for password fields
-	if strings.Contains(fieldNameLower, "password") || strings.Contains(fieldNameLower, "pass") {
-		return "password"
-	}
-	
-	// Check for phone fields
-	if strings.Contains(fieldNameLower, "phone") || strings.Contains(fieldNameLower, "tel") {
-		return "tel"
-	}
-	
-	// Check for date/time fields
-	if strings.Contains(fieldNameLower, "date") || strings.Contains(fieldNameLower, "time") ||
-	   strings.Contains(dataTypeLower, "date") || strings.Contains(dataTypeLower, "time") ||
-	   strings.Contains(dataTypeLower, "timestamp") {
-		return "datetime-local"
-	}
-	
-	// Check by data type
-	if strings.Contains(dataTypeLower, "int") || strings.Contains(dataTypeLower, "number") ||
-	   strings.Contains(dataTypeLower, "decimal") || strings.Contains(dataTypeLower, "float") ||
-	   strings.Contains(dataTypeLower, "double") {
-		return "number"
-	}
-	
-	if strings.Contains(dataTypeLower, "bool") {
-		return "checkbox"
+
+// Helper function to acquire a pooled driver session for a connection.
+// The returned release function must be called instead of closing the session.
+func (h *DatabaseManagementHandler) openConnection(connection *models.DatabaseConnection) (services.Conn, func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return h.connections.Acquire(ctx, connection)
+}
+
+// connectionError maps a failure to open a driver session to an HTTP response
+func connectionError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrUnsupported) || errors.Is(err, services.ErrUnknownType) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Unsupported database type",
+		})
 	}
-	
-	if strings.Contains(dataTypeLower, "text") || strings.Contains(dataTypeLower, "longtext") ||
-	   strings.Contains(dataTypeLower, "mediumtext") {
-		return "textarea"
+	if errors.Is(err, services.ErrPoolExhausted) {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Too many open database connections, try again later",
+		})
 	}
-	
-	// Default to text
-	return "text"
+	return c.Status(500).JSON(fiber.Map{
+		"error": "Failed to connect to database: " + err.Error(),
+	})
 }
 
 // GetCollections returns all collections for a database connection (optimized)
@@ -216,79 +179,30 @@ func (h *DatabaseManagementHandler) GetCollections(c *fiber.Ctx) error {
 	}
 
 	// Get database connection using helper function
-	connection, err := h.getDatabaseConnection(databaseID, userID)
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return accessError(c, err)
 	}
 
-	// Pre-allocate slice with estimated capacity to reduce allocations
-	collections := make([]string, 0, 32)
-
-	switch connection.Type {
-	case "mongodb":
-		// Connect to MongoDB with optimized context and timeout
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		
-		client, err := h.dbService.ConnectMongoDB(*connection)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to MongoDB: " + err.Error(),
-			})
-		}
-		defer client.Disconnect(ctx)
-
-		database := client.Database(connection.Database)
-		collectionNames, err := database.ListCollectionNames(ctx, bson.D{})
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to list collections: " + err.Error(),
-			})
-		}
-		collections = collectionNames
-
-	case "mysql", "postgresql", "postgres":
-		// For SQL databases, get table names with optimized query
-		sqlClient, err := h.dbService.ConnectSQL(*connection)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to database: " + err.Error(),
-			})
-		}
-		defer sqlClient.Close()
-
-		var query string
-		if connection.Type == "mysql" {
-			query = "SHOW TABLES"
-		} else {
-			query = "SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' ORDER BY table_name"
-		}
-
-		rows, err := sqlClient.Query(query)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to list tables: " + err.Error(),
-			})
-		}
-		defer rows.Close()
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
 
-		// Optimize scanning by reusing tableName variable
-		var tableName string
-		for rows.Next() {
-			if err := rows.Scan(&tableName); err != nil {
-				continue
-			}
-			collections = append(collections, tableName)
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	default:
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Unsupported database type",
+	collections, err := conn.ListCollections(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to list collections: " + err.Error(),
 		})
 	}
 
+	// Hide the collections access grants do not allow
+	collections = access.allowedCollections(collections)
+
 	// Use optimized response struct
 	response := &CollectionResponse{
 		Collections: collections,
@@ -323,247 +237,169 @@ func (h *DatabaseManagementHandler) GetCollectionSchema(c *fiber.Ctx) error {
 	}
 
 	// Get database connection using helper function
-	connection, err := h.getDatabaseConnection(databaseID, userID)
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return accessError(c, err)
 	}
 
-	type FieldInfo struct {
-		Name string `json:"name"`
-		Type string `json:"type"`
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
 	}
+	defer release()
 
-	var fields []FieldInfo
-
-	switch connection.Type {
-	case "mongodb":
-		// Connect to MongoDB and sample documents to get field names
-		client, err := h.dbService.ConnectMongoDB(*connection)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to MongoDB: " + err.Error(),
-			})
-		}
-		defer client.Disconnect(context.Background())
-
-		collection := client.Database(connection.Database).Collection(collectionName)
-		
-		// Get a sample document to extract field names and types with timeout
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-		defer cancel()
-		
-		cursor, err := collection.Find(ctx, bson.D{}, options.Find().SetLimit(10))
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to sample documents: " + err.Error(),
-			})
-		}
-		defer cursor.Close(ctx)
-
-		// Pre-allocate map with estimated capacity for memory efficiency
-		fieldSet := make(map[string]string, 20) // field name -> type
-		
-		for cursor.Next(ctx) {
-			var doc bson.M
-			if err := cursor.Decode(&doc); err != nil {
-				continue
-			}
-			for key, value := range doc {
-				if key != "_id" {
-					fieldType := "text"
-					// Try to determine field type from value using pointer efficiency
-					switch v := value.(type) {
-					case string:
-						fieldType = "text"
-						// Check if it looks like an image URL or file path
-						if strings.Contains(strings.ToLower(key), "photo") || 
-						   strings.Contains(strings.ToLower(key), "image") || 
-						   strings.Contains(strings.ToLower(key), "picture") ||
-						   strings.Contains(strings.ToLower(key), "avatar") ||
-						   strings.Contains(strings.ToLower(key), "thumbnail") ||
-						   strings.HasSuffix(strings.ToLower(v), ".jpg") ||
-						   strings.HasSuffix(strings.ToLower(v), ".jpeg") ||
-						   strings.HasSuffix(strings.ToLower(v), ".png") ||
-						   strings.HasSuffix(strings.ToLower(v), ".gif") ||
-						   strings.HasSuffix(strings.ToLower(v), ".webp") {
-							fieldType = "image"
-						}
-					case int, int32, int64:
-						fieldType = "number"
-					case float32, float64:
-						fieldType = "number"
-					case bool:
-						fieldType = "boolean"
-					default:
-						fieldType = "text"
-					}
-					
-					if _, exists := fieldSet[key]; !exists {
-						fieldSet[key] = fieldType
-					}
-				}
-			}
-		}
-
-		for fieldName, fieldType := range fieldSet {
-			fields = append(fields, FieldInfo{Name: fieldName, Type: fieldType})
-		}
-
-	case "mysql", "postgresql", "postgres":
-		// Get column names and types for SQL tables
-		sqlClient, err := h.dbService.ConnectSQL(*connection)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to database: " + err.Error(),
-			})
-		}
-		defer sqlClient.Close()
-
-		var query string
-		if connection.Type == "mysql" {
-			// Get column name and data type for MySQL
-			query = fmt.Sprintf("DESCRIBE %s", collectionName)
-		} else {
-			// PostgreSQL is case-sensitive, try both original and lowercase
-			query = fmt.Sprintf(`
-				SELECT column_name, data_type 
-				FROM information_schema.columns 
-				WHERE table_name = '%s' AND table_schema = 'public'
-				ORDER BY ordinal_position
-			`, collectionName)
-			
-			// Also try lowercase version
-			queryLower := fmt.Sprintf(`
-				SELECT column_name, data_type 
-				FROM information_schema.columns 
-				WHERE table_name = '%s' AND table_schema = 'public'
-				ORDER BY ordinal_position
-			`, strings.ToLower(collectionName))
-			
-			log.Printf("Will try both queries - original: %s, lowercase: %s", query, queryLower)
-		}
-
-		log.Printf("Executing schema query for table '%s': %s", collectionName, query)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
 
-		rows, err := sqlClient.Query(query)
-		if err != nil {
-			log.Printf("Query error for table '%s': %v", collectionName, err)
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to get table schema: " + err.Error(),
-			})
-		}
-		defer rows.Close()
-
-		// Check if we got any results, if not try lowercase for PostgreSQL
-		fieldCount := 0
-		if connection.Type == "mysql" {
-			for rows.Next() {
-				var field, fieldType, null, key, extra string
-				var defaultVal sql.NullString // Use sql.NullString for nullable columns
-				if err := rows.Scan(&field, &fieldType, &null, &key, &defaultVal, &extra); err != nil {
-					log.Printf("Error scanning MySQL row: %v", err)
-					continue
-				}
-				log.Printf("Found MySQL field: %s, type: %s", field, fieldType)
-				
-				// Determine input type based on MySQL field type and name
-				inputType := determineInputType(field, fieldType)
-				fields = append(fields, FieldInfo{Name: field, Type: inputType})
-				fieldCount++
-			}
-		} else {
-			for rows.Next() {
-				var field, dataType string
-				if err := rows.Scan(&field, &dataType); err != nil {
-					log.Printf("Error scanning PostgreSQL row: %v", err)
-					continue
-				}
-				log.Printf("Found PostgreSQL field: %s, type: %s", field, dataType)
-				
-				// Determine input type based on PostgreSQL field type and name
-				inputType := determineInputType(field, dataType)
-				fields = append(fields, FieldInfo{Name: field, Type: inputType})
-				fieldCount++
-			}
-		}
+	collectionName = services.CanonicalCollection(ctx, conn, collectionName)
+	if err := access.checkCollection(collectionName, models.PermissionRead); err != nil {
+		return accessError(c, err)
+	}
 
-		// If no fields found and it's PostgreSQL, try lowercase table name
-		if fieldCount == 0 && (connection.Type == "postgresql" || connection.Type == "postgres") {
-			log.Printf("No fields found with original name, trying lowercase for PostgreSQL")
-			rows.Close() // Close previous rows
-			
-			queryLower := fmt.Sprintf(`
-				SELECT column_name, data_type 
-				FROM information_schema.columns 
-				WHERE table_name = '%s' AND table_schema = 'public'
-				ORDER BY ordinal_position
-			`, strings.ToLower(collectionName))
-			
-			log.Printf("Executing lowercase query: %s", queryLower)
-			
-			rows, err = sqlClient.Query(queryLower)
-			if err != nil {
-				log.Printf("Lowercase query error: %v", err)
-			} else {
-				defer rows.Close()
-				for rows.Next() {
-					var field, dataType string
-					if err := rows.Scan(&field, &dataType); err != nil {
-						log.Printf("Error scanning PostgreSQL lowercase row: %v", err)
-						continue
-					}
-					log.Printf("Found PostgreSQL field (lowercase): %s, type: %s", field, dataType)
-					
-					// Determine input type based on PostgreSQL field type and name
-					inputType := determineInputType(field, dataType)
-					fields = append(fields, FieldInfo{Name: field, Type: inputType})
-				}
+	fields, err := conn.Schema(ctx, collectionName)
+	if err != nil {
+		log.Printf("Schema error for collection '%s': %v", collectionName, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get collection schema: " + err.Error(),
+		})
+	}
+	if !access.grants.AllColumns(collectionName, models.PermissionRead) {
+		readable := fields[:0]
+		for _, field := range fields {
+			if access.grants.ColumnAllowed(collectionName, field.Name, models.PermissionRead) {
+				readable = append(readable, field)
 			}
 		}
+		fields = readable
 	}
 
 	// Log the fields before returning
-	log.Printf("GetCollectionSchema for table '%s': found fields: %v", collectionName, fields)
+	log.Printf("GetCollectionSchema for collection '%s': found fields: %v", collectionName, fields)
 
 	return c.JSON(fiber.Map{
 		"fields": fields,
 	})
 }
 
-// GetDocuments returns paginated documents from a collection
-func (h *DatabaseManagementHandler) GetDocuments(c *fiber.Ctx) error {
+// GetCollectionSchemaDetails returns native types, keys, indexes and foreign keys of a
+// collection. Document databases infer them from a sample of documents.
+func (h *DatabaseManagementHandler) GetCollectionSchemaDetails(c *fiber.Ctx) error {
 	userID, err := h.getUserID(c)
 	if err != nil {
 		return c.Status(401).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
-	
+
 	collectionName := c.Params("collection")
-	databaseIDStr := c.Query("database_id")
-	
-	if databaseIDStr == "" {
+	databaseID, err := uuid.Parse(c.Query("database_id"))
+	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
-			"error": "database_id is required",
+			"error": "Valid database_id is required",
 		})
 	}
 
-	databaseID, err := uuid.Parse(databaseIDStr)
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
 	if err != nil {
+		return accessError(c, err)
+	}
+
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collectionName = services.CanonicalCollection(ctx, conn, collectionName)
+	if err := access.checkCollection(collectionName, models.PermissionRead); err != nil {
+		return accessError(c, err)
+	}
+
+	introspector, ok := conn.(services.Introspector)
+	if !ok {
 		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid database_id",
+			"error": "Schema details are not available for this database type",
 		})
 	}
 
+	schema, err := introspector.Introspect(ctx, collectionName, c.QueryInt("sample", 0))
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Collection not found",
+			})
+		}
+		log.Printf("Introspection error for collection '%s': %v", collectionName, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get collection schema: " + err.Error(),
+		})
+	}
+	access.limitSchema(collectionName, schema)
+
+	return c.JSON(schema)
+}
+
+// DocumentQuery selects documents of a collection. Filter is a JSON filter tree of
+// conditions and and/or groups, see services.FilterExpr. Sort lists columns such as
+// "created_at.desc,name"; Order applies to columns given without a direction.
+// Cursor continues from the next_cursor or prev_cursor of a previous response instead
+// of Page, and Total is exact, estimate or none.
+type DocumentQuery struct {
+	DatabaseID string          `json:"database_id"`
+	Search     string          `json:"search"`
+	Sort       string          `json:"sort"`
+	Order      string          `json:"order"`
+	Filter     json.RawMessage `json:"filter"`
+	Page       int             `json:"page"`
+	Limit      int             `json:"limit"`
+	Cursor     string          `json:"cursor"`
+	Total      string          `json:"total"`
+}
+
+// GetDocuments returns paginated documents from a collection
+func (h *DatabaseManagementHandler) GetDocuments(c *fiber.Ctx) error {
+	return h.listDocuments(c, documentQuery(c))
+}
+
+// documentQuery reads a DocumentQuery from the query string
+func documentQuery(c *fiber.Ctx) DocumentQuery {
 	// Parse pagination parameters
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	search := c.Query("search", "")
-	sortField := c.Query("sort", "")
-	sortOrder := c.Query("order", "asc")
 
+	query := DocumentQuery{
+		DatabaseID: c.Query("database_id"),
+		Search:     c.Query("search", ""),
+		Sort:       c.Query("sort", ""),
+		Order:      c.Query("order", "asc"),
+		Page:       page,
+		Limit:      limit,
+		Cursor:     c.Query("cursor"),
+		Total:      c.Query("total"),
+	}
+	if filter := c.Query("filter"); filter != "" {
+		query.Filter = json.RawMessage(filter)
+	}
+	return query
+}
+
+// QueryDocuments returns paginated documents matching a JSON filter sent in the body
+func (h *DatabaseManagementHandler) QueryDocuments(c *fiber.Ctx) error {
+	query := DocumentQuery{Page: 1, Limit: 10, Order: "asc"}
+	if err := c.BodyParser(&query); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	return h.listDocuments(c, query)
+}
+
+// documentOptions translates a DocumentQuery to the options of one page and its number
+func documentOptions(query DocumentQuery) (services.FindOptions, int, error) {
+	page, limit := query.Page, query.Limit
 	if page < 1 {
 		page = 1
 	}
@@ -571,228 +407,146 @@ func (h *DatabaseManagementHandler) GetDocuments(c *fiber.Ctx) error {
 		limit = 10
 	}
 
-	// Get database connection using helper function
-	connection, err := h.getDatabaseConnection(databaseID, userID)
-	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	findOptions := services.FindOptions{
+		Search: query.Search,
+		Limit:  limit,
 	}
-
-	var documents []interface{}
-	var total int64
-
-	switch connection.Type {
-	case "mongodb":
-		// Connect to MongoDB
-		client, err := h.dbService.ConnectMongoDB(*connection)
+	if query.Sort != "" {
+		order, err := services.ParseOrder(query.Sort)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to MongoDB: " + err.Error(),
-			})
+			return findOptions, page, err
 		}
-		defer client.Disconnect(context.Background())
-
-		collection := client.Database(connection.Database).Collection(collectionName)
-		
-		// Build filter
-		filter := bson.D{}
-		if search != "" {
-			// Create a regex search for multiple fields
-			searchRegex := bson.M{"$regex": search, "$options": "i"}
-			filter = bson.D{
-				{Key: "$or", Value: bson.A{
-					bson.M{"name": searchRegex},
-					bson.M{"title": searchRegex},
-					bson.M{"description": searchRegex},
-					bson.M{"content": searchRegex},
-				}},
+		// The order parameter sets the direction of a plain column list
+		if !strings.Contains(query.Sort, ".") && strings.EqualFold(query.Order, "desc") {
+			for i := range order {
+				order[i].Desc = true
 			}
 		}
-
-		// Build sort options
-		var sortOptions *options.FindOptions
-		if sortField != "" {
-			sortDirection := 1
-			if sortOrder == "desc" {
-				sortDirection = -1
-			}
-			sortOptions = options.Find().SetSort(bson.D{bson.E{Key: sortField, Value: sortDirection}})
-		} else {
-			sortOptions = options.Find()
-		}
-
-		// Get total count with timeout
-		countCtx, countCancel := context.WithTimeout(context.Background(), 10*time.Second)
-		total, err = collection.CountDocuments(countCtx, filter)
-		countCancel()
+		findOptions.Order = order
+	}
+	if len(query.Filter) > 0 && string(query.Filter) != "null" {
+		where, err := services.ParseFilterJSON(query.Filter)
 		if err != nil {
-			log.Printf("Error counting documents: %v", err)
+			return findOptions, page, err
 		}
+		findOptions.Where = where
+	}
+	return findOptions, page, nil
+}
 
-		// Get documents with pagination and memory optimization
-		skip := (page - 1) * limit
-		findCtx, findCancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer findCancel()
-		
-		cursor, err := collection.Find(findCtx, filter, 
-			sortOptions.SetSkip(int64(skip)).SetLimit(int64(limit)))
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to fetch documents: " + err.Error(),
-			})
-		}
-		defer cursor.Close(findCtx)
-
-		// Pre-allocate slice with exact capacity to minimize memory allocations
-		documents = make([]interface{}, 0, limit)
-		
-		for cursor.Next(findCtx) {
-			var doc bson.M
-			if err := cursor.Decode(&doc); err != nil {
-				continue
-			}
-			// Convert ObjectID to string for JSON
-			if id, ok := doc["_id"].(primitive.ObjectID); ok {
-				doc["id"] = id.Hex()
-			}
-			documents = append(documents, doc)
-		}
+func (h *DatabaseManagementHandler) listDocuments(c *fiber.Ctx, query DocumentQuery) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	
+	collectionName := c.Params("collection")
+	
+	if query.DatabaseID == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "database_id is required",
+		})
+	}
 
-	case "mysql", "postgresql", "postgres":
-		// For SQL databases
-		sqlClient, err := h.dbService.ConnectSQL(*connection)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to database: " + err.Error(),
-			})
-		}
-		defer sqlClient.Close()
-
-		// Build query
-		baseQuery := fmt.Sprintf("SELECT * FROM %s", collectionName)
-		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s", collectionName)
-		
-		log.Printf("GetDocuments - Initial query for collection '%s': %s", collectionName, baseQuery)
-		
-		var whereClause string
-		var args []interface{}
-		
-		if search != "" {
-			// Get column names first for proper search
-			var searchColumns []string
-			columnsQuery := fmt.Sprintf("SELECT column_name FROM information_schema.columns WHERE table_name = '%s'", collectionName)
-			if connection.Type == "mysql" {
-				columnsQuery = fmt.Sprintf("DESCRIBE %s", collectionName)
-			}
-			
-			rows, err := sqlClient.Query(columnsQuery)
-			if err == nil {
-				for rows.Next() {
-					var colName string
-					if connection.Type == "mysql" {
-						var fieldType, null, key, extra string
-						var defaultVal sql.NullString
-						rows.Scan(&colName, &fieldType, &null, &key, &defaultVal, &extra)
-					} else {
-						rows.Scan(&colName)
-					}
-					searchColumns = append(searchColumns, colName)
-				}
-				rows.Close()
-			}
+	databaseID, err := uuid.Parse(query.DatabaseID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid database_id",
+		})
+	}
 
-			if len(searchColumns) > 0 {
-				var searchConditions []string
-				for _, col := range searchColumns {
-					if connection.Type == "mysql" {
-						searchConditions = append(searchConditions, fmt.Sprintf("CAST(%s AS CHAR) LIKE ?", col))
-					} else {
-						searchConditions = append(searchConditions, fmt.Sprintf("CAST(%s AS TEXT) ILIKE ?", col))
-					}
-					args = append(args, "%"+search+"%")
-				}
-				whereClause = " WHERE " + strings.Join(searchConditions, " OR ")
-				baseQuery += whereClause
-				countQuery += whereClause
-			}
-		}
+	findOptions, page, err := documentOptions(query)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	limit := findOptions.Limit
 
-		// Get total count with minimal memory usage
-		var countArgs []interface{}
-		if len(args) > 0 {
-			countArgs = make([]interface{}, len(args))
-			copy(countArgs, args)
-		}
-		
-		log.Printf("GetDocuments - Count query: %s, args: %v", countQuery, countArgs)
-		err = sqlClient.QueryRow(countQuery, countArgs...).Scan(&total)
-		if err != nil {
-			log.Printf("Error counting rows: %v", err)
-		}
-		log.Printf("GetDocuments - Total count: %d", total)
+	// Get database connection using helper function
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
+
+	// Get documents with pagination and memory optimization
+	findCtx, findCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer findCancel()
 
-		// Add sorting and pagination
-		if sortField != "" && sortOrder != "" {
-			baseQuery += fmt.Sprintf(" ORDER BY %s %s", sortField, strings.ToUpper(sortOrder))
+	collectionName = services.CanonicalCollection(findCtx, conn, collectionName)
+	if err := access.limitFind(findCtx, conn, collectionName, &findOptions); err != nil {
+		var ungranted *grantError
+		if errors.As(err, &ungranted) {
+			return accessError(c, err)
 		}
-		
-		offset := (page - 1) * limit
-		baseQuery += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch documents: " + err.Error(),
+		})
+	}
+	if err := access.limitRows(collectionName, &findOptions); err != nil {
+		return accessError(c, err)
+	}
 
-		rows, err := sqlClient.Query(baseQuery, args...)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to fetch rows: " + err.Error(),
+	found, err := findDocuments(findCtx, conn, collectionName, findOptions, page, query.Cursor)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidQuery) || errors.Is(err, services.ErrNoCursor) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
 			})
 		}
-		defer rows.Close()
-
-		// Get column names for efficient scanning
-		columns, err := rows.Columns()
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to get columns: " + err.Error(),
+		if errors.Is(err, services.ErrUnsupported) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Filtering is not supported for this database type",
 			})
 		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch documents: " + err.Error(),
+		})
+	}
 
-		// Pre-allocate slice with exact capacity to minimize memory allocations
-		documents = make([]interface{}, 0, limit)
-		
-		// Create scan destination slice with pointers for memory efficiency
-		values := make([]interface{}, len(columns))
-		scanArgs := make([]interface{}, len(columns))
-		for i := range values {
-			scanArgs[i] = &values[i]
-		}
+	// Get total count with timeout
+	countCtx, countCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	total, estimated, err := services.CountTotal(countCtx, conn, collectionName, findOptions, query.Total)
+	countCancel()
+	if errors.Is(err, services.ErrInvalidQuery) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("Error counting documents: %v", err)
+	}
 
-		for rows.Next() {
-			if err := rows.Scan(scanArgs...); err != nil {
-				continue
-			}
+	access.stripDocuments(collectionName, found.Documents)
 
-			// Build document map using pointer references for memory efficiency
-			doc := make(map[string]interface{}, len(columns))
-			for i, col := range columns {
-				if values[i] != nil {
-					// Convert byte arrays to strings for proper JSON serialization
-					if b, ok := values[i].([]byte); ok {
-						doc[col] = string(b)
-					} else {
-						doc[col] = values[i]
-					}
-				}
-			}
-			documents = append(documents, doc)
-		}
+	// Pre-allocate slice with exact capacity to minimize memory allocations
+	documents := make([]interface{}, 0, len(found.Documents))
+	for _, doc := range found.Documents {
+		documents = append(documents, doc)
 	}
 
 	// Use optimized response struct
 	response := &DocumentResponse{
-		Documents: documents,
-		Total:     total,
-		Page:      page,
-		Limit:     limit,
+		Documents:      documents,
+		Total:          total,
+		TotalEstimated: estimated,
+		Page:           page,
+		Limit:          limit,
+		NextCursor:     found.NextCursor,
+		PrevCursor:     found.PrevCursor,
+	}
+	if keyed, ok := conn.(services.PrimaryKeyConn); ok {
+		if primaryKey, err := keyed.PrimaryKey(findCtx, collectionName); err == nil {
+			response.PrimaryKey = primaryKey
+		}
 	}
 
 	return c.JSON(response)
@@ -861,106 +615,52 @@ func (h *DatabaseManagementHandler) CreateDocument(c *fiber.Ctx) error {
 	log.Printf("Looking for database connection with ID: %s and userID: %s", databaseID, userID)
 
 	// Get database connection using helper function
-	connection, err := h.getDatabaseConnection(databaseID, userID)
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionWrite)
 	if err != nil {
-		log.Printf("Database connection not found error: %v", err)
-		return c.Status(404).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		log.Printf("Database access error: %v", err)
+		return accessError(c, err)
 	}
 
-	log.Printf("Found connection: %+v", *connection)
-
-	switch connection.Type {
-	case "mongodb":
-		log.Printf("Processing MongoDB database type: %s", connection.Type)
-		// Connect to MongoDB
-		client, err := h.dbService.ConnectMongoDB(*connection)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to MongoDB: " + err.Error(),
-			})
-		}
-		defer client.Disconnect(context.Background())
-
-		collection := client.Database(connection.Database).Collection(collectionName)
-		
-		// Add timestamp
-		req.Data["created_at"] = time.Now()
-		
-		result, err := collection.InsertOne(context.Background(), req.Data)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to create document: " + err.Error(),
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"success": true,
-			"id":      result.InsertedID,
-		})
-
-	case "mysql", "postgresql", "postgres":
-		log.Printf("Processing SQL database type: %s", connection.Type)
-		// For SQL databases, convert map to INSERT statement
-		sqlClient, err := h.dbService.ConnectSQL(*connection)
-		if err != nil {
-			log.Printf("SQL connection error: %v", err)
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to database: " + err.Error(),
-			})
-		}
-		defer sqlClient.Close()
-
-		// Build INSERT query
-		var columns []string
-		var placeholders []string
-		var values []interface{}
-		
-		i := 1
-		for key, value := range req.Data {
-			columns = append(columns, key)
-			
-			// Use different placeholder format based on database type
-			if connection.Type == "postgresql" || connection.Type == "postgres" {
-				placeholders = append(placeholders, fmt.Sprintf("$%d", i))
-				i++
-			} else {
-				placeholders = append(placeholders, "?")
-			}
-			
-			values = append(values, value)
-		}
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
 
-		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-			collectionName,
-			strings.Join(columns, ", "),
-			strings.Join(placeholders, ", "))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-		log.Printf("Executing SQL query: %s", query)
-		log.Printf("With values: %+v", values)
+	collectionName = services.CanonicalCollection(ctx, conn, collectionName)
+	if err := access.checkCollection(collectionName, models.PermissionWrite); err != nil {
+		return accessError(c, err)
+	}
+	if err := access.checkColumns(collectionName, documentFields(req.Data), models.PermissionWrite); err != nil {
+		return accessError(c, err)
+	}
 
-		result, err := sqlClient.Exec(query, values...)
-		if err != nil {
-			log.Printf("SQL execution error: %v", err)
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to create record: " + err.Error(),
-			})
+	// Document stores get an automatic timestamp
+	if h.dbService.Kind(connection.Type) == services.KindDocument {
+		if req.Data == nil {
+			req.Data = make(map[string]interface{})
 		}
+		req.Data["created_at"] = time.Now()
+	}
 
-		id, _ := result.LastInsertId()
-		log.Printf("Successfully created record with ID: %d", id)
-		return c.JSON(fiber.Map{
-			"success": true,
-			"id":      id,
-		})
-
-	default:
-		log.Printf("Unsupported database type: %s", connection.Type)
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Unsupported database type",
-		})
+	scope, err := access.rowScope(collectionName)
+	if err != nil {
+		return accessError(c, err)
+	}
+	id, err := services.InsertScoped(ctx, conn, collectionName, req.Data, scope)
+	if err != nil {
+		log.Printf("Insert error: %v", err)
+		return documentError(c, err, "Failed to create document: ")
 	}
+
+	log.Printf("Successfully created document with ID: %v", id)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"id":      id,
+	})
 }
 
 // UpdateDocument updates a document in a collection
@@ -973,7 +673,7 @@ func (h *DatabaseManagementHandler) UpdateDocument(c *fiber.Ctx) error {
 	}
 	
 	collectionName := c.Params("collection")
-	documentID := c.Params("id")
+	documentKey := recordKey(c)
 	
 	var req struct {
 		DatabaseID string                 `json:"database_id"`
@@ -994,122 +694,51 @@ func (h *DatabaseManagementHandler) UpdateDocument(c *fiber.Ctx) error {
 	}
 
 	// Get database connection using helper function
-	connection, err := h.getDatabaseConnection(databaseID, userID)
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionWrite)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return accessError(c, err)
 	}
 
-	switch connection.Type {
-	case "mongodb":
-		// Connect to MongoDB
-		client, err := h.dbService.ConnectMongoDB(*connection)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to MongoDB: " + err.Error(),
-			})
-		}
-		defer client.Disconnect(context.Background())
-
-		collection := client.Database(connection.Database).Collection(collectionName)
-		
-		// Convert string ID to ObjectID
-		objID, err := primitive.ObjectIDFromHex(documentID)
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid document ID",
-			})
-		}
-
-		// Add timestamp
-		req.Data["updated_at"] = time.Now()
-		
-		filter := bson.D{bson.E{Key: "_id", Value: objID}}
-		update := bson.D{bson.E{Key: "$set", Value: req.Data}}
-		
-		result, err := collection.UpdateOne(context.Background(), filter, update)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to update document: " + err.Error(),
-			})
-		}
-
-		if result.MatchedCount == 0 {
-			return c.Status(404).JSON(fiber.Map{
-				"error": "Document not found",
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"success": true,
-			"modified": result.ModifiedCount,
-		})
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
 
-	case "mysql", "postgresql", "postgres":
-		// For SQL databases
-		sqlClient, err := h.dbService.ConnectSQL(*connection)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to database: " + err.Error(),
-			})
-		}
-		defer sqlClient.Close()
-
-		// Build UPDATE query
-		var setPairs []string
-		var values []interface{}
-		
-		i := 1
-		for key, value := range req.Data {
-			if connection.Type == "postgresql" || connection.Type == "postgres" {
-				setPairs = append(setPairs, fmt.Sprintf("%s = $%d", key, i))
-				i++
-			} else {
-				setPairs = append(setPairs, key+" = ?")
-			}
-			values = append(values, value)
-		}
-		
-		// Add ID to values
-		values = append(values, documentID)
-
-		var query string
-		if connection.Type == "postgresql" || connection.Type == "postgres" {
-			query = fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d",
-				collectionName,
-				strings.Join(setPairs, ", "),
-				i)
-		} else {
-			query = fmt.Sprintf("UPDATE %s SET %s WHERE id = ?",
-				collectionName,
-				strings.Join(setPairs, ", "))
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-		result, err := sqlClient.Exec(query, values...)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to update record: " + err.Error(),
-			})
-		}
+	collectionName = services.CanonicalCollection(ctx, conn, collectionName)
+	if err := access.checkCollection(collectionName, models.PermissionWrite); err != nil {
+		return accessError(c, err)
+	}
+	if err := access.checkColumns(collectionName, documentFields(req.Data), models.PermissionWrite); err != nil {
+		return accessError(c, err)
+	}
+	if err := access.checkColumns(collectionName, keyColumns(ctx, conn, collectionName, documentKey), models.PermissionRead); err != nil {
+		return accessError(c, err)
+	}
 
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			return c.Status(404).JSON(fiber.Map{
-				"error": "Record not found",
-			})
+	// Document stores get an automatic timestamp
+	if h.dbService.Kind(connection.Type) == services.KindDocument {
+		if req.Data == nil {
+			req.Data = make(map[string]interface{})
 		}
+		req.Data["updated_at"] = time.Now()
+	}
 
-		return c.JSON(fiber.Map{
-			"success": true,
-			"modified": rowsAffected,
-		})
-
-	default:
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Unsupported database type",
-		})
+	if documentKey.Scope, err = access.rowScope(collectionName); err != nil {
+		return accessError(c, err)
 	}
+	modified, err := services.UpdateScoped(ctx, conn, collectionName, documentKey, req.Data)
+	if err != nil {
+		return documentError(c, err, "Failed to update document: ")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"modified": modified,
+	})
 }
 
 // DeleteDocument deletes a document from a collection
@@ -1122,7 +751,7 @@ func (h *DatabaseManagementHandler) DeleteDocument(c *fiber.Ctx) error {
 	}
 	
 	collectionName := c.Params("collection")
-	documentID := c.Params("id")
+	documentKey := recordKey(c)
 	
 	var req struct {
 		DatabaseID string `json:"database_id"`
@@ -1142,93 +771,266 @@ func (h *DatabaseManagementHandler) DeleteDocument(c *fiber.Ctx) error {
 	}
 
 	// Get database connection using helper function
-	connection, err := h.getDatabaseConnection(databaseID, userID)
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionWrite)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
+		return accessError(c, err)
+	}
+
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collectionName = services.CanonicalCollection(ctx, conn, collectionName)
+	// Deleting a record removes every column, all of them must be writable
+	if !access.grants.AllColumns(collectionName, models.PermissionWrite) {
+		return accessError(c, &grantError{collection: collectionName, access: models.PermissionWrite})
+	}
+	if err := access.checkColumns(collectionName, keyColumns(ctx, conn, collectionName, documentKey), models.PermissionRead); err != nil {
+		return accessError(c, err)
+	}
+
+	if documentKey.Scope, err = access.rowScope(collectionName); err != nil {
+		return accessError(c, err)
+	}
+	deleted, err := conn.Delete(ctx, collectionName, documentKey)
+	if err != nil {
+		return documentError(c, err, "Failed to delete document: ")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"deleted": deleted,
+	})
+}
+
+// GetKeys scans the keys of a key-value database (e.g. Redis)
+func (h *DatabaseManagementHandler) GetKeys(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	switch connection.Type {
-	case "mongodb":
-		// Connect to MongoDB
-		client, err := h.dbService.ConnectMongoDB(*connection)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to MongoDB: " + err.Error(),
-			})
-		}
-		defer client.Disconnect(context.Background())
+	databaseID, err := uuid.Parse(c.Query("database_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid database_id",
+		})
+	}
 
-		collection := client.Database(connection.Database).Collection(collectionName)
-		
-		// Convert string ID to ObjectID
-		objID, err := primitive.ObjectIDFromHex(documentID)
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid document ID",
-			})
-		}
+	pattern := c.Query("pattern", "*")
+	cursor := c.Query("cursor", "")
+	count, _ := strconv.Atoi(c.Query("count", "100"))
+	if count < 1 || count > 1000 {
+		count = 100
+	}
 
-		filter := bson.D{bson.E{Key: "_id", Value: objID}}
-		
-		result, err := collection.DeleteOne(context.Background(), filter)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to delete document: " + err.Error(),
-			})
-		}
+	// Get database connection using helper function
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
+	if err != nil {
+		return accessError(c, err)
+	}
+	if err := access.unrestricted(); err != nil {
+		return accessError(c, err)
+	}
+
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
+
+	kvConn, ok := conn.(services.KeyValueConn)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Key browsing is only available for key-value databases",
+		})
+	}
 
-		if result.DeletedCount == 0 {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	keys, nextCursor, err := kvConn.ScanKeys(ctx, pattern, cursor, count)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to scan keys: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"keys":        keys,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetKey returns the type-aware value and TTL of a single key
+func (h *DatabaseManagementHandler) GetKey(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	databaseID, err := uuid.Parse(c.Query("database_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid database_id",
+		})
+	}
+
+	key, err := url.PathUnescape(c.Params("key"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid key",
+		})
+	}
+
+	// Get database connection using helper function
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
+	if err != nil {
+		return accessError(c, err)
+	}
+	if err := access.unrestricted(); err != nil {
+		return accessError(c, err)
+	}
+
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
+
+	kvConn, ok := conn.(services.KeyValueConn)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Key browsing is only available for key-value databases",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	value, err := kvConn.GetKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
 			return c.Status(404).JSON(fiber.Map{
-				"error": "Document not found",
+				"error": "Key not found",
 			})
 		}
-
-		return c.JSON(fiber.Map{
-			"success": true,
-			"deleted": result.DeletedCount,
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to read key: " + err.Error(),
 		})
+	}
 
-	case "mysql", "postgresql", "postgres":
-		// For SQL databases
-		sqlClient, err := h.dbService.ConnectSQL(*connection)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to connect to database: " + err.Error(),
-			})
+	return c.JSON(value)
+}
+
+// recordKey reads the record key from the :id parameter ("k1,k2" for composite keys)
+// or, without one, from query parameters named after the key columns
+func recordKey(c *fiber.Ctx, reserved ...string) services.RecordKey {
+	if id := c.Params("id"); id != "" {
+		return services.IDKey(id)
+	}
+
+	key := services.RecordKey{Columns: make(map[string]string)}
+	c.Context().QueryArgs().VisitAll(func(name, value []byte) {
+		for _, r := range reserved {
+			if string(name) == r {
+				return
+			}
 		}
-		defer sqlClient.Close()
+		key.Columns[string(name)] = string(value)
+	})
+	return key
+}
 
-		var query string
-		if connection.Type == "postgresql" || connection.Type == "postgres" {
-			query = fmt.Sprintf("DELETE FROM %s WHERE id = $1", collectionName)
-		} else {
-			query = fmt.Sprintf("DELETE FROM %s WHERE id = ?", collectionName)
+// keyColumns returns the columns whose values a record key gives: those of a composite
+// key, or the primary key of the collection for an identifier
+func keyColumns(ctx context.Context, conn services.Conn, collection string, key services.RecordKey) []string {
+	if len(key.Columns) == 0 {
+		if keyed, ok := conn.(services.PrimaryKeyConn); ok {
+			// Collections without a key are rejected when the record is addressed
+			columns, _ := keyed.PrimaryKey(ctx, collection)
+			return columns
 		}
-		
-		result, err := sqlClient.Exec(query, documentID)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to delete record: " + err.Error(),
-			})
+	}
+	columns := make([]string, 0, len(key.Columns))
+	for column := range key.Columns {
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// documentFields returns the field names of a document sent by the client
+func documentFields(data map[string]interface{}) []string {
+	fields := make([]string, 0, len(data))
+	for field := range data {
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// findDocuments lists a page by cursor when the collection supports it, so the first
+// page already carries a next_cursor, and by offset otherwise
+func findDocuments(ctx context.Context, conn services.Conn, collection string, opts services.FindOptions, page int, cursor string) (*services.Page, error) {
+	if cursor != "" || page == 1 {
+		result, err := services.FindPage(ctx, conn, collection, opts, cursor)
+		if cursor != "" || !errors.Is(err, services.ErrNoCursor) {
+			return result, err
 		}
+	}
 
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			return c.Status(404).JSON(fiber.Map{
-				"error": "Record not found",
-			})
+	// Pages keep the order of the first one, including its primary key tie-breaker
+	if keyset, ok := conn.(services.KeysetConn); ok {
+		if order, err := keyset.KeysetOrder(ctx, collection, opts); err == nil {
+			opts.Order = order
 		}
+	}
+	opts.Offset = (page - 1) * opts.Limit
+	documents, err := conn.Find(ctx, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &services.Page{Documents: documents}, nil
+}
 
-		return c.JSON(fiber.Map{
-			"success": true,
-			"deleted": rowsAffected,
+// documentError maps driver errors on single-document operations to HTTP responses
+func documentError(c *fiber.Ctx, err error, prefix string) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidID):
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid document ID: " + err.Error(),
 		})
-
-	default:
+	case errors.Is(err, services.ErrNoPrimaryKey):
 		return c.Status(400).JSON(fiber.Map{
-			"error": "Unsupported database type",
+			"error": "Documents of this collection cannot be addressed, it has no primary key",
+		})
+	case errors.Is(err, services.ErrInvalidQuery):
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrNotFound):
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Document not found",
+		})
+	case errors.Is(err, services.ErrOutOfScope):
+		return c.Status(403).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrUnsupported):
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Operation not supported for this database type",
+		})
+	default:
+		return c.Status(500).JSON(fiber.Map{
+			"error": prefix + err.Error(),
 		})
 	}
 }
@@ -2,32 +2,34 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"db-manager-backend/config"
 	"db-manager-backend/models"
+	"db-manager-backend/services"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"gorm.io/driver/mysql"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
 // DynamicAPIHandlerOptimized - Memory optimized version using pointers
 type DynamicAPIHandlerOptimized struct {
-	dbConnPool map[string]*gorm.DB // Connection pool untuk reuse
+	dbService   *services.DatabaseService
+	connections *services.ConnectionManager // shared connection pool
+	// Fail fast with 503 when the health monitor marked the database unreachable
+	rejectUnreachable bool
 }
 
-func NewDynamicAPIHandlerOptimized() *DynamicAPIHandlerOptimized {
+func NewDynamicAPIHandlerOptimized(connections *services.ConnectionManager) *DynamicAPIHandlerOptimized {
 	return &DynamicAPIHandlerOptimized{
-		dbConnPool: make(map[string]*gorm.DB),
+		dbService:         services.NewDatabaseService(),
+		connections:       connections,
+		rejectUnreachable: config.GetEnv("DYNAMIC_API_REJECT_UNREACHABLE", "false") == "true",
 	}
 }
 
@@ -56,13 +58,19 @@ func (h *DynamicAPIHandlerOptimized) ValidateEndpoint(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Database connection not found"})
 	}
 
-	// Check if endpoint exists and is active
+	// Published queries take precedence over collections on the same path
 	var endpoint models.APIEndpoint
-	if err := config.DB.Where("database_id = ? AND collection = ? AND method = ? AND is_active = ?", 
-		databasePtr.ID, collection, method, true).First(&endpoint).Error; err != nil {
-		return c.Status(403).JSON(fiber.Map{
-			"error": "Endpoint not found or inactive",
-		})
+	published := config.DB.Where("database_id = ? AND kind = ? AND path = ? AND method = ? AND is_active = ?",
+		databasePtr.ID, models.EndpointKindQuery, strings.TrimRight(c.Path(), "/"), method, true).
+		Limit(1).Find(&endpoint)
+	if published.Error != nil || published.RowsAffected == 0 {
+		// Check if endpoint exists and is active
+		if err := config.DB.Where("database_id = ? AND kind = ? AND collection = ? AND method = ? AND is_active = ?", 
+			databasePtr.ID, models.EndpointKindCollection, collection, method, true).First(&endpoint).Error; err != nil {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "Endpoint not found or inactive",
+			})
+		}
 	}
 
 	c.Locals("endpoint", &endpoint)
@@ -80,14 +88,34 @@ func (h *DynamicAPIHandlerOptimized) ValidateAPIKey(c *fiber.Ctx) error {
 
 	// Use pointer to avoid copying struct
 	var key *models.APIKey = &models.APIKey{}
-	if err := config.DB.Preload("Database").Where("key = ? AND is_active = ?", apiKey, true).First(key).Error; err != nil {
+	if err := config.DB.Preload("Database").Preload("User").Where("key = ? AND is_active = ?", apiKey, true).First(key).Error; err != nil {
 		return c.Status(401).JSON(fiber.Map{
 			"error": "Invalid API key",
 		})
 	}
 
-	// Store pointer in locals
+	// Keys act with the role of their creator, who may have lost access since
+	required := models.PermissionWrite
+	if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+		required = models.PermissionRead
+	}
+	access, err := authorize(key.DatabaseID, key.UserID, required)
+	if err != nil {
+		var denied *permissionError
+		if errors.As(err, &denied) || errors.Is(err, errNoAccess) {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "API key does not have " + required + " access to this database",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to check API key access",
+		})
+	}
+
+	// Store pointer in locals. The key is limited to the grants and row filters of
+	// its creator.
 	c.Locals("apiKey", key)
+	c.Locals("keyAccess", access)
 	c.Locals("database", &key.Database)
 	return c.Next()
 }
@@ -151,141 +179,126 @@ func (h *DynamicAPIHandlerOptimized) LogRequest(c *fiber.Ctx) error {
 	return err
 }
 
-// Connection pool for database reuse
-func (h *DynamicAPIHandlerOptimized) getDBConnection(database *models.DatabaseConnection) (*gorm.DB, error) {
-	// Create connection key
-	connKey := fmt.Sprintf("%s_%s_%s_%d", database.Type, database.Host, database.Database, database.Port)
-	
-	// Check if connection exists in pool
-	if db, exists := h.dbConnPool[connKey]; exists {
-		// Test connection
-		sqlDB, _ := db.DB()
-		if err := sqlDB.Ping(); err == nil {
-			return db, nil
-		}
-		// Remove dead connection
-		delete(h.dbConnPool, connKey)
-	}
+// errDatabaseMissing signals that ValidateAPIKey did not resolve a database
+var errDatabaseMissing = errors.New("database connection not found")
 
-	// Create new connection
-	var db *gorm.DB
-	var err error
+// errDatabaseUnreachable signals that the health monitor found the database down
+var errDatabaseUnreachable = errors.New("database is unreachable")
 
-	switch database.Type {
-	case "mysql":
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-			database.Username, database.Password, database.Host, database.Port, database.Database)
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	case "postgres":
-		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
-			database.Host, database.Username, database.Password, database.Database, database.Port)
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	default:
-		return nil, fmt.Errorf("unsupported database type")
+// keyAccess returns the access of the creator of the request's API key
+func keyAccess(c *fiber.Ctx) (*databaseAccess, error) {
+	access, ok := c.Locals("keyAccess").(*databaseAccess)
+	if !ok || access == nil {
+		return nil, errDatabaseMissing
 	}
-
-	if err != nil {
-		return nil, err
-	}
-
-	// Configure connection pool
-	sqlDB, _ := db.DB()
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	// Store in pool
-	h.dbConnPool[connKey] = db
-	return db, nil
+	return access, nil
 }
 
-// Optimized HandlePOST using pointers and address
-func (h *DynamicAPIHandlerOptimized) HandlePOST(c *fiber.Ctx) error {
-	// Use pointer from locals
+// requestConnection acquires the pooled connection for the API key's database.
+// The returned release function must be called when the request is done.
+func (h *DynamicAPIHandlerOptimized) requestConnection(c *fiber.Ctx) (services.Conn, func(), error) {
 	databasePtr, ok := c.Locals("database").(*models.DatabaseConnection)
 	if !ok || databasePtr == nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection not found"})
+		return nil, nil, errDatabaseMissing
 	}
-	
-	collection := c.Params("collection")
-
-	switch databasePtr.Type {
-	case "mongodb":
-		return h.handleMongoPOSTOptimized(c, databasePtr, collection)
-	case "mysql", "postgres":
-		return h.handleSQLPOSTOptimized(c, databasePtr, collection)
-	default:
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Unsupported database type",
-		})
+	if h.rejectUnreachable && databasePtr.Status == models.ConnectionStatusUnreachable {
+		return nil, nil, errDatabaseUnreachable
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return h.connections.Acquire(ctx, databasePtr)
 }
 
-// Optimized SQL POST handler
-func (h *DynamicAPIHandlerOptimized) handleSQLPOSTOptimized(c *fiber.Ctx, database *models.DatabaseConnection, table string) error {
-	// Use connection pool
-	db, err := h.getDBConnection(database)
-	if err != nil {
+// connectionError maps a failure to obtain a connection to an HTTP response
+func (h *DynamicAPIHandlerOptimized) connectionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errDatabaseMissing):
+		return c.Status(500).JSON(fiber.Map{"error": "Database connection not found"})
+	case errors.Is(err, services.ErrUnsupported), errors.Is(err, services.ErrUnknownType):
+		return c.Status(400).JSON(fiber.Map{"error": "Unsupported database type"})
+	case errors.Is(err, services.ErrPoolExhausted):
+		return c.Status(503).JSON(fiber.Map{"error": "Too many open database connections, try again later"})
+	case errors.Is(err, errDatabaseUnreachable):
+		c.Set("Retry-After", "60")
+		return c.Status(503).JSON(fiber.Map{"error": "The backing database is currently unreachable, try again later"})
+	default:
 		return c.Status(500).JSON(fiber.Map{"error": "Database connection failed"})
 	}
+}
 
-	// Use pointer for data to avoid copying
-	data := make(map[string]interface{})
-	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
-	}
-
-	// Use address of data
-	if err := db.Table(table).Create(&data).Error; err != nil {
+// recordError maps driver errors on single-record operations to HTTP responses
+func recordError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidID):
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID format", "details": err.Error()})
+	case errors.Is(err, services.ErrNoPrimaryKey):
+		return c.Status(400).JSON(fiber.Map{"error": "Records of this collection cannot be addressed, it has no primary key"})
+	case errors.Is(err, services.ErrInvalidQuery):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": "Record not found"})
+	case errors.Is(err, services.ErrOutOfScope):
+		return c.Status(403).JSON(fiber.Map{"error": "Record is outside the rows this API key can access"})
+	case errors.Is(err, services.ErrUnsupported):
+		return c.Status(405).JSON(fiber.Map{"error": "Operation not supported for this database type"})
+	default:
 		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to create record",
+			"error":   message,
 			"details": err.Error(),
 		})
 	}
+}
 
-	return c.Status(201).JSON(fiber.Map{
-		"message": "Record created successfully",
-		"data":    &data, // Return pointer to avoid copying
-	})
+// rowFilterError answers requests of API keys whose row filter cannot be applied
+func rowFilterError(c *fiber.Ctx) error {
+	return c.Status(500).JSON(fiber.Map{"error": "Invalid row filter of API key"})
 }
 
-// MongoDB optimized handler
-func (h *DynamicAPIHandlerOptimized) handleMongoPOSTOptimized(c *fiber.Ctx, database *models.DatabaseConnection, collection string) error {
+// Optimized HandlePOST using pointers and address
+func (h *DynamicAPIHandlerOptimized) HandlePOST(c *fiber.Ctx) error {
+	conn, release, err := h.requestConnection(c)
+	if err != nil {
+		return h.connectionError(c, err)
+	}
+	defer release()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var uri string
-	if database.Username != "" && database.Password != "" {
-		uri = fmt.Sprintf("mongodb://%s:%s@%s:%d/%s",
-			database.Username, database.Password, database.Host, database.Port, database.Database)
-	} else {
-		uri = fmt.Sprintf("mongodb://%s:%d/%s", database.Host, database.Port, database.Database)
+	collection := services.CanonicalCollection(ctx, conn, c.Params("collection"))
+
+	// Use pointer for data to avoid copying
+	data := make(services.Document)
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
 	}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	access, err := keyAccess(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection failed"})
+		return h.connectionError(c, err)
 	}
-	defer client.Disconnect(ctx)
-
-	// Use pointer for document
-	document := make(bson.M)
-	if err := c.BodyParser(&document); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	if err := access.checkCollection(collection, models.PermissionWrite); err != nil {
+		return accessError(c, err)
+	}
+	if err := access.checkColumns(collection, documentFields(data), models.PermissionWrite); err != nil {
+		return accessError(c, err)
 	}
 
-	db := client.Database(database.Database)
-	coll := db.Collection(collection)
-
-	result, err := coll.InsertOne(ctx, &document) // Use address
+	scope, err := keyRowScope(c, collection)
+	if err != nil {
+		return rowFilterError(c)
+	}
+	id, err := services.InsertScoped(ctx, conn, collection, data, scope)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to insert document"})
+		return recordError(c, err, "Failed to create record")
 	}
 
 	return c.Status(201).JSON(fiber.Map{
-		"id":      result.InsertedID,
-		"message": "Document created successfully",
-		"data":    &document, // Return pointer
+		"id":      id,
+		"message": "Record created successfully",
+		"data":    &data, // Return pointer to avoid copying
 	})
 }
 
@@ -314,328 +327,251 @@ func (h *DynamicAPIHandlerOptimized) GetMemoryStats(c *fiber.Ctx) error {
 			"gc_cpu_fraction": m.GCCPUFraction,
 		},
 		"goroutines": runtime.NumGoroutine(),
-		"connections": map[string]interface{}{
-			"pool_size": len(h.dbConnPool),
-			"active_connections": func() int {
-				active := 0
-				for _, db := range h.dbConnPool {
-					if sqlDB, err := db.DB(); err == nil {
-						if stats := sqlDB.Stats(); stats.OpenConnections > 0 {
-							active++
-						}
-					}
-				}
-				return active
-			}(),
-		},
+		"connections": h.connections.Stats(),
 	}
 
 	return c.JSON(stats)
 }
 
-// Handle GET requests
-func (h *DynamicAPIHandlerOptimized) HandleGET(c *fiber.Ctx) error {
-	databasePtr, ok := c.Locals("database").(*models.DatabaseConnection)
-	if !ok || databasePtr == nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection not found"})
-	}
-	
-	collection := c.Params("collection")
-	id := c.Params("id", "")
-
-	switch databasePtr.Type {
-	case "mongodb":
-		return h.handleMongoGETOptimized(c, databasePtr, collection, id)
-	case "mysql", "postgres":
-		return h.handleSQLGETOptimized(c, databasePtr, collection, id)
-	default:
-		return c.Status(400).JSON(fiber.Map{"error": "Unsupported database type"})
-	}
+// reservedQueryParams are query parameters of GET that are not column filters
+var reservedQueryParams = map[string]bool{
+	"page": true, "limit": true, "order": true, "select": true, "cursor": true, "total": true,
 }
 
-// Handle PUT requests
-func (h *DynamicAPIHandlerOptimized) HandlePUT(c *fiber.Ctx) error {
-	databasePtr, ok := c.Locals("database").(*models.DatabaseConnection)
-	if !ok || databasePtr == nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection not found"})
+// queryOptions parses column filters (?status=eq.active&age=gte.18), order
+// (?order=created_at.desc,name) and field selection (?select=id,name)
+func queryOptions(c *fiber.Ctx) (services.FindOptions, error) {
+	var opts services.FindOptions
+	var err error
+
+	c.Context().QueryArgs().VisitAll(func(name, value []byte) {
+		if err != nil || reservedQueryParams[string(name)] {
+			return
+		}
+		var filter services.Filter
+		filter, err = services.ParseFilter(string(name), string(value))
+		opts.Filters = append(opts.Filters, filter)
+	})
+	if err != nil {
+		return opts, err
 	}
-	
-	collection := c.Params("collection")
-	id := c.Params("id")
 
-	switch databasePtr.Type {
-	case "mongodb":
-		return h.handleMongoPUTOptimized(c, databasePtr, collection, id)
-	case "mysql", "postgres":
-		return h.handleSQLPUTOptimized(c, databasePtr, collection, id)
-	default:
-		return c.Status(400).JSON(fiber.Map{"error": "Unsupported database type"})
+	if order := c.Query("order"); order != "" {
+		if opts.Order, err = services.ParseOrder(order); err != nil {
+			return opts, err
+		}
 	}
+	opts.Select = services.ParseSelect(c.Query("select"))
+	return opts, nil
 }
 
-// Handle DELETE requests
-func (h *DynamicAPIHandlerOptimized) HandleDELETE(c *fiber.Ctx) error {
-	databasePtr, ok := c.Locals("database").(*models.DatabaseConnection)
-	if !ok || databasePtr == nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection not found"})
+// Handle GET requests
+func (h *DynamicAPIHandlerOptimized) HandleGET(c *fiber.Ctx) error {
+	conn, release, err := h.requestConnection(c)
+	if err != nil {
+		return h.connectionError(c, err)
 	}
-	
-	collection := c.Params("collection")
-	id := c.Params("id")
+	defer release()
 
-	switch databasePtr.Type {
-	case "mongodb":
-		return h.handleMongoDELETEOptimized(c, databasePtr, collection, id)
-	case "mysql", "postgres":
-		return h.handleSQLDELETEOptimized(c, databasePtr, collection, id)
-	default:
-		return c.Status(400).JSON(fiber.Map{"error": "Unsupported database type"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := services.CanonicalCollection(ctx, conn, c.Params("collection"))
+	id := c.Params("id", "")
+
+	access, err := keyAccess(c)
+	if err != nil {
+		return h.connectionError(c, err)
+	}
+	if err := access.checkCollection(collection, models.PermissionRead); err != nil {
+		return accessError(c, err)
 	}
-}
 
-// Optimized SQL GET handler
-func (h *DynamicAPIHandlerOptimized) handleSQLGETOptimized(c *fiber.Ctx, database *models.DatabaseConnection, table, id string) error {
-	db, err := h.getDBConnection(database)
+	scope, err := keyRowScope(c, collection)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection failed"})
+		return rowFilterError(c)
 	}
 
 	if id != "" {
-		result := make(map[string]interface{})
-		if err := db.Table(table).Where("id = ?", id).First(&result).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return c.Status(404).JSON(fiber.Map{"error": "Record not found"})
-			}
-			return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
+		key := recordKey(c)
+		if err := access.checkColumns(collection, keyColumns(ctx, conn, collection, key), models.PermissionRead); err != nil {
+			return accessError(c, err)
 		}
-		return c.JSON(&result) // Return pointer
-	} else {
-		page, _ := strconv.Atoi(c.Query("page", "1"))
-		limit, _ := strconv.Atoi(c.Query("limit", "10"))
-		offset := (page - 1) * limit
-
-		results := make([]map[string]interface{}, 0)
-		if err := db.Table(table).Offset(offset).Limit(limit).Find(&results).Error; err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
+		key.Scope = scope
+		result, err := conn.Get(ctx, collection, key)
+		if err != nil {
+			return recordError(c, err, "Database query failed")
 		}
-
-		var total int64
-		db.Table(table).Count(&total)
-
-		return c.JSON(fiber.Map{
-			"data":  &results, // Return pointer
-			"total": total,
-			"page":  page,
-			"limit": limit,
-		})
+		access.stripDocuments(collection, []services.Document{result})
+		return c.JSON(&result) // Return pointer
 	}
-}
 
-// Optimized SQL PUT handler
-func (h *DynamicAPIHandlerOptimized) handleSQLPUTOptimized(c *fiber.Ctx, database *models.DatabaseConnection, table, id string) error {
-	db, err := h.getDBConnection(database)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection failed"})
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+	// Same bounds as the document browser
+	if page < 1 {
+		page = 1
 	}
-
-	data := make(map[string]interface{})
-	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	if limit < 1 || limit > 100 {
+		limit = 10
 	}
-
-	result := db.Table(table).Where("id = ?", id).Updates(&data)
-	if result.Error != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to update record"})
+	findOptions, err := queryOptions(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
-
-	if result.RowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{"error": "Record not found"})
+	findOptions.Limit = limit
+	if err := access.limitFind(ctx, conn, collection, &findOptions); err != nil {
+		var ungranted *grantError
+		if errors.As(err, &ungranted) {
+			return accessError(c, err)
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
 	}
+	findOptions.Where = services.AndFilters(findOptions.Where, scope)
 
-	return c.JSON(fiber.Map{
-		"message": "Record updated successfully",
-		"data":    &data,
-	})
-}
-
-// Optimized SQL DELETE handler
-func (h *DynamicAPIHandlerOptimized) handleSQLDELETEOptimized(c *fiber.Ctx, database *models.DatabaseConnection, table, id string) error {
-	db, err := h.getDBConnection(database)
+	cursor := c.Query("cursor")
+	results, err := findDocuments(ctx, conn, collection, findOptions, page, cursor)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection failed"})
+		if errors.Is(err, services.ErrInvalidQuery) || errors.Is(err, services.ErrNoCursor) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, services.ErrUnsupported) {
+			return c.Status(400).JSON(fiber.Map{"error": "Filtering is not supported for this database type"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
 	}
-
-	result := db.Table(table).Where("id = ?", id).Delete(nil)
-	if result.Error != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete record"})
+	total, estimated, err := services.CountTotal(ctx, conn, collection, findOptions, c.Query("total"))
+	if errors.Is(err, services.ErrInvalidQuery) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
+	access.stripDocuments(collection, results.Documents)
 
-	if result.RowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{"error": "Record not found"})
+	var links []string
+	if results.NextCursor != "" {
+		links = append(links, `<`+cursorURL(c, results.NextCursor)+`>; rel="next"`)
+	}
+	if results.PrevCursor != "" {
+		links = append(links, `<`+cursorURL(c, results.PrevCursor)+`>; rel="prev"`)
+	}
+	if len(links) > 0 {
+		c.Set("Link", strings.Join(links, ", "))
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "Record deleted successfully",
-	})
+	response := fiber.Map{
+		"data":        &results.Documents, // Return pointer
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"next_cursor": nullable(results.NextCursor),
+		"prev_cursor": nullable(results.PrevCursor),
+	}
+	if estimated {
+		response["total_estimated"] = true
+	}
+	return c.JSON(response)
 }
 
-// Optimized MongoDB handlers
-func (h *DynamicAPIHandlerOptimized) handleMongoGETOptimized(c *fiber.Ctx, database *models.DatabaseConnection, collection, id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// cursorURL returns the URL of the current request continuing from cursor
+func cursorURL(c *fiber.Ctx, cursor string) string {
+	query, _ := url.ParseQuery(string(c.Context().QueryArgs().QueryString()))
+	query.Del("page")
+	query.Set("cursor", cursor)
+	return c.BaseURL() + c.Path() + "?" + query.Encode()
+}
 
-	var uri string
-	if database.Username != "" && database.Password != "" {
-		uri = fmt.Sprintf("mongodb://%s:%s@%s:%d/%s",
-			database.Username, database.Password, database.Host, database.Port, database.Database)
-	} else {
-		uri = fmt.Sprintf("mongodb://%s:%d/%s", database.Host, database.Port, database.Database)
+// nullable returns nil for empty strings, so they are serialized as null
+func nullable(value string) interface{} {
+	if value == "" {
+		return nil
 	}
+	return value
+}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+// Handle PUT requests
+func (h *DynamicAPIHandlerOptimized) HandlePUT(c *fiber.Ctx) error {
+	conn, release, err := h.requestConnection(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection failed"})
-	}
-	defer client.Disconnect(ctx)
-
-	db := client.Database(database.Database)
-	coll := db.Collection(collection)
-
-	if id != "" {
-		objectID, err := primitive.ObjectIDFromHex(id)
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "Invalid ID format"})
-		}
-
-		result := make(bson.M)
-		err = coll.FindOne(ctx, bson.M{"_id": objectID}).Decode(&result)
-		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				return c.Status(404).JSON(fiber.Map{"error": "Document not found"})
-			}
-			return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
-		}
-
-		return c.JSON(&result)
-	} else {
-		page, _ := strconv.Atoi(c.Query("page", "1"))
-		limit, _ := strconv.Atoi(c.Query("limit", "10"))
-		skip := (page - 1) * limit
-
-		cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)))
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
-		}
-		defer cursor.Close(ctx)
-
-		results := make([]bson.M, 0)
-		if err = cursor.All(ctx, &results); err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to decode results"})
-		}
-
-		total, _ := coll.CountDocuments(ctx, bson.M{})
-
-		return c.JSON(fiber.Map{
-			"data":  &results,
-			"total": total,
-			"page":  page,
-			"limit": limit,
-		})
+		return h.connectionError(c, err)
 	}
-}
+	defer release()
 
-func (h *DynamicAPIHandlerOptimized) handleMongoPUTOptimized(c *fiber.Ctx, database *models.DatabaseConnection, collection, id string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	objectID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID format"})
-	}
+	collection := services.CanonicalCollection(ctx, conn, c.Params("collection"))
+	key := recordKey(c)
 
-	var uri string
-	if database.Username != "" && database.Password != "" {
-		uri = fmt.Sprintf("mongodb://%s:%s@%s:%d/%s",
-			database.Username, database.Password, database.Host, database.Port, database.Database)
-	} else {
-		uri = fmt.Sprintf("mongodb://%s:%d/%s", database.Host, database.Port, database.Database)
+	data := make(services.Document)
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
 	}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	access, err := keyAccess(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection failed"})
+		return h.connectionError(c, err)
 	}
-	defer client.Disconnect(ctx)
-
-	update := make(bson.M)
-	if err := c.BodyParser(&update); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	if err := access.checkCollection(collection, models.PermissionWrite); err != nil {
+		return accessError(c, err)
 	}
-
-	db := client.Database(database.Database)
-	coll := db.Collection(collection)
-
-	result, err := coll.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": &update})
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to update document"})
+	if err := access.checkColumns(collection, documentFields(data), models.PermissionWrite); err != nil {
+		return accessError(c, err)
+	}
+	if err := access.checkColumns(collection, keyColumns(ctx, conn, collection, key), models.PermissionRead); err != nil {
+		return accessError(c, err)
 	}
 
-	if result.MatchedCount == 0 {
-		return c.Status(404).JSON(fiber.Map{"error": "Document not found"})
+	if key.Scope, err = keyRowScope(c, collection); err != nil {
+		return rowFilterError(c)
+	}
+	if _, err := services.UpdateScoped(ctx, conn, collection, key, data); err != nil {
+		return recordError(c, err, "Failed to update record")
 	}
 
 	return c.JSON(fiber.Map{
-		"message": "Document updated successfully",
-		"data":    &update,
+		"message": "Record updated successfully",
+		"data":    &data,
 	})
 }
 
-func (h *DynamicAPIHandlerOptimized) handleMongoDELETEOptimized(c *fiber.Ctx, database *models.DatabaseConnection, collection, id string) error {
+// Handle DELETE requests
+func (h *DynamicAPIHandlerOptimized) HandleDELETE(c *fiber.Ctx) error {
+	conn, release, err := h.requestConnection(c)
+	if err != nil {
+		return h.connectionError(c, err)
+	}
+	defer release()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	objectID, err := primitive.ObjectIDFromHex(id)
+	collection := services.CanonicalCollection(ctx, conn, c.Params("collection"))
+	key := recordKey(c)
+
+	access, err := keyAccess(c)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID format"})
+		return h.connectionError(c, err)
 	}
-
-	var uri string
-	if database.Username != "" && database.Password != "" {
-		uri = fmt.Sprintf("mongodb://%s:%s@%s:%d/%s",
-			database.Username, database.Password, database.Host, database.Port, database.Database)
-	} else {
-		uri = fmt.Sprintf("mongodb://%s:%d/%s", database.Host, database.Port, database.Database)
+	// Deleting a record removes every column, all of them must be writable
+	if !access.grants.AllColumns(collection, models.PermissionWrite) {
+		return accessError(c, &grantError{collection: collection, access: models.PermissionWrite})
 	}
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Database connection failed"})
+	if err := access.checkColumns(collection, keyColumns(ctx, conn, collection, key), models.PermissionRead); err != nil {
+		return accessError(c, err)
 	}
-	defer client.Disconnect(ctx)
 
-	db := client.Database(database.Database)
-	coll := db.Collection(collection)
-
-	result, err := coll.DeleteOne(ctx, bson.M{"_id": objectID})
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete document"})
+	if key.Scope, err = keyRowScope(c, collection); err != nil {
+		return rowFilterError(c)
 	}
-
-	if result.DeletedCount == 0 {
-		return c.Status(404).JSON(fiber.Map{"error": "Document not found"})
+	if _, err := conn.Delete(ctx, collection, key); err != nil {
+		return recordError(c, err, "Failed to delete record")
 	}
 
 	return c.JSON(fiber.Map{
-		"message": "Document deleted successfully",
+		"message": "Record deleted successfully",
 	})
 }
 
 // Cleanup function untuk membersihkan connection pool
 func (h *DynamicAPIHandlerOptimized) Cleanup() {
-	for key, db := range h.dbConnPool {
-		if sqlDB, err := db.DB(); err == nil {
-			sqlDB.Close()
-		}
-		delete(h.dbConnPool, key)
-	}
+	h.connections.Close()
 }
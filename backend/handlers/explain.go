@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"db-manager-backend/models"
+	"db-manager-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ExplainRequest asks for the plan of a single SQL statement
+type ExplainRequest struct {
+	DatabaseID string `json:"database_id"`
+	Query      string `json:"query"`
+	Analyze    bool   `json:"analyze"`    // PostgreSQL only, runs the statement and rolls it back
+	TimeoutMs  int    `json:"timeout_ms"` // default 30s, at most 5 minutes
+}
+
+// ExplainQuery returns the normalized plan of a SQL statement. MongoDB plans are
+// returned by find and aggregate with "explain": true.
+func (h *DatabaseManagementHandler) ExplainQuery(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var req ExplainRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Query == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "query is required",
+		})
+	}
+	databaseID, err := uuid.Parse(req.DatabaseID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid database_id",
+		})
+	}
+
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
+	if err != nil {
+		return accessError(c, err)
+	}
+	if err := access.unrestricted(); err != nil {
+		return accessError(c, err)
+	}
+
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
+
+	console, ok := conn.(services.QueryConn)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "SQL queries are not supported for this database type",
+		})
+	}
+
+	plan, err := console.Explain(c.Context(), req.Query, services.ExplainOptions{
+		Analyze:  req.Analyze,
+		ReadOnly: !models.HasPermission(access.level, models.PermissionWrite),
+		Timeout:  time.Duration(req.TimeoutMs) * time.Millisecond,
+	})
+	if err != nil {
+		return explainError(c, err)
+	}
+	return c.JSON(plan)
+}
+
+// ExplainDocuments returns the plan of the query GetDocuments runs for the same
+// parameters, for page-based listings. ?analyze=true measures actual rows and
+// times on PostgreSQL; MongoDB plans are always executed.
+func (h *DatabaseManagementHandler) ExplainDocuments(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	query := documentQuery(c)
+	databaseID, err := uuid.Parse(query.DatabaseID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid database_id",
+		})
+	}
+	findOptions, page, err := documentOptions(query)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
+
+	explainer, ok := conn.(services.ExplainConn)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Query plans are not supported for this database type",
+		})
+	}
+
+	ctx := c.Context()
+	collection := services.CanonicalCollection(ctx, conn, c.Params("collection"))
+	if err := access.limitFind(ctx, conn, collection, &findOptions); err != nil {
+		var ungranted *grantError
+		if errors.As(err, &ungranted) {
+			return accessError(c, err)
+		}
+		return queryError(c, err)
+	}
+	if err := access.limitRows(collection, &findOptions); err != nil {
+		return accessError(c, err)
+	}
+	// Same order and offset as findDocuments
+	if keyset, ok := conn.(services.KeysetConn); ok {
+		if order, err := keyset.KeysetOrder(ctx, collection, findOptions); err == nil {
+			findOptions.Order = order
+		}
+	}
+	findOptions.Offset = (page - 1) * findOptions.Limit
+
+	plan, err := explainer.ExplainFind(ctx, collection, findOptions, services.ExplainOptions{
+		Analyze:  c.QueryBool("analyze"),
+		ReadOnly: true,
+	})
+	if err != nil {
+		return explainError(c, err)
+	}
+	return c.JSON(plan)
+}
+
+// explainError maps a failed EXPLAIN to an HTTP response
+func explainError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrUnsupported) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Query plans are not supported for this database type",
+		})
+	}
+	return queryError(c, err)
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"db-manager-backend/models"
+	"db-manager-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// NativeQueryRequest is a MongoDB find or aggregate request. Filter, Projection, Sort
+// and Pipeline are Extended JSON, e.g. {"_id": {"$oid": "..."}}.
+type NativeQueryRequest struct {
+	DatabaseID string          `json:"database_id"`
+	Filter     json.RawMessage `json:"filter"`
+	Projection json.RawMessage `json:"projection"`
+	Sort       json.RawMessage `json:"sort"`
+	Pipeline   json.RawMessage `json:"pipeline"`
+	Skip       int64           `json:"skip"`
+	Limit      int             `json:"limit"`      // default 1000, at most 10000
+	TimeoutMs  int             `json:"timeout_ms"` // default 30s, at most 5 minutes
+	Explain    bool            `json:"explain"`
+}
+
+// findQuery is how find queries are kept in the query history
+type findQuery struct {
+	Filter     json.RawMessage `json:"filter,omitempty"`
+	Projection json.RawMessage `json:"projection,omitempty"`
+	Sort       json.RawMessage `json:"sort,omitempty"`
+}
+
+// FindNative runs a find query with an Extended JSON filter, projection and sort
+func (h *DatabaseManagementHandler) FindNative(c *fiber.Ctx) error {
+	return h.nativeQuery(c, false)
+}
+
+// AggregateNative runs an aggregation pipeline. Users with read permission cannot
+// use $out or $merge.
+func (h *DatabaseManagementHandler) AggregateNative(c *fiber.Ctx) error {
+	return h.nativeQuery(c, true)
+}
+
+func (h *DatabaseManagementHandler) nativeQuery(c *fiber.Ctx, aggregate bool) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var req NativeQueryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	databaseID, err := uuid.Parse(req.DatabaseID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid database_id",
+		})
+	}
+
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
+	if err != nil {
+		return accessError(c, err)
+	}
+	if err := access.unrestricted(); err != nil {
+		return accessError(c, err)
+	}
+
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
+
+	native, ok := conn.(services.NativeQueryConn)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Find and aggregate queries are only supported for MongoDB",
+		})
+	}
+
+	query := services.NativeQuery{
+		Filter:     req.Filter,
+		Projection: req.Projection,
+		Sort:       req.Sort,
+		Pipeline:   req.Pipeline,
+		Skip:       req.Skip,
+		Limit:      req.Limit,
+		Timeout:    time.Duration(req.TimeoutMs) * time.Millisecond,
+		Explain:    req.Explain,
+		ReadOnly:   !models.HasPermission(access.level, models.PermissionWrite),
+	}
+	collection := c.Params("collection")
+
+	entry := models.QueryHistory{
+		UserID:     userID,
+		DatabaseID: databaseID,
+		Collection: collection,
+		ExecutedAt: time.Now(),
+	}
+
+	var result *services.NativeResult
+	if aggregate {
+		entry.Kind = models.QueryKindAggregate
+		entry.Query = string(req.Pipeline)
+		result, err = native.NativeAggregate(c.Context(), collection, query)
+	} else {
+		entry.Kind = models.QueryKindFind
+		text, _ := json.Marshal(findQuery{Filter: req.Filter, Projection: req.Projection, Sort: req.Sort})
+		entry.Query = string(text)
+		result, err = native.NativeFind(c.Context(), collection, query)
+	}
+
+	entry.DurationMs = time.Since(entry.ExecutedAt).Milliseconds()
+	if err != nil {
+		entry.Error = err.Error()
+		recordQuery(entry)
+		return queryError(c, err)
+	}
+	entry.Success = true
+	entry.RowCount = int64(len(result.Documents))
+	recordQuery(entry)
+
+	return c.JSON(result)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"log"
+	"net/mail"
+
+	"db-manager-backend/config"
+	"db-manager-backend/models"
+	"db-manager-backend/services"
+
+	"github.com/google/uuid"
+)
+
+// validEmail reports whether a value is a bare email address that can be used as a
+// recipient
+func validEmail(value string) bool {
+	address, err := mail.ParseAddress(value)
+	return err == nil && address.Address == value
+}
+
+// userEmail returns the email address of a user
+func userEmail(userID uuid.UUID) (string, error) {
+	var user models.User
+	if err := config.DB.Select("id", "email").Where("id = ?", userID).First(&user).Error; err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
+// databaseName returns the name of a saved connection, without loading its credentials
+func databaseName(databaseID uuid.UUID) (string, error) {
+	var connection models.DatabaseConnection
+	if err := config.DB.Select("id", "name").Where("id = ?", databaseID).First(&connection).Error; err != nil {
+		return "", err
+	}
+	return connection.Name, nil
+}
+
+// invitationEmail gathers the data of the emails about an invitation
+func invitationEmail(invitation *models.DatabaseInvitation, inviteeEmail string) (services.InvitationEmail, error) {
+	inviterEmail, err := userEmail(invitation.InviterID)
+	if err != nil {
+		return services.InvitationEmail{}, err
+	}
+	name, err := databaseName(invitation.DatabaseID)
+	if err != nil {
+		return services.InvitationEmail{}, err
+	}
+	return services.InvitationEmail{
+		InviterEmail:    inviterEmail,
+		InviteeEmail:    inviteeEmail,
+		DatabaseName:    name,
+		PermissionLevel: invitation.PermissionLevel,
+		ExpiresAt:       invitation.ExpiresAt,
+	}, nil
+}
+
+// accessEmail gathers the data of the emails about a change another user made to an
+// access
+func accessEmail(databaseID, byUserID uuid.UUID) (services.AccessEmail, error) {
+	byEmail, err := userEmail(byUserID)
+	if err != nil {
+		return services.AccessEmail{}, err
+	}
+	name, err := databaseName(databaseID)
+	if err != nil {
+		return services.AccessEmail{}, err
+	}
+	return services.AccessEmail{ByEmail: byEmail, DatabaseName: name}, nil
+}
+
+// invitationLink returns the page where an invitation is accepted
+func (h *SharingHandler) invitationLink(token string) string {
+	return h.baseURL + "/join/" + token
+}
+
+// notify queues an email about a change that is already saved. Failures are only
+// logged as the change itself succeeded.
+func (h *SharingHandler) notify(template, to string, data interface{}) {
+	if err := h.outbox.Send(template, to, data); err != nil {
+		log.Printf("Failed to queue %s email to %s: %v", template, to, err)
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"db-manager-backend/models"
+	"db-manager-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// QueryRequest runs a script of one or more SQL statements separated by semicolons
+type QueryRequest struct {
+	DatabaseID string `json:"database_id"`
+	Query      string `json:"query"`
+	QueryID    string `json:"query_id"`   // optional, lets DELETE /query/:queryId cancel the script
+	TimeoutMs  int    `json:"timeout_ms"` // default 30s, at most 5 minutes
+	MaxRows    int    `json:"max_rows"`   // rows kept per result set, default 1000, at most 10000
+	ReadOnly   bool   `json:"read_only"`  // always the case for users with read permission
+}
+
+// RunQuery executes an ad-hoc SQL script against a connection and returns one result
+// set per statement. Users with read permission run it in a read-only transaction.
+func (h *DatabaseManagementHandler) RunQuery(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var req QueryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Query == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "query is required",
+		})
+	}
+	databaseID, err := uuid.Parse(req.DatabaseID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid database_id",
+		})
+	}
+
+	connection, access, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
+	if err != nil {
+		return accessError(c, err)
+	}
+	if err := access.unrestricted(); err != nil {
+		return accessError(c, err)
+	}
+
+	conn, release, err := h.openConnection(connection)
+	if err != nil {
+		return connectionError(c, err)
+	}
+	defer release()
+
+	console, ok := conn.(services.QueryConn)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "SQL queries are not supported for this database type",
+		})
+	}
+
+	// The request context stops the query when the server shuts down
+	var ctx context.Context = c.Context()
+	if req.QueryID != "" {
+		var done func()
+		ctx, done, err = h.queries.Start(ctx, req.QueryID, userID.String())
+		if err != nil {
+			return c.Status(409).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		defer done()
+	}
+
+	started := time.Now()
+	result, err := console.Query(ctx, req.Query, services.QueryOptions{
+		Timeout:  time.Duration(req.TimeoutMs) * time.Millisecond,
+		MaxRows:  req.MaxRows,
+		ReadOnly: req.ReadOnly || !models.HasPermission(access.level, models.PermissionWrite),
+	})
+
+	entry := models.QueryHistory{
+		UserID:     userID,
+		DatabaseID: databaseID,
+		Kind:       models.QueryKindSQL,
+		Query:      req.Query,
+		ExecutedAt: started,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		recordQuery(entry)
+		return queryError(c, err)
+	}
+	entry.Success = true
+	entry.RowCount = sqlRowCount(result)
+	recordQuery(entry)
+
+	return c.JSON(result)
+}
+
+// CancelQuery cancels a running query started by the current user with a query_id
+func (h *DatabaseManagementHandler) CancelQuery(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if !h.queries.Cancel(c.Params("queryId"), userID.String()) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Query not found or already finished",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "Query cancelled",
+	})
+}
+
+// queryError maps a failed script to an HTTP response, naming the failing statement
+func queryError(c *fiber.Ctx, err error) error {
+	response := fiber.Map{"error": err.Error()}
+	var statementErr *services.StatementError
+	if errors.As(err, &statementErr) {
+		response["statement"] = statementErr.Index + 1
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		response["error"] = "Query timed out"
+		return c.Status(408).JSON(response)
+	case errors.Is(err, context.Canceled):
+		response["error"] = "Query was cancelled"
+		return c.Status(409).JSON(response)
+	default:
+		// Errors reported by the database are mistakes in the script
+		return c.Status(400).JSON(response)
+	}
+}
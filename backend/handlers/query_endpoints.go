@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"db-manager-backend/config"
+	"db-manager-backend/models"
+	"db-manager-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// queryEndpointPath is the path of a published query relative to /api, one to four
+// segments such as reports/top-customers
+var queryEndpointPath = regexp.MustCompile(`^[A-Za-z0-9_-]+(/[A-Za-z0-9_-]+){0,3}$`)
+
+// reservedAPIPaths are first path segments taken by the application's own routes
+var reservedAPIPaths = map[string]bool{
+	"auth": true, "database": true, "database-management": true, "api-management": true, "sharing": true,
+}
+
+// createQueryEndpoint publishes a saved query of the database at a path under /api
+func (h *APIHandler) createQueryEndpoint(c *fiber.Ctx, req *CreateEndpointRequest, dbConn *models.DatabaseConnection, userID string) error {
+	path := strings.Trim(req.Path, "/")
+	if !queryEndpointPath.MatchString(path) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "path must be one to four segments of letters, digits, _ and -",
+		})
+	}
+	if reservedAPIPaths[strings.ToLower(strings.SplitN(path, "/", 2)[0])] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "path is reserved",
+		})
+	}
+	method := strings.ToUpper(req.Method)
+	if method != fiber.MethodGet && method != fiber.MethodPost {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Published queries must use GET or POST",
+		})
+	}
+
+	var saved models.SavedQuery
+	if err := config.DB.Where("id = ? AND database_id = ? AND (user_id = ? OR shared = ?)",
+		req.SavedQueryID, dbConn.ID, userID, true).First(&saved).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Saved query not found",
+		})
+	}
+
+	endpoint := models.APIEndpoint{
+		DatabaseID:   dbConn.ID,
+		Kind:         models.EndpointKindQuery,
+		Collection:   saved.Collection,
+		Path:         "/api/" + path,
+		Method:       method,
+		SavedQueryID: &saved.ID,
+		IsActive:     true,
+	}
+
+	var existing int64
+	if err := config.DB.Model(&models.APIEndpoint{}).
+		Where("database_id = ? AND kind = ? AND path = ? AND method = ?", dbConn.ID, endpoint.Kind, endpoint.Path, method).
+		Count(&existing).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create endpoint",
+		})
+	}
+	if existing > 0 {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "A query is already published at this path",
+		})
+	}
+
+	if err := config.DB.Create(&endpoint).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create endpoint",
+		})
+	}
+	endpoint.SavedQuery = &saved
+	return c.JSON(endpoint)
+}
+
+// HandleQueryEndpoint runs the saved query of a published query endpoint with the
+// parameters of the request. Requests to collection endpoints are passed on.
+// GET endpoints run read-only.
+func (h *DynamicAPIHandlerOptimized) HandleQueryEndpoint(c *fiber.Ctx) error {
+	endpoint, ok := c.Locals("endpoint").(*models.APIEndpoint)
+	if !ok || endpoint.Kind != models.EndpointKindQuery {
+		return c.Next()
+	}
+	// Saved queries cannot be confined to the collections and rows of a key
+	access, err := keyAccess(c)
+	if err != nil {
+		return h.connectionError(c, err)
+	}
+	if key, ok := c.Locals("apiKey").(*models.APIKey); access.restricted() || ok && len(key.RowFilters) > 0 {
+		return c.Status(403).JSON(fiber.Map{"error": "Published queries are not available to API keys limited to some collections or rows"})
+	}
+
+	var saved models.SavedQuery
+	if endpoint.SavedQueryID == nil || config.DB.Where("id = ? AND database_id = ?",
+		*endpoint.SavedQueryID, endpoint.DatabaseID).First(&saved).Error != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Published query not found"})
+	}
+
+	values, err := requestParameters(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	params, err := services.BindParameters(saved.Parameters, values)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	conn, release, err := h.requestConnection(c)
+	if err != nil {
+		return h.connectionError(c, err)
+	}
+	defer release()
+
+	readOnly := c.Method() == fiber.MethodGet
+	ctx := c.Context()
+
+	switch saved.Kind {
+	case models.QueryKindSQL:
+		console, ok := conn.(services.QueryConn)
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "SQL queries are not supported for this database type"})
+		}
+		result, err := console.Query(ctx, saved.Query, services.QueryOptions{ReadOnly: readOnly, Params: params})
+		if err != nil {
+			return queryError(c, err)
+		}
+
+		// The last statement gives the response
+		set := result.ResultSets[len(result.ResultSets)-1]
+		response := fiber.Map{
+			"data":      resultObjects(set),
+			"truncated": set.Truncated,
+		}
+		if set.RowsAffected != nil {
+			response["rows_affected"] = *set.RowsAffected
+		}
+		return c.JSON(response)
+
+	case models.QueryKindAggregate:
+		native, ok := conn.(services.NativeQueryConn)
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "Aggregation pipelines are only supported for MongoDB"})
+		}
+		result, err := native.NativeAggregate(ctx, saved.Collection, services.NativeQuery{
+			Pipeline: json.RawMessage(saved.Query),
+			ReadOnly: readOnly,
+			Params:   params,
+		})
+		if err != nil {
+			return queryError(c, err)
+		}
+		return c.JSON(fiber.Map{
+			"data":      result.Documents,
+			"truncated": result.Truncated,
+		})
+
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": "Unknown query kind"})
+	}
+}
+
+// requestParameters collects the parameters of a request to a published query: the
+// query string, overridden by the fields of a JSON object body
+func requestParameters(c *fiber.Ctx) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	c.Context().QueryArgs().VisitAll(func(name, value []byte) {
+		values[string(name)] = string(value)
+	})
+
+	if len(c.Body()) > 0 && c.Method() != fiber.MethodGet {
+		var body map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return nil, fmt.Errorf("request body must be a JSON object")
+		}
+		for name, value := range body {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+// resultObjects converts the rows of a result set to objects keyed by column name
+func resultObjects(set services.ResultSet) []map[string]interface{} {
+	objects := make([]map[string]interface{}, len(set.Rows))
+	for i, row := range set.Rows {
+		object := make(map[string]interface{}, len(set.Columns))
+		for j, column := range set.Columns {
+			object[column.Name] = row[j]
+		}
+		objects[i] = object
+	}
+	return objects
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"db-manager-backend/config"
+	"db-manager-backend/models"
+	"db-manager-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// rowVariables are the values of the ${name} references in row filters
+func rowVariables(userID uuid.UUID, email string) map[string]string {
+	return map[string]string{
+		"user.id":    userID.String(),
+		"user.email": email,
+	}
+}
+
+// userRowVariables loads the row filter variables of a user
+func userRowVariables(userID uuid.UUID) (map[string]string, error) {
+	var user models.User
+	if err := config.DB.Select("id", "email").Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return rowVariables(user.ID, user.Email), nil
+}
+
+// parseRowScope returns the filter limiting the rows of a collection, nil when they
+// are not limited
+func parseRowScope(filters models.RowFilters, collection string, variables map[string]string) (*services.FilterGroup, error) {
+	filter := filters.For(collection)
+	if len(filter) == 0 || string(filter) == "null" {
+		return nil, nil
+	}
+	return services.ParseRowFilter(filter, variables)
+}
+
+// validateRowFilters checks that every row filter parses, only references known
+// variables and is keyed by a distinct collection name
+func validateRowFilters(filters models.RowFilters) error {
+	variables := rowVariables(uuid.Nil, "")
+	spellings := make(map[string]string, len(filters))
+	for collection, filter := range filters {
+		if strings.TrimSpace(collection) == "" {
+			return fmt.Errorf("row filters must be keyed by a collection or *")
+		}
+		// Keys only differing in case would both match the same SQL table
+		if other, ok := spellings[strings.ToLower(collection)]; ok {
+			return fmt.Errorf("row filters of %s and %s only differ in case", other, collection)
+		}
+		spellings[strings.ToLower(collection)] = collection
+		if _, err := services.ParseRowFilter(filter, variables); err != nil {
+			return fmt.Errorf("row filter of %s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// keyRowScope returns the filter limiting the rows of a collection for the API key
+// of a request, nil when they are not limited. Keys are limited by their own row
+// filters and by those of their creator.
+func keyRowScope(c *fiber.Ctx, collection string) (*services.FilterGroup, error) {
+	var creator *services.FilterGroup
+	if access, ok := c.Locals("keyAccess").(*databaseAccess); ok {
+		scope, err := access.rowScope(collection)
+		if err != nil {
+			return nil, err
+		}
+		creator = scope
+	}
+
+	key, ok := c.Locals("apiKey").(*models.APIKey)
+	if !ok || len(key.RowFilters) == 0 {
+		return creator, nil
+	}
+	scope, err := parseRowScope(key.RowFilters, collection, rowVariables(key.UserID, key.User.Email))
+	if err != nil {
+		return nil, err
+	}
+	return services.AndFilters(creator, scope), nil
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"db-manager-backend/config"
+	"db-manager-backend/models"
+	"db-manager-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// queryHistoryLimit is the number of executed queries kept per user
+const queryHistoryLimit = 500
+
+var parameterNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SavedQueryRequest creates or replaces a saved query. SQL queries use Query, MongoDB
+// queries use Collection and Pipeline.
+type SavedQueryRequest struct {
+	DatabaseID  string                  `json:"database_id"`
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Kind        string                  `json:"kind"` // sql (default) or aggregate
+	Query       string                  `json:"query"`
+	Collection  string                  `json:"collection"`
+	Pipeline    json.RawMessage         `json:"pipeline"` // Extended JSON array of stages
+	Parameters  []models.QueryParameter `json:"parameters"`
+	Shared      bool                    `json:"shared"`
+}
+
+// visibleQueries selects the saved queries of a user and the queries shared on
+// databases the user owns or was given access to
+func visibleQueries(userID uuid.UUID) *gorm.DB {
+	return config.DB.
+		Scopes(accessibleDatabases("database_id", userID, models.PermissionRead)).
+		Where("user_id = ? OR shared = ?", userID, true)
+}
+
+// applySavedQuery validates a request against its connection and copies it to query
+func applySavedQuery(query *models.SavedQuery, req *SavedQueryRequest, connection *models.DatabaseConnection) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.Kind == "" {
+		req.Kind = models.QueryKindSQL
+	}
+
+	text := ""
+	switch req.Kind {
+	case models.QueryKindSQL:
+		if connection.Type == "mongodb" || connection.Type == "redis" {
+			return fmt.Errorf("SQL queries are not supported for this database type")
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			return fmt.Errorf("query is required")
+		}
+		text = req.Query
+		req.Collection = ""
+	case models.QueryKindAggregate:
+		if connection.Type != "mongodb" {
+			return fmt.Errorf("Aggregation pipelines are only supported for MongoDB")
+		}
+		if req.Collection == "" {
+			return fmt.Errorf("collection is required")
+		}
+		pipeline := bytes.TrimSpace(req.Pipeline)
+		if len(pipeline) == 0 || pipeline[0] != '[' || !json.Valid(pipeline) {
+			return fmt.Errorf("pipeline must be an array of stages")
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, pipeline); err != nil {
+			return fmt.Errorf("pipeline must be an array of stages")
+		}
+		text = compact.String()
+	default:
+		return fmt.Errorf("kind must be sql or aggregate")
+	}
+
+	seen := make(map[string]bool, len(req.Parameters))
+	for _, parameter := range req.Parameters {
+		if !parameterNamePattern.MatchString(parameter.Name) {
+			return fmt.Errorf("invalid parameter name %q", parameter.Name)
+		}
+		if seen[parameter.Name] {
+			return fmt.Errorf("duplicate parameter %q", parameter.Name)
+		}
+		seen[parameter.Name] = true
+		switch parameter.Type {
+		case models.ParameterTypeString, models.ParameterTypeInteger, models.ParameterTypeNumber,
+			models.ParameterTypeBoolean, models.ParameterTypeDate:
+		default:
+			return fmt.Errorf("parameter %q has unknown type %q", parameter.Name, parameter.Type)
+		}
+		if parameter.Default != nil {
+			if _, err := services.ParameterValue(parameter, parameter.Default); err != nil {
+				return fmt.Errorf("default of parameter %q must be of type %s", parameter.Name, parameter.Type)
+			}
+		}
+	}
+
+	query.DatabaseID = connection.ID
+	query.Name = req.Name
+	query.Description = req.Description
+	query.Kind = req.Kind
+	query.Collection = req.Collection
+	query.Query = text
+	query.Parameters = models.QueryParameters(req.Parameters)
+	query.Shared = req.Shared
+	return nil
+}
+
+// ListSavedQueries returns the user's saved queries and the queries shared with the
+// user, optionally for one database
+func (h *DatabaseManagementHandler) ListSavedQueries(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	query := visibleQueries(userID).Preload("User")
+	if databaseID := c.Query("database_id"); databaseID != "" {
+		parsed, err := uuid.Parse(databaseID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid database_id",
+			})
+		}
+		query = query.Where("database_id = ?", parsed)
+	}
+
+	var queries []models.SavedQuery
+	if err := query.Order("name").Find(&queries).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch saved queries",
+		})
+	}
+	return c.JSON(queries)
+}
+
+// CreateSavedQuery saves a query on a database the user can access
+func (h *DatabaseManagementHandler) CreateSavedQuery(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var req SavedQueryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	databaseID, err := uuid.Parse(req.DatabaseID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid database_id",
+		})
+	}
+	connection, _, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	saved := models.SavedQuery{UserID: userID}
+	if err := applySavedQuery(&saved, &req, connection); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := config.DB.Create(&saved).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to save query",
+		})
+	}
+	return c.Status(201).JSON(saved)
+}
+
+// GetSavedQuery returns a saved query owned by or shared with the user
+func (h *DatabaseManagementHandler) GetSavedQuery(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var saved models.SavedQuery
+	if err := visibleQueries(userID).Preload("User").
+		Where("id = ?", c.Params("id")).First(&saved).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Saved query not found",
+		})
+	}
+	return c.JSON(saved)
+}
+
+// UpdateSavedQuery replaces a saved query. Only its owner can change it, and only
+// while being an admin of its database once it is published.
+func (h *DatabaseManagementHandler) UpdateSavedQuery(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var saved models.SavedQuery
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&saved).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Saved query not found",
+		})
+	}
+
+	// Published queries run with the role of the API keys calling them, POST ones
+	// with write access, so editing one is as powerful as publishing it
+	var published int64
+	if err := config.DB.Model(&models.APIEndpoint{}).Where("saved_query_id = ?", saved.ID).
+		Count(&published).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update saved query",
+		})
+	}
+	if published > 0 {
+		if _, err := authorize(saved.DatabaseID, userID, models.PermissionAdmin); err != nil {
+			return accessError(c, err)
+		}
+	}
+
+	req := SavedQueryRequest{DatabaseID: saved.DatabaseID.String()}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	databaseID, err := uuid.Parse(req.DatabaseID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid database_id",
+		})
+	}
+	connection, _, err := h.getDatabaseConnection(databaseID, userID, models.PermissionRead)
+	if err != nil {
+		return accessError(c, err)
+	}
+
+	if err := applySavedQuery(&saved, &req, connection); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := config.DB.Save(&saved).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update saved query",
+		})
+	}
+	return c.JSON(saved)
+}
+
+// DeleteSavedQuery deletes a saved query owned by the user
+func (h *DatabaseManagementHandler) DeleteSavedQuery(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	result := config.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).Delete(&models.SavedQuery{})
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to delete saved query",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Saved query not found",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "Saved query deleted successfully",
+	})
+}
+
+// GetQueryHistory returns the queries run by the user, newest first
+func (h *DatabaseManagementHandler) GetQueryHistory(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > queryHistoryLimit {
+		limit = 100
+	}
+
+	query := config.DB.Where("user_id = ?", userID)
+	if databaseID := c.Query("database_id"); databaseID != "" {
+		parsed, err := uuid.Parse(databaseID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid database_id",
+			})
+		}
+		query = query.Where("database_id = ?", parsed)
+	}
+
+	var history []models.QueryHistory
+	if err := query.Order("executed_at DESC").Limit(limit).Find(&history).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch query history",
+		})
+	}
+	return c.JSON(history)
+}
+
+// ClearQueryHistory deletes the user's query history, optionally for one database
+func (h *DatabaseManagementHandler) ClearQueryHistory(c *fiber.Ctx) error {
+	userID, err := h.getUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	query := config.DB.Where("user_id = ?", userID)
+	if databaseID := c.Query("database_id"); databaseID != "" {
+		parsed, err := uuid.Parse(databaseID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Invalid database_id",
+			})
+		}
+		query = query.Where("database_id = ?", parsed)
+	}
+
+	if err := query.Delete(&models.QueryHistory{}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to clear query history",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "Query history cleared successfully",
+	})
+}
+
+// recordQuery adds an executed query to the history of its user and drops the
+// entries beyond queryHistoryLimit. Failures are logged, never returned.
+func recordQuery(entry models.QueryHistory) {
+	if err := config.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record query history: %v", err)
+		return
+	}
+
+	var cutoff []time.Time
+	if err := config.DB.Model(&models.QueryHistory{}).Where("user_id = ?", entry.UserID).
+		Order("executed_at DESC").Offset(queryHistoryLimit).Limit(1).
+		Pluck("executed_at", &cutoff).Error; err != nil || len(cutoff) == 0 {
+		return
+	}
+	if err := config.DB.Where("user_id = ? AND executed_at <= ?", entry.UserID, cutoff[0]).
+		Delete(&models.QueryHistory{}).Error; err != nil {
+		log.Printf("Failed to trim query history: %v", err)
+	}
+}
+
+// sqlRowCount counts the rows returned and affected by a script
+func sqlRowCount(result *services.QueryResult) int64 {
+	var count int64
+	for _, set := range result.ResultSets {
+		count += int64(len(set.Rows))
+		if set.RowsAffected != nil {
+			count += *set.RowsAffected
+		}
+	}
+	return count
+}
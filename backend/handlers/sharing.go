@@ -4,27 +4,37 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"log"
+	"strings"
 	"time"
 
 	"db-manager-backend/config"
 	"db-manager-backend/models"
+	"db-manager-backend/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
-type SharingHandler struct{}
+type SharingHandler struct {
+	outbox  *services.Outbox
+	baseURL string // public URL of the frontend, used in links sent by email
+}
 
-func NewSharingHandler() *SharingHandler {
-	return &SharingHandler{}
+func NewSharingHandler(outbox *services.Outbox, baseURL string) *SharingHandler {
+	return &SharingHandler{
+		outbox:  outbox,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
 }
 
 // CreateInvitation creates a new database invitation
 func (h *SharingHandler) CreateInvitation(c *fiber.Ctx) error {
 	type InvitationRequest struct {
-		DatabaseID      string `json:"database_id" validate:"required"`
-		InviteeEmail    string `json:"invitee_email" validate:"required,email"`
-		PermissionLevel string `json:"permission_level" validate:"required,oneof=read write admin"`
+		DatabaseID      string              `json:"database_id" validate:"required"`
+		InviteeEmail    string              `json:"invitee_email" validate:"required,email"`
+		PermissionLevel string              `json:"permission_level" validate:"required,oneof=read write admin"`
+		Grants          models.AccessGrants `json:"grants"`      // optional, limits the access to some collections
+		RowFilters      models.RowFilters   `json:"row_filters"` // optional, limits the access to some rows
 	}
 
 	var req InvitationRequest
@@ -51,11 +61,37 @@ func (h *SharingHandler) CreateInvitation(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user owns the database
-	var database models.DatabaseConnection
-	if err := config.DB.Where("id = ? AND user_id = ?", databaseID, userID).First(&database).Error; err != nil {
+	if !validEmail(req.InviteeEmail) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invitee_email must be an email address",
+		})
+	}
+	switch req.PermissionLevel {
+	case models.PermissionRead, models.PermissionWrite, models.PermissionAdmin:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "permission_level must be read, write or admin",
+		})
+	}
+	if err := req.Grants.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := validateRowFilters(req.RowFilters); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Owners and admins manage who can access the database, only owners make admins
+	manager, err := authorizeAdmin(databaseID, userID)
+	if err != nil {
+		return accessError(c, err)
+	}
+	if req.PermissionLevel == models.PermissionAdmin && manager.level != models.PermissionOwner {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Database not found or access denied",
+			"error": "Only the owner can give admin access",
 		})
 	}
 
@@ -84,20 +120,47 @@ func (h *SharingHandler) CreateInvitation(c *fiber.Ctx) error {
 		InviteeEmail:    req.InviteeEmail,
 		InvitationToken: invitationToken,
 		PermissionLevel: req.PermissionLevel,
+		Grants:          req.Grants,
+		RowFilters:      req.RowFilters,
 		Status:          "pending",
 		ExpiresAt:       time.Now().Add(7 * 24 * time.Hour), // 7 days
 	}
 
-	if err := config.DB.Create(&invitation).Error; err != nil {
+	email, err := invitationEmail(&invitation, invitation.InviteeEmail)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to prepare invitation email",
+		})
+	}
+	email.Link = h.invitationLink(invitationToken)
+
+	// The email is queued with the invitation, the outbox delivers it even if the
+	// mail server is down right now
+	tx := config.DB.Begin()
+	if err := tx.Create(&invitation).Error; err != nil {
+		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create invitation",
 		})
 	}
+	if err := h.outbox.Enqueue(tx, services.EmailInvitation, invitation.InviteeEmail, email); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to queue invitation email: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to queue invitation email",
+		})
+	}
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invitation",
+		})
+	}
+	h.outbox.Notify()
 
 	return c.JSON(fiber.Map{
 		"message":         "Invitation sent successfully",
 		"invitation":      invitation,
-		"invitation_link": "http://localhost:5173/join/" + invitationToken,
+		"invitation_link": h.invitationLink(invitationToken),
 	})
 }
 
@@ -120,12 +183,9 @@ func (h *SharingHandler) GetDatabaseInvitations(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user owns the database
-	var database models.DatabaseConnection
-	if err := config.DB.Where("id = ? AND user_id = ?", databaseID, userID).First(&database).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Database not found or access denied",
-		})
+	// Owners and admins manage who can access the database
+	if _, err := authorizeAdmin(databaseID, userID); err != nil {
+		return accessError(c, err)
 	}
 
 	var invitations []models.DatabaseInvitation
@@ -189,6 +249,8 @@ func (h *SharingHandler) AcceptInvitation(c *fiber.Ctx) error {
 		DatabaseID:      invitation.DatabaseID,
 		UserID:          userID,
 		PermissionLevel: invitation.PermissionLevel,
+		Grants:          invitation.Grants,
+		RowFilters:      invitation.RowFilters,
 		GrantedBy:       invitation.InviterID,
 	}
 
@@ -210,6 +272,19 @@ func (h *SharingHandler) AcceptInvitation(c *fiber.Ctx) error {
 		})
 	}
 
+	// Let the inviter know, under the address the invitee signed up with
+	inviteeEmail, err := userEmail(userID)
+	if err == nil {
+		var email services.InvitationEmail
+		if email, err = invitationEmail(&invitation, inviteeEmail); err == nil {
+			email.Link = h.baseURL + "/database-management"
+			h.notify(services.EmailInvitationAccepted, email.InviterEmail, email)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to prepare invitation accepted email: %v", err)
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Invitation accepted successfully",
 		"access":  access,
@@ -288,12 +363,9 @@ func (h *SharingHandler) GetDatabaseAccess(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user owns the database
-	var database models.DatabaseConnection
-	if err := config.DB.Where("id = ? AND user_id = ?", databaseID, userID).First(&database).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Database not found or access denied",
-		})
+	// Owners and admins manage who can access the database
+	if _, err := authorizeAdmin(databaseID, userID); err != nil {
+		return accessError(c, err)
 	}
 
 	var accesses []models.DatabaseAccess
@@ -344,11 +416,20 @@ func (h *SharingHandler) RevokeAccess(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if current user owns the database
-	var database models.DatabaseConnection
-	if err := config.DB.Where("id = ? AND user_id = ?", databaseID, currentUserID).First(&database).Error; err != nil {
+	// Owners revoke anyone, admins only users with a lower permission level
+	manager, err := authorizeAdmin(databaseID, currentUserID)
+	if err != nil {
+		return accessError(c, err)
+	}
+	var access models.DatabaseAccess
+	if err := config.DB.Where("database_id = ? AND user_id = ?", databaseID, targetUserID).First(&access).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Access not found",
+		})
+	}
+	if manager.level != models.PermissionOwner && models.HasPermission(access.PermissionLevel, manager.level) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Database not found or access denied",
+			"error": "Only the owner can revoke access of an admin",
 		})
 	}
 
@@ -360,11 +441,195 @@ func (h *SharingHandler) RevokeAccess(c *fiber.Ctx) error {
 		})
 	}
 
+	// Tell the user they lost access
+	revokedEmail, err := userEmail(targetUserID)
+	if err == nil {
+		var email services.AccessEmail
+		if email, err = accessEmail(databaseID, currentUserID); err == nil {
+			h.notify(services.EmailAccessRevoked, revokedEmail, email)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to prepare access revoked email: %v", err)
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Access revoked successfully",
 	})
 }
 
+// UpdateAccessGrants replaces the grants limiting a user's access to a database, an
+// empty list gives access to the whole database again
+func (h *SharingHandler) UpdateAccessGrants(c *fiber.Ctx) error {
+	type GrantsRequest struct {
+		DatabaseID string              `json:"database_id" validate:"required"`
+		UserID     string              `json:"user_id" validate:"required"`
+		Grants     models.AccessGrants `json:"grants"`
+	}
+
+	var req GrantsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := req.Grants.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return h.updateAccess(c, req.DatabaseID, req.UserID, map[string]interface{}{"grants": req.Grants})
+}
+
+// UpdateAccessRowFilters replaces the row filters limiting a user's access to a
+// database, an empty object gives access to every row again
+func (h *SharingHandler) UpdateAccessRowFilters(c *fiber.Ctx) error {
+	type RowFiltersRequest struct {
+		DatabaseID string            `json:"database_id" validate:"required"`
+		UserID     string            `json:"user_id" validate:"required"`
+		RowFilters models.RowFilters `json:"row_filters"`
+	}
+
+	var req RowFiltersRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := validateRowFilters(req.RowFilters); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return h.updateAccess(c, req.DatabaseID, req.UserID, map[string]interface{}{"row_filters": req.RowFilters})
+}
+
+// UpdateAccess changes the permission level, grants or row filters of a user's access
+// to a database, leaving the fields absent from the body unchanged
+func (h *SharingHandler) UpdateAccess(c *fiber.Ctx) error {
+	type AccessRequest struct {
+		DatabaseID      string               `json:"database_id" validate:"required"`
+		UserID          string               `json:"user_id" validate:"required"`
+		PermissionLevel *string              `json:"permission_level"`
+		Grants          *models.AccessGrants `json:"grants"`
+		RowFilters      *models.RowFilters   `json:"row_filters"`
+	}
+
+	var req AccessRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	updates := make(map[string]interface{})
+	if req.PermissionLevel != nil {
+		switch *req.PermissionLevel {
+		case models.PermissionRead, models.PermissionWrite, models.PermissionAdmin:
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "permission_level must be read, write or admin",
+			})
+		}
+		updates["permission_level"] = *req.PermissionLevel
+	}
+	if req.Grants != nil {
+		if err := req.Grants.Validate(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		updates["grants"] = *req.Grants
+	}
+	if req.RowFilters != nil {
+		if err := validateRowFilters(*req.RowFilters); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		updates["row_filters"] = *req.RowFilters
+	}
+	if len(updates) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "permission_level, grants or row_filters is required",
+		})
+	}
+
+	return h.updateAccess(c, req.DatabaseID, req.UserID, updates)
+}
+
+// updateAccess changes columns of a user's access to a database. Same rule as
+// revoking: admins only change the access of users with a lower permission level,
+// and cannot give a level as high as their own.
+func (h *SharingHandler) updateAccess(c *fiber.Ctx, databaseIDStr, targetUserIDStr string, updates map[string]interface{}) error {
+	currentUserID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	databaseID, err := uuid.Parse(databaseIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid database ID",
+		})
+	}
+
+	targetUserID, err := uuid.Parse(targetUserIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	manager, err := authorizeAdmin(databaseID, currentUserID)
+	if err != nil {
+		return accessError(c, err)
+	}
+	var access models.DatabaseAccess
+	result := config.DB.Where("database_id = ? AND user_id = ?", databaseID, targetUserID).Limit(1).Find(&access)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load access",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Access not found",
+		})
+	}
+	if manager.level != models.PermissionOwner && models.HasPermission(access.PermissionLevel, manager.level) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the owner can change the access of an admin",
+		})
+	}
+	if level, ok := updates["permission_level"].(string); ok &&
+		manager.level != models.PermissionOwner && models.HasPermission(level, manager.level) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the owner can give admin access",
+		})
+	}
+
+	if err := config.DB.Model(&access).Updates(updates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update access",
+		})
+	}
+	if err := config.DB.Where("id = ?", access.ID).First(&access).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load access",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Access updated successfully",
+		"access":  access,
+	})
+}
+
 // RevokeInvitation revokes a pending invitation
 func (h *SharingHandler) RevokeInvitation(c *fiber.Ctx) error {
 	invitationIDStr := c.Params("invitationId")
@@ -386,13 +651,14 @@ func (h *SharingHandler) RevokeInvitation(c *fiber.Ctx) error {
 
 	// Check if user has permission to revoke
 	var invitation models.DatabaseInvitation
-	if err := config.DB.Joins("JOIN database_connections ON database_invitations.database_id = database_connections.id").
-		Where("database_invitations.id = ? AND database_connections.user_id = ?", 
-		invitationID, userID).First(&invitation).Error; err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Invitation not found or access denied",
+	if err := config.DB.Where("id = ?", invitationID).First(&invitation).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invitation not found",
 		})
 	}
+	if _, err := authorizeAdmin(invitation.DatabaseID, userID); err != nil {
+		return accessError(c, err)
+	}
 
 	if err := config.DB.Delete(&invitation).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -400,6 +666,16 @@ func (h *SharingHandler) RevokeInvitation(c *fiber.Ctx) error {
 		})
 	}
 
+	// Only an invitation that could still be accepted is worth a notice
+	if invitation.Status == "pending" && invitation.ExpiresAt.After(time.Now()) {
+		email, err := invitationEmail(&invitation, invitation.InviteeEmail)
+		if err != nil {
+			log.Printf("Failed to prepare invitation revoked email: %v", err)
+		} else {
+			h.notify(services.EmailInvitationRevoked, invitation.InviteeEmail, email)
+		}
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Invitation revoked successfully",
 	})
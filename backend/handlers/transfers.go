@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"db-manager-backend/config"
+	"db-manager-backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// transferTTL is how long an ownership transfer can be accepted
+const transferTTL = 7 * 24 * time.Hour
+
+// errTransferStale is returned when a transfer no longer applies: the sender is not
+// the owner anymore or the recipient lost their access
+var errTransferStale = errors.New("transfer no longer applies")
+
+// CreateTransfer offers the ownership of a database to a user it is shared with
+func (h *SharingHandler) CreateTransfer(c *fiber.Ctx) error {
+	type TransferRequest struct {
+		DatabaseID string `json:"database_id" validate:"required"`
+		UserID     string `json:"user_id" validate:"required"`
+	}
+
+	var req TransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	databaseID, err := uuid.Parse(req.DatabaseID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid database ID",
+		})
+	}
+
+	targetUserID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if _, err := authorize(databaseID, userID, models.PermissionOwner); err != nil {
+		return accessError(c, err)
+	}
+
+	// Ownership only goes to someone who already works on the database
+	var shared int64
+	if err := config.DB.Model(&models.DatabaseAccess{}).
+		Where("database_id = ? AND user_id = ?", databaseID, targetUserID).Count(&shared).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check access",
+		})
+	}
+	if shared == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The database must be shared with the new owner first",
+		})
+	}
+
+	var pending int64
+	if err := config.DB.Model(&models.OwnershipTransfer{}).
+		Where("database_id = ? AND status = ? AND expires_at > ?", databaseID, "pending", time.Now()).
+		Count(&pending).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check pending transfers",
+		})
+	}
+	if pending > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A transfer of this database is already pending",
+		})
+	}
+
+	transfer := models.OwnershipTransfer{
+		DatabaseID: databaseID,
+		FromUserID: userID,
+		ToUserID:   targetUserID,
+		Status:     "pending",
+		ExpiresAt:  time.Now().Add(transferTTL),
+	}
+	if err := config.DB.Create(&transfer).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create transfer",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "Ownership transfer offered successfully",
+		"transfer": transfer,
+	})
+}
+
+// GetTransfers lists the pending ownership transfers sent or received by the user
+func (h *SharingHandler) GetTransfers(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var transfers []models.OwnershipTransfer
+	if err := config.DB.Preload("Database").Preload("FromUser").Preload("ToUser").
+		Where("(from_user_id = ? OR to_user_id = ?) AND status = ? AND expires_at > ?",
+			userID, userID, "pending", time.Now()).
+		Order("created_at DESC").Find(&transfers).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch transfers",
+		})
+	}
+
+	return c.JSON(transfers)
+}
+
+// AcceptTransfer makes the recipient of a pending transfer the owner of the database.
+// The previous owner keeps admin access and their API keys move to the new owner.
+func (h *SharingHandler) AcceptTransfer(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	transfer, err := pendingTransfer(c.Params("id"), "to_user_id", userID)
+	if err != nil {
+		return transferError(c, err)
+	}
+
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// UpdateColumns skips BeforeSave, which encrypts the secrets of a loaded connection
+		moved := tx.Model(&models.DatabaseConnection{}).
+			Where("id = ? AND user_id = ?", transfer.DatabaseID, transfer.FromUserID).
+			UpdateColumns(map[string]interface{}{"user_id": transfer.ToUserID, "updated_at": now})
+		if moved.Error != nil {
+			return moved.Error
+		}
+		if moved.RowsAffected == 0 {
+			return errTransferStale
+		}
+
+		// The new owner no longer needs shared access, the previous one gets it
+		removed := tx.Where("database_id = ? AND user_id = ?", transfer.DatabaseID, transfer.ToUserID).
+			Delete(&models.DatabaseAccess{})
+		if removed.Error != nil {
+			return removed.Error
+		}
+		if removed.RowsAffected == 0 {
+			return errTransferStale
+		}
+		if err := tx.Create(&models.DatabaseAccess{
+			DatabaseID:      transfer.DatabaseID,
+			UserID:          transfer.FromUserID,
+			PermissionLevel: models.PermissionAdmin,
+			GrantedBy:       transfer.ToUserID,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.APIKey{}).
+			Where("database_id = ? AND user_id = ?", transfer.DatabaseID, transfer.FromUserID).
+			Update("user_id", transfer.ToUserID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(transfer).Updates(map[string]interface{}{
+			"status":      "accepted",
+			"accepted_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ConnectionAudit{
+			DatabaseID: transfer.DatabaseID,
+			UserID:     userID,
+			Action:     "transfer",
+			Changes: models.JSONMap{
+				"owner": fiber.Map{"from": transfer.FromUserID, "to": transfer.ToUserID},
+			},
+		}).Error
+	})
+	if err != nil {
+		return transferError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":     "You are now the owner of this database",
+		"database_id": transfer.DatabaseID,
+	})
+}
+
+// DeclineTransfer lets the recipient refuse a pending transfer
+func (h *SharingHandler) DeclineTransfer(c *fiber.Ctx) error {
+	return h.closeTransfer(c, "to_user_id", "declined")
+}
+
+// CancelTransfer lets the sender withdraw a pending transfer
+func (h *SharingHandler) CancelTransfer(c *fiber.Ctx) error {
+	return h.closeTransfer(c, "from_user_id", "cancelled")
+}
+
+// closeTransfer ends a pending transfer of the current user, who is its sender or
+// recipient depending on column
+func (h *SharingHandler) closeTransfer(c *fiber.Ctx, column, status string) error {
+	userID, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	transfer, err := pendingTransfer(c.Params("id"), column, userID)
+	if err != nil {
+		return transferError(c, err)
+	}
+	if err := config.DB.Model(transfer).Update("status", status).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update transfer",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Transfer " + status,
+	})
+}
+
+// pendingTransfer loads a pending, unexpired transfer in which the user is the sender
+// or recipient depending on column
+func pendingTransfer(transferID, column string, userID uuid.UUID) (*models.OwnershipTransfer, error) {
+	id, err := uuid.Parse(transferID)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	// Transfers of deleted connections are not found either
+	existing := config.DB.Model(&models.DatabaseConnection{}).Select("id")
+	var transfer models.OwnershipTransfer
+	result := config.DB.Where("id = ? AND "+column+" = ? AND status = ? AND expires_at > ? AND database_id IN (?)",
+		id, userID, "pending", time.Now(), existing).Limit(1).Find(&transfer)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &transfer, nil
+}
+
+// transferError maps a failure to load or complete a transfer to an HTTP response
+func transferError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Transfer not found or expired",
+		})
+	case errors.Is(err, errTransferStale):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "The sender no longer owns the database or you lost access to it",
+		})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to complete transfer",
+		})
+	}
+}
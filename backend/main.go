@@ -2,9 +2,13 @@ package main
 
 import (
 	"log"
+	"os"
+	"time"
 
 	"db-manager-backend/config"
 	"db-manager-backend/handlers"
+	"db-manager-backend/services"
+	"db-manager-backend/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -15,9 +19,21 @@ func main() {
 	// Load environment variables
 	config.LoadEnv()
 
+	// Load master keys for stored credentials
+	config.LoadEncryptionKeys()
+
+	// SQLite connections can only open files in this directory
+	services.SetSQLiteDataDir(config.GetEnv("SQLITE_DATA_DIR", "data"))
+
 	// Connect to database
 	config.ConnectDB()
 
+	// Maintenance commands
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys()
+		return
+	}
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		BodyLimit: 10 * 1024 * 1024, // 10MB limit for request body
@@ -41,13 +57,83 @@ func main() {
 		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
 	}))
 
+	// Shared pool of database sessions used by all handlers
+	connManager := services.NewConnectionManager(
+		services.NewDatabaseService(),
+		config.GetEnvInt("POOL_MAX_CONNECTIONS", 50),
+		config.GetEnvDuration("POOL_IDLE_TIMEOUT", 10*time.Minute),
+	)
+	defer connManager.Close()
+
+	// Background health checks of saved connections (HEALTH_CHECK_INTERVAL=0 disables them)
+	if interval := config.GetEnvDuration("HEALTH_CHECK_INTERVAL", time.Minute); config.DB != nil && interval > 0 {
+		healthMonitor := services.NewHealthMonitor(config.DB, connManager, interval,
+			config.GetEnvDuration("HEALTH_CHECK_RETENTION", 24*time.Hour))
+		healthMonitor.Start()
+		defer healthMonitor.Stop()
+	}
+
+	// Emails are queued in the metadata database and retried until the mail server
+	// accepts them. Without SMTP_HOST they are written to the log.
+	mailTransport := services.MailTransportLog
+	if config.GetEnv("SMTP_HOST", "") != "" {
+		mailTransport = services.MailTransportSMTP
+	}
+	mailer, err := services.NewMailer(services.MailerConfig{
+		Transport:    config.GetEnv("MAIL_TRANSPORT", mailTransport),
+		From:         config.GetEnv("MAIL_FROM", "DB Manager <no-reply@localhost>"),
+		File:         config.GetEnv("MAIL_FILE", "emails.log"),
+		SMTPHost:     config.GetEnv("SMTP_HOST", ""),
+		SMTPPort:     config.GetEnvInt("SMTP_PORT", 587),
+		SMTPUsername: config.GetEnv("SMTP_USERNAME", ""),
+		SMTPPassword: config.GetEnv("SMTP_PASSWORD", ""),
+		SMTPTLS:      config.GetEnv("SMTP_TLS", services.SMTPTLSStartTLS),
+		Timeout:      config.GetEnvDuration("SMTP_TIMEOUT", 30*time.Second),
+	})
+	if err != nil {
+		log.Fatalf("Invalid mail configuration: %v", err)
+	}
+	outbox := services.NewOutbox(config.DB, mailer,
+		config.GetEnvDuration("MAIL_RETRY_INTERVAL", 30*time.Second),
+		config.GetEnvInt("MAIL_MAX_ATTEMPTS", 10),
+		config.GetEnvDuration("MAIL_RETENTION", 7*24*time.Hour))
+	if config.DB != nil {
+		outbox.Start()
+		defer outbox.Stop()
+	}
+
+	// Links in emails point to the frontend
+	setupRoutes(app, connManager, outbox, config.GetEnv("PUBLIC_BASE_URL", "http://localhost:5173"))
+
+	// Start server
+	port := config.GetEnv("PORT", "8080")
+	log.Printf("Server starting on port %s", port)
+	log.Fatal(app.Listen(":" + port))
+}
+
+// rotateKeys re-encrypts stored credentials under the current master key
+func rotateKeys() {
+	if config.DB == nil {
+		log.Fatal("rotate-keys requires the PostgreSQL metadata database")
+	}
+
+	rotated, err := services.RotateCredentialKeys(config.DB)
+	if err != nil {
+		log.Fatalf("Key rotation failed: %v", err)
+	}
+	log.Printf("Re-encrypted %d database connection(s) with master key version %d",
+		rotated, utils.CredentialKeyring().CurrentVersion())
+}
+
+// setupRoutes registers the handlers of every API route
+func setupRoutes(app *fiber.App, connManager *services.ConnectionManager, outbox *services.Outbox, baseURL string) {
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler()
-	dbHandler := handlers.NewDatabaseHandler()
+	dbHandler := handlers.NewDatabaseHandler(connManager)
 	apiHandler := handlers.NewAPIHandler()
-	dbManagementHandler := handlers.NewDatabaseManagementHandler()
-	dynamicAPIHandler := handlers.NewDynamicAPIHandlerOptimized() // Use optimized version
-	sharingHandler := handlers.NewSharingHandler()
+	dbManagementHandler := handlers.NewDatabaseManagementHandler(connManager)
+	dynamicAPIHandler := handlers.NewDynamicAPIHandlerOptimized(connManager) // Use optimized version
+	sharingHandler := handlers.NewSharingHandler(outbox, baseURL)
 
 	// Routes
 	api := app.Group("/api")
@@ -63,23 +149,47 @@ func main() {
 	database.Post("/test", dbHandler.TestConnection)
 	database.Post("/", dbHandler.CreateConnection)
 	database.Get("/", dbHandler.GetConnections)
+	database.Put("/:id", dbHandler.UpdateConnection)
 	database.Get("/:id/info", dbHandler.GetDatabaseInfo)
+	database.Get("/:id/history", dbHandler.GetConnectionHistory)
+	database.Get("/:id/health", dbHandler.GetConnectionHealth)
 	database.Delete("/:id", dbHandler.DeleteConnection)
 
 	// Database Management routes (protected)
 	dbManagement := api.Group("/database-management", handlers.JWTMiddleware)
 	dbManagement.Get("/collections", dbManagementHandler.GetCollections)
 	dbManagement.Get("/collections/:collection/schema", dbManagementHandler.GetCollectionSchema)
+	dbManagement.Get("/collections/:collection/schema/details", dbManagementHandler.GetCollectionSchemaDetails)
 	dbManagement.Get("/collections/:collection/documents", dbManagementHandler.GetDocuments)
+	dbManagement.Get("/collections/:collection/documents/explain", dbManagementHandler.ExplainDocuments)
 	dbManagement.Post("/collections/:collection/documents", dbManagementHandler.CreateDocument)
+	dbManagement.Post("/collections/:collection/documents/query", dbManagementHandler.QueryDocuments)
+	dbManagement.Post("/collections/:collection/find", dbManagementHandler.FindNative)
+	dbManagement.Post("/collections/:collection/aggregate", dbManagementHandler.AggregateNative)
 	dbManagement.Put("/collections/:collection/documents/:id", dbManagementHandler.UpdateDocument)
 	dbManagement.Delete("/collections/:collection/documents/:id", dbManagementHandler.DeleteDocument)
+	// Composite keys may also be addressed with one query parameter per key column
+	dbManagement.Put("/collections/:collection/documents", dbManagementHandler.UpdateDocument)
+	dbManagement.Delete("/collections/:collection/documents", dbManagementHandler.DeleteDocument)
+	dbManagement.Get("/keys", dbManagementHandler.GetKeys)
+	dbManagement.Get("/keys/:key", dbManagementHandler.GetKey)
+	dbManagement.Post("/query", dbManagementHandler.RunQuery)
+	dbManagement.Delete("/query/:queryId", dbManagementHandler.CancelQuery)
+	dbManagement.Post("/explain", dbManagementHandler.ExplainQuery)
+	dbManagement.Get("/saved-queries", dbManagementHandler.ListSavedQueries)
+	dbManagement.Post("/saved-queries", dbManagementHandler.CreateSavedQuery)
+	dbManagement.Get("/saved-queries/:id", dbManagementHandler.GetSavedQuery)
+	dbManagement.Put("/saved-queries/:id", dbManagementHandler.UpdateSavedQuery)
+	dbManagement.Delete("/saved-queries/:id", dbManagementHandler.DeleteSavedQuery)
+	dbManagement.Get("/query-history", dbManagementHandler.GetQueryHistory)
+	dbManagement.Delete("/query-history", dbManagementHandler.ClearQueryHistory)
 
 	// API management routes (protected)
 	apiGroup := api.Group("/api-management", handlers.JWTMiddleware)
 	apiGroup.Post("/keys", apiHandler.CreateAPIKey)
 	apiGroup.Get("/keys", apiHandler.GetAPIKeys)
 	apiGroup.Put("/keys/:id/toggle", apiHandler.ToggleAPIKey)
+	apiGroup.Put("/keys/:id/row-filters", apiHandler.UpdateAPIKeyRowFilters)
 	apiGroup.Delete("/keys/:id", apiHandler.DeleteAPIKey)
 	apiGroup.Post("/endpoints", apiHandler.CreateEndpoint)
 	apiGroup.Get("/endpoints", apiHandler.GetEndpoints)
@@ -101,23 +211,29 @@ func main() {
 	sharing.Get("/pending-invitations", sharingHandler.GetPendingInvitations)
 	sharing.Get("/database-access/:databaseId", sharingHandler.GetDatabaseAccess)
 	sharing.Delete("/access", sharingHandler.RevokeAccess)
+	sharing.Patch("/access", sharingHandler.UpdateAccess)
+	sharing.Put("/access/grants", sharingHandler.UpdateAccessGrants)
+	sharing.Put("/access/row-filters", sharingHandler.UpdateAccessRowFilters)
 	sharing.Delete("/invitations/:invitationId", sharingHandler.RevokeInvitation)
 	sharing.Delete("/leave", sharingHandler.LeaveSharedDatabase)
+	sharing.Post("/transfers", sharingHandler.CreateTransfer)
+	sharing.Get("/transfers", sharingHandler.GetTransfers)
+	sharing.Post("/transfers/:id/accept", sharingHandler.AcceptTransfer)
+	sharing.Post("/transfers/:id/decline", sharingHandler.DeclineTransfer)
+	sharing.Delete("/transfers/:id", sharingHandler.CancelTransfer)
 
 	// Dynamic API routes (public with API key)
 	dynamicAPI := api.Group("/:collection", 
 		dynamicAPIHandler.MemoryMonitor,
 		dynamicAPIHandler.ValidateAPIKey, 
 		dynamicAPIHandler.ValidateEndpoint,
-		dynamicAPIHandler.LogRequest)
+		dynamicAPIHandler.LogRequest,
+		dynamicAPIHandler.HandleQueryEndpoint)
 	dynamicAPI.Get("/", dynamicAPIHandler.HandleGET)
 	dynamicAPI.Get("/:id", dynamicAPIHandler.HandleGET)
 	dynamicAPI.Post("/", dynamicAPIHandler.HandlePOST)
+	dynamicAPI.Put("/", dynamicAPIHandler.HandlePUT)
 	dynamicAPI.Put("/:id", dynamicAPIHandler.HandlePUT)
+	dynamicAPI.Delete("/", dynamicAPIHandler.HandleDELETE)
 	dynamicAPI.Delete("/:id", dynamicAPIHandler.HandleDELETE)
-
-	// Start server
-	port := config.GetEnv("PORT", "8080")
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(app.Listen(":" + port))
 }
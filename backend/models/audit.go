@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// JSONMap is a JSON object stored in a text column
+type JSONMap map[string]interface{}
+
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (m *JSONMap) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into JSONMap", value)
+	}
+	return json.Unmarshal(data, m)
+}
+
+// ConnectionAudit records who changed a database connection and what changed.
+// Secret fields are only reported as changed, never with their values.
+type ConnectionAudit struct {
+	ID         uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
+	DatabaseID uuid.UUID `json:"database_id" gorm:"type:char(36);not null;index"`
+	UserID     uuid.UUID `json:"user_id" gorm:"type:char(36);not null"`
+	Action     string    `json:"action" gorm:"not null"` // update, transfer
+	Changes    JSONMap   `json:"changes" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at"`
+	User       User      `json:"user" gorm:"foreignKey:UserID"`
+}
+
+func (ca *ConnectionAudit) BeforeCreate(tx *gorm.DB) error {
+	ca.ID = uuid.New()
+	return nil
+}
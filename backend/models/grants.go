@@ -0,0 +1,225 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Effects of access grants
+const (
+	GrantAllow = "allow"
+	GrantDeny  = "deny"
+)
+
+// GrantAllCollections matches every table or collection in a grant
+const GrantAllCollections = "*"
+
+// AccessGrant scopes shared access to a table or collection and optionally some of
+// its columns. Allowing write also allows read; denying read also denies write.
+type AccessGrant struct {
+	Collection string   `json:"collection"`        // table or collection, * for all of them
+	Columns    []string `json:"columns,omitempty"` // every column when empty
+	Effect     string   `json:"effect"`            // allow or deny
+	Access     string   `json:"access"`            // read or write
+}
+
+// AccessGrants restrict shared access to what they allow, deny grants taking
+// precedence. Without grants the access covers the whole database.
+type AccessGrants []AccessGrant
+
+func (g AccessGrants) Value() (driver.Value, error) {
+	if g == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(g)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (g *AccessGrants) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*g = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into AccessGrants", value)
+	}
+	if len(data) == 0 {
+		*g = nil
+		return nil
+	}
+	return json.Unmarshal(data, g)
+}
+
+// Validate checks the fields of every grant
+func (g AccessGrants) Validate() error {
+	for i, grant := range g {
+		if strings.TrimSpace(grant.Collection) == "" {
+			return fmt.Errorf("grant %d: collection is required", i+1)
+		}
+		if grant.Effect != GrantAllow && grant.Effect != GrantDeny {
+			return fmt.Errorf("grant %d: effect must be allow or deny", i+1)
+		}
+		if grant.Access != PermissionRead && grant.Access != PermissionWrite {
+			return fmt.Errorf("grant %d: access must be read or write", i+1)
+		}
+		for _, column := range grant.Columns {
+			if strings.TrimSpace(column) == "" {
+				return fmt.Errorf("grant %d: column names must not be empty", i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// Restricted reports whether the grants limit access at all
+func (g AccessGrants) Restricted() bool {
+	return len(g) > 0
+}
+
+// CollectionAllowed reports whether a table or collection can be accessed for read or
+// write. Grants limited to some columns still give access to the collection.
+func (g AccessGrants) CollectionAllowed(collection, access string) bool {
+	if !g.Restricted() {
+		return true
+	}
+	allowed := false
+	for _, grant := range g {
+		if !grant.matches(collection) || !grant.covers(access) {
+			continue
+		}
+		if grant.Effect == GrantDeny && len(grant.Columns) == 0 {
+			return false
+		}
+		if grant.Effect == GrantAllow {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// ColumnAllowed reports whether a column of a table or collection can be read or written
+func (g AccessGrants) ColumnAllowed(collection, column, access string) bool {
+	if !g.Restricted() {
+		return true
+	}
+	allowed := false
+	for _, grant := range g {
+		if !grant.matches(collection) || !grant.covers(access) || !grant.includes(column) {
+			continue
+		}
+		if grant.Effect == GrantDeny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+// AllColumns reports whether every column of a table or collection can be accessed,
+// so that none has to be checked or removed
+func (g AccessGrants) AllColumns(collection, access string) bool {
+	if !g.Restricted() {
+		return true
+	}
+	allowed := false
+	for _, grant := range g {
+		if !grant.matches(collection) || !grant.covers(access) {
+			continue
+		}
+		if grant.Effect == GrantDeny {
+			return false
+		}
+		if len(grant.Columns) == 0 {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// matches ignores case, a grant saved with another spelling than the catalog's still
+// applying to the table
+func (g AccessGrant) matches(collection string) bool {
+	return g.Collection == GrantAllCollections || strings.EqualFold(g.Collection, collection)
+}
+
+// covers reports whether the grant applies to an operation: allow grants to the
+// operations they give, deny grants to the operations they take away
+func (g AccessGrant) covers(access string) bool {
+	if g.Effect == GrantDeny {
+		return HasPermission(access, g.Access)
+	}
+	return HasPermission(g.Access, access)
+}
+
+func (g AccessGrant) includes(column string) bool {
+	if len(g.Columns) == 0 {
+		return true
+	}
+	for _, name := range g.Columns {
+		if strings.EqualFold(name, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// RowFilters limit shared access or an API key to some rows, mapping a table or
+// collection, or * for the others, to a filter tree in the JSON form of the filter
+// parameter. String values may reference ${user.id} and ${user.email}.
+type RowFilters map[string]json.RawMessage
+
+func (f RowFilters) Value() (driver.Value, error) {
+	if f == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (f *RowFilters) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into RowFilters", value)
+	}
+	if len(data) == 0 {
+		*f = nil
+		return nil
+	}
+	return json.Unmarshal(data, f)
+}
+
+// For returns the filter of a table or collection, nil when its rows are not limited.
+// A filter keyed with the name in another case applies too, so that a misspelled key
+// does not leave the rows of an SQL table, whose names match ignoring case, unfiltered.
+func (f RowFilters) For(collection string) json.RawMessage {
+	if filter, ok := f[collection]; ok {
+		return filter
+	}
+	for name, filter := range f {
+		if name != GrantAllCollections && strings.EqualFold(name, collection) {
+			return filter
+		}
+	}
+	return f[GrantAllCollections]
+}
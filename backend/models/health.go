@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Connection statuses maintained by the health monitor
+const (
+	ConnectionStatusActive      = "active"
+	ConnectionStatusUnreachable = "unreachable"
+	ConnectionStatusInactive    = "inactive" // not monitored
+)
+
+// ConnectionHealthCheck is one result of the background health monitor
+type ConnectionHealthCheck struct {
+	ID         uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
+	DatabaseID uuid.UUID `json:"database_id" gorm:"type:char(36);not null;index:idx_health_database_checked"`
+	CheckedAt  time.Time `json:"checked_at" gorm:"not null;index:idx_health_database_checked"`
+	Healthy    bool      `json:"healthy"`
+	LatencyMs  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func (hc *ConnectionHealthCheck) BeforeCreate(tx *gorm.DB) error {
+	hc.ID = uuid.New()
+	return nil
+}
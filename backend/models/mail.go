@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Statuses of queued emails
+const (
+	EmailStatusPending = "pending" // waiting for its next attempt
+	EmailStatusSent    = "sent"
+	EmailStatusFailed  = "failed" // gave up after the maximum number of attempts
+)
+
+// OutboundEmail is a rendered email in the outbox, kept until it is delivered so a
+// mail server outage does not lose it
+type OutboundEmail struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:char(36);primaryKey"`
+	Template      string     `json:"template" gorm:"not null"` // invitation, invitation_accepted, ...
+	Recipient     string     `json:"recipient" gorm:"not null"`
+	Subject       string     `json:"subject" gorm:"not null"`
+	Body          string     `json:"body" gorm:"type:text;not null"`
+	Status        string     `json:"status" gorm:"not null;default:'pending';index:idx_outbound_email_due"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index:idx_outbound_email_due"`
+	LastError     string     `json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (e *OutboundEmail) BeforeCreate(tx *gorm.DB) error {
+	e.ID = uuid.New()
+	return nil
+}
@@ -33,7 +33,17 @@ type DatabaseConnection struct {
 	SSLKey       string         `json:"-"`                                     // SSL key
 	SSLRootCert  string         `json:"-"`                                     // SSL root certificate
 	ConnectionString string     `json:"-"`                                     // Custom connection string
-	Status       string         `json:"status" gorm:"default:'active'"` // active, inactive
+	// Optional SSH tunnel through a bastion host
+	SSHHost      string         `json:"ssh_host"`
+	SSHPort      int            `json:"ssh_port" gorm:"default:22"`
+	SSHUser      string         `json:"ssh_user"`
+	SSHPassword  string         `json:"-"`                  // password, or passphrase of the private key
+	SSHPrivateKey string        `json:"-"`                  // PEM private key
+	SSHHostFingerprint string   `json:"ssh_host_fingerprint"` // SHA256:... as printed by ssh-keygen -l
+	// Envelope encryption of Password, SSLKey, ConnectionString and SSH secrets
+	KeyVersion   int            `json:"-" gorm:"default:0"` // master key version, 0 = plain text
+	DataKey      string         `json:"-"`                  // per-record data key wrapped by the master key
+	Status       string         `json:"status" gorm:"default:'active'"` // active, unreachable, inactive
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
@@ -47,6 +57,7 @@ type APIKey struct {
 	Name         string            `json:"name" gorm:"not null"`
 	Key          string            `json:"key" gorm:"uniqueIndex;not null"`
 	IsActive     bool              `json:"is_active" gorm:"default:true"`
+	RowFilters   RowFilters        `json:"row_filters" gorm:"type:text"` // rows the key is limited to, none for all
 	CreatedAt    time.Time         `json:"created_at"`
 	UpdatedAt    time.Time         `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt    `json:"-" gorm:"index"`
@@ -54,17 +65,26 @@ type APIKey struct {
 	Database     DatabaseConnection `json:"database" gorm:"foreignKey:DatabaseID"`
 }
 
+// Kinds of API endpoints
+const (
+	EndpointKindCollection = "collection" // CRUD on a collection
+	EndpointKindQuery      = "query"      // a published saved query
+)
+
 type APIEndpoint struct {
 	ID           uuid.UUID         `json:"id" gorm:"type:char(36);primaryKey"`
 	DatabaseID   uuid.UUID         `json:"database_id" gorm:"type:char(36);not null"`
+	Kind         string            `json:"kind" gorm:"not null;default:'collection'"` // collection, query
 	Collection   string            `json:"collection" gorm:"not null"`
 	Path         string            `json:"path" gorm:"not null"`
 	Method       string            `json:"method" gorm:"not null"` // GET, POST, PUT, DELETE
+	SavedQueryID *uuid.UUID        `json:"saved_query_id,omitempty" gorm:"type:char(36)"` // query endpoints only
 	IsActive     bool              `json:"is_active" gorm:"default:true"`
 	CreatedAt    time.Time         `json:"created_at"`
 	UpdatedAt    time.Time         `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt    `json:"-" gorm:"index"`
 	Database     DatabaseConnection `json:"database" gorm:"foreignKey:DatabaseID"`
+	SavedQuery   *SavedQuery       `json:"saved_query,omitempty" gorm:"foreignKey:SavedQueryID"`
 }
 
 type APILog struct {
@@ -88,7 +108,10 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 }
 
 func (dc *DatabaseConnection) BeforeCreate(tx *gorm.DB) error {
-	dc.ID = uuid.New()
+	// BeforeSave runs first and already assigns the ID its credentials are bound to
+	if dc.ID == uuid.Nil {
+		dc.ID = uuid.New()
+	}
 	return nil
 }
 
@@ -108,6 +131,41 @@ func (al *APILog) BeforeCreate(tx *gorm.DB) error {
 }
 
 // Database Sharing Models
+
+// Permission levels on a database, from least to most privileged. Shared access is
+// read, write or admin; the owner of a connection has every permission.
+const (
+	PermissionRead  = "read"  // browse and run read-only queries
+	PermissionWrite = "write" // also change data
+	PermissionAdmin = "admin" // also invite users and manage API keys and endpoints
+	PermissionOwner = "owner" // also change or delete the connection
+)
+
+var permissionRanks = map[string]int{
+	PermissionRead:  1,
+	PermissionWrite: 2,
+	PermissionAdmin: 3,
+	PermissionOwner: 4,
+}
+
+// HasPermission reports whether level grants the required level. Unknown levels
+// grant nothing.
+func HasPermission(level, required string) bool {
+	rank, ok := permissionRanks[level]
+	return ok && rank >= permissionRanks[required]
+}
+
+// SharedPermissions returns the levels of shared access that grant the required level
+func SharedPermissions(required string) []string {
+	var levels []string
+	for _, level := range []string{PermissionRead, PermissionWrite, PermissionAdmin} {
+		if HasPermission(level, required) {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
 type DatabaseInvitation struct {
 	ID              uuid.UUID      `json:"id" gorm:"type:char(36);primaryKey"`
 	DatabaseID      uuid.UUID      `json:"database_id" gorm:"type:char(36);not null"`
@@ -115,6 +173,8 @@ type DatabaseInvitation struct {
 	InviteeEmail    string         `json:"invitee_email" gorm:"not null"`
 	InvitationToken string         `json:"invitation_token" gorm:"uniqueIndex;not null"`
 	PermissionLevel string         `json:"permission_level" gorm:"default:'read'"` // read, write, admin
+	Grants          AccessGrants   `json:"grants" gorm:"type:text"`                // given to the access on acceptance
+	RowFilters      RowFilters     `json:"row_filters" gorm:"type:text"`           // given to the access on acceptance
 	Status          string         `json:"status" gorm:"default:'pending'"`        // pending, accepted, rejected, expired
 	ExpiresAt       time.Time      `json:"expires_at" gorm:"not null"`
 	CreatedAt       time.Time      `json:"created_at"`
@@ -132,6 +192,8 @@ type DatabaseAccess struct {
 	DatabaseID      uuid.UUID      `json:"database_id" gorm:"type:char(36);not null"`
 	UserID          uuid.UUID      `json:"user_id" gorm:"type:char(36);not null"`
 	PermissionLevel string         `json:"permission_level" gorm:"default:'read'"` // read, write, admin
+	Grants          AccessGrants   `json:"grants" gorm:"type:text"`                // collections and columns it is limited to, none for all
+	RowFilters      RowFilters     `json:"row_filters" gorm:"type:text"`           // rows it is limited to, none for all
 	GrantedBy       uuid.UUID      `json:"granted_by" gorm:"type:char(36);not null"`
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
@@ -141,6 +203,23 @@ type DatabaseAccess struct {
 	Grantor         User           `json:"grantor" gorm:"foreignKey:GrantedBy"`
 }
 
+// OwnershipTransfer offers a database to one of its collaborators, who becomes the
+// owner on acceptance while the previous owner keeps admin access
+type OwnershipTransfer struct {
+	ID         uuid.UUID          `json:"id" gorm:"type:char(36);primaryKey"`
+	DatabaseID uuid.UUID          `json:"database_id" gorm:"type:char(36);not null;index"`
+	FromUserID uuid.UUID          `json:"from_user_id" gorm:"type:char(36);not null"`
+	ToUserID   uuid.UUID          `json:"to_user_id" gorm:"type:char(36);not null"`
+	Status     string             `json:"status" gorm:"default:'pending'"` // pending, accepted, declined, cancelled
+	ExpiresAt  time.Time          `json:"expires_at" gorm:"not null"`
+	AcceptedAt *time.Time         `json:"accepted_at"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+	Database   DatabaseConnection `json:"database" gorm:"foreignKey:DatabaseID"`
+	FromUser   User               `json:"from_user" gorm:"foreignKey:FromUserID"`
+	ToUser     User               `json:"to_user" gorm:"foreignKey:ToUserID"`
+}
+
 func (di *DatabaseInvitation) BeforeCreate(tx *gorm.DB) error {
 	di.ID = uuid.New()
 	return nil
@@ -150,3 +229,8 @@ func (da *DatabaseAccess) BeforeCreate(tx *gorm.DB) error {
 	da.ID = uuid.New()
 	return nil
 }
+
+func (ot *OwnershipTransfer) BeforeCreate(tx *gorm.DB) error {
+	ot.ID = uuid.New()
+	return nil
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Kinds of queries run from the query console
+const (
+	QueryKindSQL       = "sql"       // SQL script
+	QueryKindFind      = "find"      // MongoDB find, stored as {"filter", "projection", "sort"}
+	QueryKindAggregate = "aggregate" // MongoDB aggregation pipeline
+)
+
+// Types of saved query parameters
+const (
+	ParameterTypeString  = "string"
+	ParameterTypeInteger = "integer"
+	ParameterTypeNumber  = "number"
+	ParameterTypeBoolean = "boolean"
+	ParameterTypeDate    = "date" // RFC 3339 timestamp or YYYY-MM-DD
+)
+
+// QueryParameter declares a named parameter of a saved query
+type QueryParameter struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// QueryParameters is a list of parameters stored as JSON in a text column
+type QueryParameters []QueryParameter
+
+func (p QueryParameters) Value() (driver.Value, error) {
+	if p == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (p *QueryParameters) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into QueryParameters", value)
+	}
+	return json.Unmarshal(data, p)
+}
+
+// SavedQuery is a named SQL script or MongoDB pipeline kept by a user. Shared queries
+// are visible to every user with access to the database.
+type SavedQuery struct {
+	ID          uuid.UUID       `json:"id" gorm:"type:char(36);primaryKey"`
+	UserID      uuid.UUID       `json:"user_id" gorm:"type:char(36);not null;index"`
+	DatabaseID  uuid.UUID       `json:"database_id" gorm:"type:char(36);not null;index"`
+	Name        string          `json:"name" gorm:"not null"`
+	Description string          `json:"description"`
+	Kind        string          `json:"kind" gorm:"not null;default:'sql'"` // sql or aggregate
+	Collection  string          `json:"collection,omitempty"`               // aggregate only
+	Query       string          `json:"query" gorm:"type:text;not null"`    // SQL, or the pipeline as Extended JSON
+	Parameters  QueryParameters `json:"parameters" gorm:"type:text"`
+	Shared      bool            `json:"shared" gorm:"default:false"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt  `json:"-" gorm:"index"`
+	User        *User           `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// QueryHistory records one query run from the console by a user
+type QueryHistory struct {
+	ID         uuid.UUID `json:"id" gorm:"type:char(36);primaryKey"`
+	UserID     uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index:idx_query_history_user_executed"`
+	DatabaseID uuid.UUID `json:"database_id" gorm:"type:char(36);not null;index"`
+	Kind       string    `json:"kind" gorm:"not null"`
+	Collection string    `json:"collection,omitempty"`
+	Query      string    `json:"query" gorm:"type:text;not null"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	RowCount   int64     `json:"row_count"` // rows returned plus rows affected
+	ExecutedAt time.Time `json:"executed_at" gorm:"not null;index:idx_query_history_user_executed"`
+}
+
+func (sq *SavedQuery) BeforeCreate(tx *gorm.DB) error {
+	sq.ID = uuid.New()
+	return nil
+}
+
+func (qh *QueryHistory) BeforeCreate(tx *gorm.DB) error {
+	qh.ID = uuid.New()
+	return nil
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"fmt"
+
+	"db-manager-backend/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// secretsTable is the table whose records the credentials are bound to
+const secretsTable = "database_connections"
+
+// secretFields returns the credential columns encrypted at rest, keyed by column name.
+// The table, record ID and column name are bound to each ciphertext as additional
+// authenticated data.
+func (dc *DatabaseConnection) secretFields() map[string]*string {
+	return map[string]*string{
+		"password":          &dc.Password,
+		"ssl_key":           &dc.SSLKey,
+		"connection_string": &dc.ConnectionString,
+		"ssh_password":      &dc.SSHPassword,
+		"ssh_private_key":   &dc.SSHPrivateKey,
+	}
+}
+
+// EncryptSecrets seals the credentials under a fresh data key wrapped by the current
+// master key. Without a configured master key they are kept in plain text (key version 0).
+func (dc *DatabaseConnection) EncryptSecrets() error {
+	keyring := utils.CredentialKeyring()
+	if !keyring.Enabled() {
+		dc.KeyVersion = 0
+		dc.DataKey = ""
+		return nil
+	}
+	if dc.ID == uuid.Nil {
+		dc.ID = uuid.New()
+	}
+
+	dataKey, wrapped, err := keyring.NewDataKey(dc.secretsAAD("data_key"))
+	if err != nil {
+		return err
+	}
+
+	for column, field := range dc.secretFields() {
+		if *field == "" {
+			continue
+		}
+		sealed, err := utils.Seal(dataKey, []byte(*field), dc.secretsAAD(column))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %v", column, err)
+		}
+		*field = sealed
+	}
+
+	dc.KeyVersion = keyring.CurrentVersion()
+	dc.DataKey = wrapped
+	return nil
+}
+
+// DecryptSecrets restores the plain text credentials of an encrypted record
+func (dc *DatabaseConnection) DecryptSecrets() error {
+	if dc.KeyVersion == 0 {
+		return nil
+	}
+
+	dataKey, err := utils.CredentialKeyring().UnwrapDataKey(dc.KeyVersion, dc.DataKey, dc.secretsAAD("data_key"))
+	if err != nil {
+		return fmt.Errorf("connection %s: %v", dc.ID, err)
+	}
+
+	for column, field := range dc.secretFields() {
+		if *field == "" {
+			continue
+		}
+		plain, err := utils.Unseal(dataKey, *field, dc.secretsAAD(column))
+		if err != nil {
+			return fmt.Errorf("connection %s: failed to decrypt %s: %v", dc.ID, column, err)
+		}
+		*field = string(plain)
+	}
+
+	// The struct now holds plain text; the next save encrypts it again
+	dc.KeyVersion = 0
+	dc.DataKey = ""
+	return nil
+}
+
+// secretsAAD returns the additional authenticated data of a column of this record, so
+// that a ciphertext or wrapped data key copied to another record or column fails to
+// decrypt
+func (dc *DatabaseConnection) secretsAAD(column string) []byte {
+	return []byte(secretsTable + "/" + dc.ID.String() + "/" + column)
+}
+
+func (dc *DatabaseConnection) BeforeSave(tx *gorm.DB) error {
+	return dc.EncryptSecrets()
+}
+
+// AfterSave gives callers back the plain text values they saved
+func (dc *DatabaseConnection) AfterSave(tx *gorm.DB) error {
+	return dc.DecryptSecrets()
+}
+
+func (dc *DatabaseConnection) AfterFind(tx *gorm.DB) error {
+	return dc.DecryptSecrets()
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"db-manager-backend/utils"
+
+	"github.com/google/uuid"
+)
+
+func useTestKeyring(t *testing.T) *utils.Keyring {
+	t.Helper()
+	key := make([]byte, 32)
+	rand.Read(key)
+	keyring, err := utils.ParseKeyring(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := utils.CredentialKeyring()
+	utils.SetCredentialKeyring(keyring)
+	t.Cleanup(func() { utils.SetCredentialKeyring(previous) })
+	return keyring
+}
+
+func TestSecretsRoundTrip(t *testing.T) {
+	useTestKeyring(t)
+
+	dc := &DatabaseConnection{Password: "secret", SSLKey: "key"}
+	if err := dc.EncryptSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if dc.ID == uuid.Nil {
+		t.Fatal("encrypting a new record must assign the ID its credentials are bound to")
+	}
+	if dc.Password == "secret" || dc.SSLKey == "key" {
+		t.Fatal("credentials were not encrypted")
+	}
+	if err := dc.DecryptSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if dc.Password != "secret" || dc.SSLKey != "key" {
+		t.Fatalf("got %q and %q back", dc.Password, dc.SSLKey)
+	}
+}
+
+func TestSecretsAreBoundToTheirRecord(t *testing.T) {
+	useTestKeyring(t)
+
+	victim := &DatabaseConnection{ID: uuid.New(), Password: "victim"}
+	if err := victim.EncryptSecrets(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another record holding the victim's ciphertext and data key
+	copied := &DatabaseConnection{
+		ID:         uuid.New(),
+		Password:   victim.Password,
+		KeyVersion: victim.KeyVersion,
+		DataKey:    victim.DataKey,
+	}
+	if err := copied.DecryptSecrets(); err == nil {
+		t.Fatalf("a ciphertext moved to another record decrypted to %q", copied.Password)
+	}
+
+	// The same record with the ciphertext moved to another column
+	moved := &DatabaseConnection{
+		ID:         victim.ID,
+		SSLKey:     victim.Password,
+		KeyVersion: victim.KeyVersion,
+		DataKey:    victim.DataKey,
+	}
+	if err := moved.DecryptSecrets(); err == nil {
+		t.Fatalf("a ciphertext moved to another column decrypted to %q", moved.SSLKey)
+	}
+}
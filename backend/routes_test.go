@@ -0,0 +1,642 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"db-manager-backend/config"
+	"db-manager-backend/models"
+	"db-manager-backend/services"
+	"db-manager-backend/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// roles from the lowest to the highest, "none" being a user the database is not
+// shared with
+var roles = []string{"none", models.PermissionRead, models.PermissionWrite, models.PermissionAdmin, models.PermissionOwner}
+
+// routeFixture is a metadata database with one SQLite connection, shared with a user
+// of each role, and the records the routes below address
+type routeFixture struct {
+	t        *testing.T
+	app      *fiber.App
+	database models.DatabaseConnection
+	users    map[string]models.User
+	keys     map[string]models.APIKey // one per role, created when the user had it
+	// records maps a placeholder of request paths and bodies to the record of each
+	// role it stands for, created on first use
+	records map[string]map[string]string
+}
+
+func newRouteFixture(t *testing.T) *routeFixture {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "metadata.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	previous := config.DB
+	config.DB = db
+	services.SetSQLiteDataDir(dir)
+	t.Cleanup(func() {
+		config.DB = previous
+		services.SetSQLiteDataDir("data")
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	data, err := sql.Open("sqlite", filepath.Join(dir, "shop.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	// Each role deletes its own note so that the roles after it still find theirs
+	if _, err := data.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, item TEXT, region TEXT);
+		INSERT INTO orders VALUES (1, 'book', 'eu'), (2, 'pen', 'us');
+		CREATE TABLE notes (id INTEGER PRIMARY KEY, text TEXT);
+		INSERT INTO notes VALUES (1, 'a'), (2, 'b'), (3, 'c'), (4, 'd'), (5, 'e')`); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &routeFixture{t: t, users: make(map[string]models.User), keys: make(map[string]models.APIKey),
+		records: make(map[string]map[string]string)}
+	for _, role := range roles {
+		user := models.User{Email: role + "@example.com", Password: "unused"}
+		f.create(&user)
+		f.users[role] = user
+	}
+
+	owner := f.users[models.PermissionOwner]
+	f.database = models.DatabaseConnection{UserID: owner.ID, Name: "shop", Type: "sqlite", Database: "shop.db"}
+	f.create(&f.database)
+	for _, role := range []string{models.PermissionRead, models.PermissionWrite, models.PermissionAdmin} {
+		f.create(&models.DatabaseAccess{DatabaseID: f.database.ID, UserID: f.users[role].ID, PermissionLevel: role, GrantedBy: owner.ID})
+	}
+
+	for _, role := range roles {
+		key := models.APIKey{UserID: f.users[role].ID, DatabaseID: f.database.ID, Name: role, Key: utils.GenerateAPIKey(), IsActive: true}
+		f.create(&key)
+		f.keys[role] = key
+	}
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+		f.create(&models.APIEndpoint{DatabaseID: f.database.ID, Kind: models.EndpointKindCollection, Collection: "orders",
+			Path: "/api/orders", Method: method, IsActive: true})
+	}
+
+	mailer, err := services.NewMailer(services.MailerConfig{Transport: services.MailTransportLog, From: "no-reply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connManager := services.NewConnectionManager(services.NewDatabaseService(), 10, time.Minute)
+	t.Cleanup(connManager.Close)
+
+	f.app = fiber.New()
+	setupRoutes(f.app, connManager, services.NewOutbox(db, mailer, time.Minute, 1, 0), "http://localhost:5173")
+	return f
+}
+
+func (f *routeFixture) create(value interface{}) {
+	f.t.Helper()
+	if err := config.DB.Create(value).Error; err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// record returns the ID of the record of a role a placeholder stands for, creating it
+// the first time. Roles that could not have such a record get an unknown ID.
+func (f *routeFixture) record(placeholder, role string) string {
+	f.t.Helper()
+	if id, ok := f.records[placeholder][role]; ok {
+		return id
+	}
+
+	id := uuid.NewString()
+	owner := f.users[models.PermissionOwner]
+	user := f.users[role]
+	switch placeholder {
+	case "{key}":
+		id = f.keys[role].ID.String()
+	case "{row}":
+		for i, r := range roles {
+			if r == role {
+				id = strconv.Itoa(i + 1)
+			}
+		}
+	case "{target}":
+		// A user shared with read access, whom the role's sharing requests act on
+		target := models.User{Email: "target-" + role + "@example.com", Password: "unused"}
+		f.create(&target)
+		f.create(&models.DatabaseAccess{DatabaseID: f.database.ID, UserID: target.ID, PermissionLevel: models.PermissionRead, GrantedBy: owner.ID})
+		id = target.ID.String()
+	case "{query}", "{published}":
+		// Saved while the user had access, published while the user was an admin
+		query := models.SavedQuery{UserID: user.ID, DatabaseID: f.database.ID, Name: role, Query: "SELECT * FROM orders"}
+		f.create(&query)
+		if placeholder == "{published}" {
+			f.create(&models.APIEndpoint{DatabaseID: f.database.ID, Kind: models.EndpointKindQuery, Collection: "published_" + role,
+				Path: "/api/published_" + role, Method: "GET", SavedQueryID: &query.ID, IsActive: true})
+		}
+		id = query.ID.String()
+	case "{endpoint}":
+		endpoint := models.APIEndpoint{DatabaseID: f.database.ID, Kind: models.EndpointKindCollection, Collection: "notes",
+			Path: "/api/notes_" + role, Method: "GET", IsActive: true}
+		f.create(&endpoint)
+		id = endpoint.ID.String()
+	case "{invitation}":
+		invitation := models.DatabaseInvitation{DatabaseID: f.database.ID, InviterID: owner.ID, InviteeEmail: role + "-invited@example.com",
+			InvitationToken: uuid.NewString(), PermissionLevel: models.PermissionRead, Status: "pending", ExpiresAt: time.Now().Add(time.Hour)}
+		f.create(&invitation)
+		id = invitation.ID.String()
+	case "{transfer}":
+		// Ownership is only offered to users the database is shared with
+		if role != "none" && role != models.PermissionOwner {
+			transfer := models.OwnershipTransfer{DatabaseID: f.database.ID, FromUserID: owner.ID, ToUserID: user.ID,
+				Status: "pending", ExpiresAt: time.Now().Add(time.Hour)}
+			f.create(&transfer)
+			id = transfer.ID.String()
+		}
+	case "{sent}":
+		// Only the owner can offer the ownership
+		if role == models.PermissionOwner {
+			transfer := models.OwnershipTransfer{DatabaseID: f.database.ID, FromUserID: owner.ID, ToUserID: f.users[models.PermissionAdmin].ID,
+				Status: "pending", ExpiresAt: time.Now().Add(time.Hour)}
+			f.create(&transfer)
+			id = transfer.ID.String()
+		}
+	default:
+		f.t.Fatalf("unknown placeholder %s", placeholder)
+	}
+
+	if f.records[placeholder] == nil {
+		f.records[placeholder] = make(map[string]string)
+	}
+	f.records[placeholder][role] = id
+	return id
+}
+
+// placeholders stand for the records of the requesting role
+var placeholders = regexp.MustCompile(`\{(key|row|target|query|published|endpoint|invitation|transfer|sent)\}`)
+
+// request sends a request as a user, placeholders in the path and body being replaced
+// with the fixture's records. It returns the status and the decoded body.
+func (f *routeFixture) request(t *testing.T, role, method, path, body string, header map[string]string) (int, interface{}) {
+	t.Helper()
+	status, decoded, err := f.send(role, method, path, body, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, decoded
+}
+
+// send is request for goroutines other than the test's own
+func (f *routeFixture) send(role, method, path, body string, header map[string]string) (int, interface{}, error) {
+	replace := func(text string) string {
+		text = strings.NewReplacer("{database}", f.database.ID.String(), "{role}", role).Replace(text)
+		return placeholders.ReplaceAllStringFunc(text, func(placeholder string) string {
+			return f.record(placeholder, role)
+		})
+	}
+	req := httptest.NewRequest(method, replace(path), strings.NewReader(replace(body)))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if user, ok := f.users[role]; ok && header == nil {
+		token, err := utils.GenerateJWT(user.ID.String(), user.Email, config.GetEnv("JWT_SECRET", "default-secret"))
+		if err != nil {
+			return 0, nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := f.app.Test(req, 10000)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	var decoded interface{}
+	json.Unmarshal(raw, &decoded)
+	return resp.StatusCode, decoded, nil
+}
+
+// cancelRunningQuery starts a long query as a user and cancels it, returning the
+// answer to the cancellation
+func cancelRunningQuery(t *testing.T, f *routeFixture, role string) (int, interface{}) {
+	t.Helper()
+	id := uuid.NewString()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.send(role, "POST", "/api/database-management/query", `{"database_id": "{database}", "query_id": "`+id+`",
+			"query": "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT count(*) FROM n"}`, nil)
+	}()
+	defer func() { <-done }()
+
+	// The query is only known once it started
+	for {
+		status, body := f.request(t, role, "DELETE", "/api/database-management/query/"+id, "", nil)
+		if status != fiber.StatusNotFound {
+			return status, body
+		}
+		select {
+		case <-done:
+			return f.request(t, role, "DELETE", "/api/database-management/query/"+id, "", nil)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// databaseRoutes are the routes acting on the fixture's database or on the records of
+// its users, with the lowest role allowed to use them
+var databaseRoutes = []struct {
+	method, path, body string
+	// required is the lowest role allowed, none for routes only acting on the user's
+	// own records, which every user can use
+	required string
+	status   int      // answer of allowed requests when they cannot succeed on SQLite
+	hidden   bool     // lower roles cannot have the record, which is not found
+	fresh    bool     // an allowed request changes the database for the next roles
+	as       []string // roles sending the request, all of them by default
+	send     func(t *testing.T, f *routeFixture, role string) (int, interface{})
+}{
+	{method: "GET", path: "/api/database/{database}/info", required: models.PermissionRead},
+	{method: "GET", path: "/api/database/{database}/health", required: models.PermissionRead},
+	{method: "GET", path: "/api/database/{database}/history", required: models.PermissionAdmin},
+	{method: "PUT", path: "/api/database/{database}", body: `{"name": "renamed"}`, required: models.PermissionOwner},
+	{method: "DELETE", path: "/api/database/{database}", required: models.PermissionOwner},
+
+	{method: "GET", path: "/api/database-management/collections?database_id={database}", required: models.PermissionRead},
+	{method: "GET", path: "/api/database-management/collections/orders/schema?database_id={database}", required: models.PermissionRead},
+	{method: "GET", path: "/api/database-management/collections/orders/schema/details?database_id={database}", required: models.PermissionRead},
+	{method: "GET", path: "/api/database-management/collections/orders/documents?database_id={database}", required: models.PermissionRead},
+	{method: "GET", path: "/api/database-management/collections/orders/documents/explain?database_id={database}", required: models.PermissionRead},
+	{method: "POST", path: "/api/database-management/collections/orders/documents/query", body: `{"database_id": "{database}"}`,
+		required: models.PermissionRead},
+	{method: "POST", path: "/api/database-management/collections/orders/documents",
+		body: `{"database_id": "{database}", "data": {"item": "ink", "region": "eu"}}`, required: models.PermissionWrite},
+	{method: "PUT", path: "/api/database-management/collections/orders/documents/1",
+		body: `{"database_id": "{database}", "data": {"item": "mug"}}`, required: models.PermissionWrite},
+	{method: "PUT", path: "/api/database-management/collections/orders/documents?id=1",
+		body: `{"database_id": "{database}", "data": {"item": "mug"}}`, required: models.PermissionWrite},
+	{method: "DELETE", path: "/api/database-management/collections/notes/documents/{row}", body: `{"database_id": "{database}"}`,
+		required: models.PermissionWrite},
+	{method: "DELETE", path: "/api/database-management/collections/notes/documents?id={row}", body: `{"database_id": "{database}"}`,
+		required: models.PermissionWrite},
+	{method: "POST", path: "/api/database-management/collections/orders/find", body: `{"database_id": "{database}"}`,
+		required: models.PermissionRead, status: fiber.StatusBadRequest},
+	{method: "POST", path: "/api/database-management/collections/orders/aggregate", body: `{"database_id": "{database}", "pipeline": []}`,
+		required: models.PermissionRead, status: fiber.StatusBadRequest},
+	{method: "GET", path: "/api/database-management/keys?database_id={database}", required: models.PermissionRead, status: fiber.StatusBadRequest},
+	{method: "GET", path: "/api/database-management/keys/session?database_id={database}", required: models.PermissionRead,
+		status: fiber.StatusBadRequest},
+	{method: "POST", path: "/api/database-management/query", body: `{"database_id": "{database}", "query": "SELECT * FROM orders"}`,
+		required: models.PermissionRead},
+	{method: "DELETE", path: "/api/database-management/query/{id}", required: models.PermissionRead, send: cancelRunningQuery},
+	{method: "POST", path: "/api/database-management/explain", body: `{"database_id": "{database}", "query": "SELECT * FROM orders"}`,
+		required: models.PermissionRead},
+	{method: "POST", path: "/api/database-management/saved-queries",
+		body: `{"database_id": "{database}", "name": "all orders", "query": "SELECT * FROM orders"}`, required: models.PermissionRead},
+	{method: "GET", path: "/api/database-management/saved-queries/{query}", required: models.PermissionRead},
+	{method: "PUT", path: "/api/database-management/saved-queries/{query}", body: `{"name": "renamed", "query": "SELECT 1"}`,
+		required: models.PermissionRead},
+	{method: "PUT", path: "/api/database-management/saved-queries/{published}", body: `{"name": "renamed", "query": "SELECT 1"}`,
+		required: models.PermissionAdmin},
+	{method: "DELETE", path: "/api/database-management/saved-queries/{query}"},
+	{method: "GET", path: "/api/database-management/query-history?database_id={database}"},
+
+	{method: "POST", path: "/api/api-management/keys", body: `{"database_id": "{database}", "name": "new"}`, required: models.PermissionAdmin},
+	{method: "PUT", path: "/api/api-management/keys/{key}/row-filters", body: `{"row_filters": {}}`, required: models.PermissionAdmin},
+	{method: "PUT", path: "/api/api-management/keys/{key}/toggle"},
+	{method: "DELETE", path: "/api/api-management/keys/{key}"},
+	{method: "POST", path: "/api/api-management/endpoints", body: `{"database_id": "{database}", "collection": "items_{role}", "method": "GET"}`,
+		required: models.PermissionAdmin},
+	{method: "PUT", path: "/api/api-management/endpoints/{endpoint}/toggle", required: models.PermissionAdmin},
+	{method: "DELETE", path: "/api/api-management/endpoints/{endpoint}", required: models.PermissionAdmin},
+	{method: "GET", path: "/api/api-management/logs"},
+	{method: "DELETE", path: "/api/api-management/logs"},
+
+	{method: "POST", path: "/api/sharing/invitations",
+		body: `{"database_id": "{database}", "invitee_email": "{role}-new@example.com", "permission_level": "read"}`, required: models.PermissionAdmin},
+	{method: "POST", path: "/api/sharing/invitations",
+		body: `{"database_id": "{database}", "invitee_email": "{role}-new@example.com", "permission_level": "admin"}`, required: models.PermissionOwner},
+	{method: "GET", path: "/api/sharing/invitations/database/{database}", required: models.PermissionAdmin},
+	{method: "DELETE", path: "/api/sharing/invitations/{invitation}", required: models.PermissionAdmin},
+	{method: "GET", path: "/api/sharing/database-access/{database}", required: models.PermissionAdmin},
+	{method: "PATCH", path: "/api/sharing/access", body: `{"database_id": "{database}", "user_id": "{target}", "permission_level": "write"}`,
+		required: models.PermissionAdmin},
+	{method: "PUT", path: "/api/sharing/access/grants", body: `{"database_id": "{database}", "user_id": "{target}", "grants": []}`,
+		required: models.PermissionAdmin},
+	{method: "PUT", path: "/api/sharing/access/row-filters", body: `{"database_id": "{database}", "user_id": "{target}", "row_filters": {}}`,
+		required: models.PermissionAdmin},
+	{method: "DELETE", path: "/api/sharing/access", body: `{"database_id": "{database}", "user_id": "{target}"}`, required: models.PermissionAdmin},
+	{method: "POST", path: "/api/sharing/transfers", body: `{"database_id": "{database}", "user_id": "{target}"}`, required: models.PermissionOwner},
+	// The owner cannot be offered its own database
+	{method: "POST", path: "/api/sharing/transfers/{transfer}/accept", required: models.PermissionRead, fresh: true,
+		as: []string{"none", models.PermissionRead, models.PermissionWrite, models.PermissionAdmin}},
+	{method: "POST", path: "/api/sharing/transfers/{transfer}/decline", required: models.PermissionRead,
+		as: []string{"none", models.PermissionRead, models.PermissionWrite, models.PermissionAdmin}},
+	{method: "DELETE", path: "/api/sharing/transfers/{sent}", required: models.PermissionOwner, hidden: true},
+}
+
+func TestRoutesRequireTheirRole(t *testing.T) {
+	for _, route := range databaseRoutes {
+		route := route
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			var f *routeFixture
+			as := route.as
+			if as == nil {
+				as = roles
+			}
+			for _, role := range as {
+				if f == nil || route.fresh {
+					f = newRouteFixture(t)
+				}
+				var status int
+				var body interface{}
+				if route.send != nil {
+					status, body = route.send(t, f, role)
+				} else {
+					status, body = f.request(t, role, route.method, route.path, route.body, nil)
+				}
+
+				switch {
+				case route.required == "":
+					if status >= 400 {
+						t.Errorf("as %s: got %d %v, want success", role, status, body)
+					}
+				case role == "none":
+					if status != fiber.StatusNotFound {
+						t.Errorf("a user without access got %d %v, want 404", status, body)
+					}
+				case !models.HasPermission(role, route.required):
+					want := fiber.StatusForbidden
+					if route.hidden {
+						want = fiber.StatusNotFound
+					}
+					if status != want {
+						t.Errorf("as %s: got %d %v, want %d", role, status, body, want)
+					}
+				case route.status != 0:
+					if status != route.status {
+						t.Errorf("as %s: got %d %v, want %d", role, status, body, route.status)
+					}
+				default:
+					if status >= 400 {
+						t.Errorf("as %s: got %d %v, want success", role, status, body)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRoutesHideDeletedConnections(t *testing.T) {
+	for _, route := range databaseRoutes {
+		// Users keep managing their own records, and the route cancelling queries
+		// has none running
+		if route.required == "" || route.send != nil || route.hidden {
+			continue
+		}
+		route := route
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			f := newRouteFixture(t)
+			// Deleting a connection soft-deletes it and leaves its shares behind
+			if err := config.DB.Delete(&f.database).Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, role := range []string{models.PermissionAdmin, models.PermissionOwner} {
+				if status, body := f.request(t, role, route.method, route.path, route.body, nil); status != fiber.StatusNotFound {
+					t.Errorf("as %s: got %d %v on a deleted connection, want 404", role, status, body)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIKeysActWithTheirCreatorsAccess(t *testing.T) {
+	f := newRouteFixture(t)
+	for _, role := range roles {
+		header := map[string]string{"X-API-Key": f.keys[role].Key}
+
+		status, body := f.request(t, role, "GET", "/api/orders", "", header)
+		if wantSuccess := role != "none"; wantSuccess != (status == fiber.StatusOK) {
+			t.Errorf("GET with the key of a %s user: got %d %v", role, status, body)
+		}
+
+		status, body = f.request(t, role, "POST", "/api/orders", `{"item": "`+role+`", "region": "eu"}`, header)
+		if wantSuccess := models.HasPermission(role, models.PermissionWrite); wantSuccess != (status < 400) {
+			t.Errorf("POST with the key of a %s user: got %d %v", role, status, body)
+		}
+	}
+}
+
+func TestAPIKeysAreLimitedToTheirCreatorsGrants(t *testing.T) {
+	f := newRouteFixture(t)
+	reader := f.users[models.PermissionRead]
+	// The key was created before the reader's access was limited
+	if err := config.DB.Model(&models.DatabaseAccess{}).Where("user_id = ?", reader.ID).Updates(map[string]interface{}{
+		"grants":      models.AccessGrants{{Collection: "orders", Columns: []string{"id", "item"}, Effect: models.GrantAllow, Access: models.PermissionRead}},
+		"row_filters": models.RowFilters{"orders": json.RawMessage(`{"field": "region", "operator": "eq", "value": "eu"}`)},
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	header := map[string]string{"X-API-Key": f.keys[models.PermissionRead].Key}
+
+	status, body := f.request(t, models.PermissionRead, "GET", "/api/orders", "", header)
+	if status != fiber.StatusOK {
+		t.Fatalf("GET with the key of a limited user: got %d %v", status, body)
+	}
+	documents, _ := body.(map[string]interface{})["data"].([]interface{})
+	if len(documents) != 1 {
+		t.Fatalf("the key read %v, want the one order of the user's region", documents)
+	}
+	document := documents[0].(map[string]interface{})
+	if document["item"] != "book" {
+		t.Fatalf("the key read %v, want the book ordered in the user's region", document)
+	}
+	if _, ok := document["region"]; ok {
+		t.Fatalf("the key read %v, including a column the user cannot read", document)
+	}
+
+	if status, body := f.request(t, models.PermissionRead, "GET", "/api/orders/2", "", header); status < 400 {
+		t.Fatalf("the key read %d %v outside of the user's rows", status, body)
+	}
+
+	// Saved queries could read any column of any row
+	query := models.SavedQuery{UserID: f.users[models.PermissionOwner].ID, DatabaseID: f.database.ID, Name: "notes", Query: "SELECT * FROM notes"}
+	f.create(&query)
+	f.create(&models.APIEndpoint{DatabaseID: f.database.ID, Kind: models.EndpointKindQuery, Collection: "all_notes",
+		Path: "/api/all_notes", Method: "GET", SavedQueryID: &query.ID, IsActive: true})
+	if status, body := f.request(t, models.PermissionRead, "GET", "/api/all_notes", "", header); status != fiber.StatusForbidden {
+		t.Fatalf("the key ran a published query: got %d %v, want 403", status, body)
+	}
+}
+
+// TestAPIKeysOfDeletedConnectionsAreRejected checks that keys stop working with the
+// connection they were created for
+func TestAPIKeysOfDeletedConnectionsAreRejected(t *testing.T) {
+	f := newRouteFixture(t)
+	if err := config.DB.Delete(&f.database).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range []string{models.PermissionAdmin, models.PermissionOwner} {
+		header := map[string]string{"X-API-Key": f.keys[role].Key}
+		if status, body := f.request(t, role, "GET", "/api/orders", "", header); status < 400 {
+			t.Errorf("the key of a %s of a deleted connection got %d %v", role, status, body)
+		}
+	}
+}
+
+// spelledRoutes read or write the orders of the fixture, {collection} being replaced with
+// a spelling of the table
+var spelledRoutes = []struct {
+	method, path, body string
+}{
+	{"GET", "/api/database-management/collections/{collection}/schema?database_id={database}", ""},
+	{"GET", "/api/database-management/collections/{collection}/schema/details?database_id={database}", ""},
+	{"GET", "/api/database-management/collections/{collection}/documents?database_id={database}", ""},
+	{"GET", "/api/database-management/collections/{collection}/documents/explain?database_id={database}", ""},
+	{"POST", "/api/database-management/collections/{collection}/documents/query", `{"database_id": "{database}"}`},
+	{"POST", "/api/database-management/collections/{collection}/documents",
+		`{"database_id": "{database}", "data": {"id": 3, "item": "ink", "region": "eu"}}`},
+	{"PUT", "/api/database-management/collections/{collection}/documents/1", `{"database_id": "{database}", "data": {"item": "mug"}}`},
+	{"DELETE", "/api/database-management/collections/{collection}/documents/1", `{"database_id": "{database}"}`},
+}
+
+func TestGrantsApplyHoweverCollectionsAreSpelled(t *testing.T) {
+	f := newRouteFixture(t)
+	writer := f.users[models.PermissionWrite]
+	for _, endpoint := range []string{"GET", "POST", "PUT", "DELETE"} {
+		if err := config.DB.Create(&models.APIEndpoint{DatabaseID: f.database.ID, Kind: models.EndpointKindCollection,
+			Collection: "ORDERS", Path: "/api/ORDERS", Method: endpoint, IsActive: true}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := map[string]string{"X-API-Key": f.keys[models.PermissionWrite].Key}
+
+	// The deny grant is saved with the catalog's spelling, then with another one
+	for _, denied := range []string{"orders", "Orders"} {
+		if err := config.DB.Model(&models.DatabaseAccess{}).Where("user_id = ?", writer.ID).Update("grants", models.AccessGrants{
+			{Collection: models.GrantAllCollections, Effect: models.GrantAllow, Access: models.PermissionWrite},
+			{Collection: denied, Effect: models.GrantDeny, Access: models.PermissionRead},
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		for _, spelling := range []string{"orders", "ORDERS", "Orders"} {
+			for _, route := range spelledRoutes {
+				path := strings.ReplaceAll(route.path, "{collection}", spelling)
+				if status, body := f.request(t, models.PermissionWrite, route.method, path, route.body, nil); status != fiber.StatusForbidden {
+					t.Errorf("grant on %s, %s %s: got %d %v, want 403", denied, route.method, path, status, body)
+				}
+			}
+		}
+
+		for _, route := range []struct{ method, path, body string }{
+			{"GET", "/api/ORDERS", ""},
+			{"GET", "/api/ORDERS/1", ""},
+			{"POST", "/api/ORDERS", `{"id": 3, "item": "ink", "region": "eu"}`},
+			{"PUT", "/api/ORDERS/1", `{"item": "mug"}`},
+			{"DELETE", "/api/ORDERS/1", ""},
+		} {
+			if status, body := f.request(t, models.PermissionWrite, route.method, route.path, route.body, header); status != fiber.StatusForbidden {
+				t.Errorf("grant on %s, %s %s with an API key: got %d %v, want 403", denied, route.method, route.path, status, body)
+			}
+		}
+	}
+}
+
+// TestAPIKeysCannotProbeUnreadableKeyColumns checks that reading a record by its key
+// needs read access to the key columns, which the value of the key would disclose
+func TestAPIKeysCannotProbeUnreadableKeyColumns(t *testing.T) {
+	f := newRouteFixture(t)
+	reader := f.users[models.PermissionRead]
+	if err := config.DB.Model(&models.DatabaseAccess{}).Where("user_id = ?", reader.ID).Update("grants", models.AccessGrants{
+		{Collection: "orders", Effect: models.GrantAllow, Access: models.PermissionRead},
+		{Collection: "orders", Columns: []string{"ID"}, Effect: models.GrantDeny, Access: models.PermissionRead},
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	header := map[string]string{"X-API-Key": f.keys[models.PermissionRead].Key}
+
+	for _, path := range []string{"/api/orders/1", "/api/orders/3"} {
+		if status, body := f.request(t, models.PermissionRead, "GET", path, "", header); status != fiber.StatusForbidden {
+			t.Errorf("GET %s: got %d %v, want 403", path, status, body)
+		}
+	}
+	status, body := f.request(t, models.PermissionRead, "GET", "/api/orders", "", header)
+	documents, _ := body.(map[string]interface{})["data"].([]interface{})
+	if status != fiber.StatusOK || len(documents) != 2 {
+		t.Fatalf("GET /api/orders: got %d %v, want both orders", status, body)
+	}
+	if _, ok := documents[0].(map[string]interface{})["id"]; ok {
+		t.Fatalf("the key read %v, including the denied id column", documents[0])
+	}
+}
+
+func TestRowFiltersApplyHoweverCollectionsAreSpelled(t *testing.T) {
+	f := newRouteFixture(t)
+	reader := f.users[models.PermissionRead]
+	eu := json.RawMessage(`{"field": "region", "operator": "eq", "value": "eu"}`)
+
+	for _, key := range []string{"orders", "Orders"} {
+		if err := config.DB.Model(&models.DatabaseAccess{}).Where("user_id = ?", reader.ID).
+			Update("row_filters", models.RowFilters{key: eu}).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, spelling := range []string{"orders", "ORDERS", "Orders"} {
+			path := "/api/database-management/collections/" + spelling + "/documents?database_id={database}"
+			status, body := f.request(t, models.PermissionRead, "GET", path, "", nil)
+			documents, _ := body.(map[string]interface{})["documents"].([]interface{})
+			if status != fiber.StatusOK || len(documents) != 1 {
+				t.Errorf("filter on %s, GET %s: got %d %v, want the one order of the user's region", key, path, status, body)
+			}
+		}
+	}
+
+	owner := f.keys[models.PermissionOwner]
+	if err := config.DB.Model(&owner).Update("row_filters", models.RowFilters{"ORDERS": eu}).Error; err != nil {
+		t.Fatal(err)
+	}
+	status, body := f.request(t, models.PermissionOwner, "GET", "/api/orders", "", map[string]string{"X-API-Key": owner.Key})
+	documents, _ := body.(map[string]interface{})["data"].([]interface{})
+	if status != fiber.StatusOK || len(documents) != 1 {
+		t.Fatalf("key filtered on ORDERS, GET /api/orders: got %d %v, want the one order of the key's region", status, body)
+	}
+}
+
+func TestRowFiltersKeyedByOneSpellingPerCollection(t *testing.T) {
+	f := newRouteFixture(t)
+	body := `{"database_id": "{database}", "user_id": "{target}", "row_filters": {
+		"orders": {"field": "region", "operator": "eq", "value": "eu"},
+		"ORDERS": {"field": "region", "operator": "eq", "value": "us"}}}`
+	if status, response := f.request(t, models.PermissionOwner, "PUT", "/api/sharing/access/row-filters", body, nil); status != fiber.StatusBadRequest {
+		t.Fatalf("got %d %v for filters of two spellings of a table, want 400", status, response)
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+
+	"db-manager-backend/models"
+	"db-manager-backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// RotateCredentialKeys re-encrypts every stored connection that is not sealed under the
+// current master key, including legacy plain text rows. Records are decrypted with the
+// key version they were written with, so previous keys must remain configured until
+// the rotation has completed. It returns the number of re-encrypted records.
+func RotateCredentialKeys(db *gorm.DB) (int, error) {
+	keyring := utils.CredentialKeyring()
+	if !keyring.Enabled() {
+		return 0, errors.New("no master key configured, set ENCRYPTION_KEY or ENCRYPTION_KEY_FILE")
+	}
+
+	rotated := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var connections []models.DatabaseConnection
+		result := tx.Unscoped().
+			Where("key_version IS NULL OR key_version <> ?", keyring.CurrentVersion()).
+			FindInBatches(&connections, 100, func(batch *gorm.DB, _ int) error {
+				for i := range connections {
+					// AfterFind already decrypted the record with its previous key
+					conn := &connections[i]
+					if err := conn.EncryptSecrets(); err != nil {
+						return err
+					}
+
+					// UpdateColumns skips the save hooks and leaves updated_at untouched
+					err := tx.Unscoped().Model(&models.DatabaseConnection{}).Where("id = ?", conn.ID).
+						UpdateColumns(map[string]interface{}{
+							"password":          conn.Password,
+							"ssl_key":           conn.SSLKey,
+							"connection_string": conn.ConnectionString,
+							"ssh_password":      conn.SSHPassword,
+							"ssh_private_key":   conn.SSHPrivateKey,
+							"key_version":       conn.KeyVersion,
+							"data_key":          conn.DataKey,
+						}).Error
+					if err != nil {
+						return err
+					}
+					rotated++
+				}
+				return nil
+			})
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rotated, nil
+}
@@ -2,30 +2,37 @@ package services
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
+	"errors"
 	"time"
 
 	"db-manager-backend/models"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"gorm.io/driver/mysql"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
 type DatabaseService struct{}
 
 type ConnectionParams struct {
-	Type     string `json:"type"`
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Database string `json:"database"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Type             string `json:"type"`
+	Host             string `json:"host"`
+	Port             int    `json:"port"`
+	Database         string `json:"database"`
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	AuthMethod       string `json:"auth_method"`
+	SSLMode          string `json:"ssl_mode"`
+	SSLCert          string `json:"ssl_cert"`
+	SSLKey           string `json:"ssl_key"`
+	SSLRootCert      string `json:"ssl_root_cert"`
+	ConnectionString string `json:"connection_string"` // replaces host/port fields when set
+	// Optional SSH tunnel
+	SSHHost            string `json:"ssh_host"`
+	SSHPort            int    `json:"ssh_port"`
+	SSHUser            string `json:"ssh_user"`
+	SSHPassword        string `json:"ssh_password"`
+	SSHPrivateKey      string `json:"ssh_private_key"`
+	SSHHostFingerprint string `json:"ssh_host_fingerprint"`
 }
 
 type DatabaseInfo struct {
@@ -38,301 +45,164 @@ func NewDatabaseService() *DatabaseService {
 	return &DatabaseService{}
 }
 
-func (ds *DatabaseService) TestConnection(params ConnectionParams) error {
-	switch params.Type {
-	case "mysql":
-		return ds.testMySQLConnection(params)
-	case "postgres":
-		return ds.testPostgreSQLConnection(params)
-	case "mongodb":
-		return ds.testMongoDBConnection(params)
-	case "mariadb":
-		return ds.testMySQLConnection(params) // MariaDB uses MySQL driver
-	case "sqlite":
-		return ds.testSQLiteConnection(params)
-	case "redis":
-		return ds.testRedisConnection(params)
-	case "oracle":
-		return ds.testGenericConnection(params, "oracle")
-	case "sqlserver":
-		return ds.testGenericConnection(params, "sqlserver")
-	case "cassandra":
-		return ds.testGenericConnection(params, "cassandra")
-	case "elasticsearch":
-		return ds.testElasticsearchConnection(params)
-	case "influxdb":
-		return ds.testGenericConnection(params, "influxdb")
-	case "cockroachdb":
-		return ds.testPostgreSQLConnection(params) // CockroachDB uses PostgreSQL protocol
-	default:
-		return fmt.Errorf("unsupported database type: %s", params.Type)
+// Connection converts request parameters into an unsaved connection model
+func (p ConnectionParams) Connection() *models.DatabaseConnection {
+	conn := &models.DatabaseConnection{}
+	p.Apply(conn)
+	return conn
+}
+
+// Apply copies the parameters onto a connection model, keeping its identity and metadata
+func (p ConnectionParams) Apply(conn *models.DatabaseConnection) {
+	conn.Type = p.Type
+	conn.Host = p.Host
+	conn.Port = p.Port
+	conn.Database = p.Database
+	conn.Username = p.Username
+	conn.Password = p.Password
+	conn.AuthMethod = p.AuthMethod
+	conn.SSLMode = p.SSLMode
+	conn.SSLCert = p.SSLCert
+	conn.SSLKey = p.SSLKey
+	conn.SSLRootCert = p.SSLRootCert
+	conn.ConnectionString = p.ConnectionString
+	conn.SSHHost = p.SSHHost
+	conn.SSHPort = p.SSHPort
+	conn.SSHUser = p.SSHUser
+	conn.SSHPassword = p.SSHPassword
+	conn.SSHPrivateKey = p.SSHPrivateKey
+	conn.SSHHostFingerprint = p.SSHHostFingerprint
+}
+
+// ConnectionParamsFrom extracts the connection parameters of a saved connection
+func ConnectionParamsFrom(conn *models.DatabaseConnection) ConnectionParams {
+	return ConnectionParams{
+		Type:               conn.Type,
+		Host:               conn.Host,
+		Port:               conn.Port,
+		Database:           conn.Database,
+		Username:           conn.Username,
+		Password:           conn.Password,
+		AuthMethod:         conn.AuthMethod,
+		SSLMode:            conn.SSLMode,
+		SSLCert:            conn.SSLCert,
+		SSLKey:             conn.SSLKey,
+		SSLRootCert:        conn.SSLRootCert,
+		ConnectionString:   conn.ConnectionString,
+		SSHHost:            conn.SSHHost,
+		SSHPort:            conn.SSHPort,
+		SSHUser:            conn.SSHUser,
+		SSHPassword:        conn.SSHPassword,
+		SSHPrivateKey:      conn.SSHPrivateKey,
+		SSHHostFingerprint: conn.SSHHostFingerprint,
 	}
 }
 
-func (ds *DatabaseService) testMySQLConnection(params ConnectionParams) error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		params.Username, params.Password, params.Host, params.Port, params.Database)
-	
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+func (ds *DatabaseService) TestConnection(params ConnectionParams) error {
+	driver, err := GetDriver(params.Type)
 	if err != nil {
 		return err
 	}
 
-	sqlDB, err := db.DB()
-	if err != nil {
-		return err
+	if params.AuthMethod == AuthMethodConnectionString && params.ConnectionString == "" {
+		return errors.New("connection string is required")
 	}
-	defer sqlDB.Close()
 
-	return sqlDB.Ping()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return ds.test(ctx, driver, params.Connection())
 }
 
-func (ds *DatabaseService) testPostgreSQLConnection(params ConnectionParams) error {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Asia/Shanghai",
-		params.Host, params.Username, params.Password, params.Database, params.Port)
-	
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// Test checks that a saved connection can be opened, without keeping a session
+func (ds *DatabaseService) Test(ctx context.Context, connection *models.DatabaseConnection) error {
+	driver, err := GetDriver(connection.Type)
 	if err != nil {
 		return err
 	}
+	return ds.test(ctx, driver, connection)
+}
 
-	sqlDB, err := db.DB()
+func (ds *DatabaseService) test(ctx context.Context, driver Driver, connection *models.DatabaseConnection) error {
+	connection, releaseTunnel, err := withSSHTunnel(ctx, connection)
 	if err != nil {
 		return err
 	}
-	defer sqlDB.Close()
-
-	return sqlDB.Ping()
+	defer releaseTunnel()
+	return driver.Test(ctx, connection)
 }
 
-func (ds *DatabaseService) testMongoDBConnection(params ConnectionParams) error {
+func (ds *DatabaseService) GetDatabaseInfo(params ConnectionParams) (*DatabaseInfo, error) {
+	driver, err := GetDriver(params.Type)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var uri string
-	if params.Username != "" && params.Password != "" {
-		uri = fmt.Sprintf("mongodb://%s:%s@%s:%d/%s",
-			params.Username, params.Password, params.Host, params.Port, params.Database)
-	} else {
-		uri = fmt.Sprintf("mongodb://%s:%d/%s", params.Host, params.Port, params.Database)
-	}
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	connection, releaseTunnel, err := withSSHTunnel(ctx, params.Connection())
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer client.Disconnect(ctx)
+	defer releaseTunnel()
 
-	return client.Ping(ctx, nil)
-}
-
-func (ds *DatabaseService) GetDatabaseInfo(params ConnectionParams) (*DatabaseInfo, error) {
-	switch params.Type {
-	case "mysql":
-		return ds.getMySQLInfo(params)
-	case "postgres":
-		return ds.getPostgreSQLInfo(params)
-	case "mongodb":
-		return ds.getMongoDBInfo(params)
-	case "mariadb":
-		return ds.getMySQLInfo(params) // MariaDB uses MySQL protocol
-	case "cockroachdb":
-		return ds.getPostgreSQLInfo(params) // CockroachDB uses PostgreSQL protocol
-	default:
+	conn, err := driver.Open(ctx, connection)
+	if errors.Is(err, ErrUnsupported) {
 		// For other database types, return basic info
 		return &DatabaseInfo{
 			Name:   params.Database,
 			Tables: []string{"Connection established - Schema browsing not yet implemented for " + params.Type},
 		}, nil
 	}
-}
-
-func (ds *DatabaseService) getMySQLInfo(params ConnectionParams) (*DatabaseInfo, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		params.Username, params.Password, params.Host, params.Port, params.Database)
-	
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	rows, err := db.Query("SHOW TABLES")
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var tables []string
-	for rows.Next() {
-		var table string
-		if err := rows.Scan(&table); err != nil {
-			return nil, err
-		}
-		tables = append(tables, table)
-	}
-
-	return &DatabaseInfo{
-		Name:   params.Database,
-		Tables: tables,
-	}, nil
-}
-
-func (ds *DatabaseService) getPostgreSQLInfo(params ConnectionParams) (*DatabaseInfo, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
-		params.Host, params.Username, params.Password, params.Database, params.Port)
-	
-	db, err := sql.Open("postgres", dsn)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
+	defer conn.Close()
 
-	rows, err := db.Query("SELECT tablename FROM pg_tables WHERE schemaname = 'public'")
+	names, err := conn.ListCollections(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var tables []string
-	for rows.Next() {
-		var table string
-		if err := rows.Scan(&table); err != nil {
-			return nil, err
-		}
-		tables = append(tables, table)
-	}
-
-	return &DatabaseInfo{
-		Name:   params.Database,
-		Tables: tables,
-	}, nil
-}
 
-func (ds *DatabaseService) getMongoDBInfo(params ConnectionParams) (*DatabaseInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var uri string
-	if params.Username != "" && params.Password != "" {
-		uri = fmt.Sprintf("mongodb://%s:%s@%s:%d/%s",
-			params.Username, params.Password, params.Host, params.Port, params.Database)
+	info := &DatabaseInfo{Name: params.Database}
+	if driver.Kind() == KindDocument {
+		info.Collections = names
 	} else {
-		uri = fmt.Sprintf("mongodb://%s:%d/%s", params.Host, params.Port, params.Database)
-	}
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
-	if err != nil {
-		return nil, err
-	}
-	defer client.Disconnect(ctx)
-
-	database := client.Database(params.Database)
-	collections, err := database.ListCollectionNames(ctx, nil)
-	if err != nil {
-		return nil, err
+		info.Tables = names
 	}
-
-	return &DatabaseInfo{
-		Name:        params.Database,
-		Collections: collections,
-	}, nil
-}
-
-// Additional database connection testers
-func (ds *DatabaseService) testSQLiteConnection(params ConnectionParams) error {
-	// For SQLite, we just try to ping the host/port if provided
-	// In real implementation, you would test file access
-	return nil // SQLite doesn't require network connection testing
-}
-
-func (ds *DatabaseService) testRedisConnection(params ConnectionParams) error {
-	// Basic network connectivity test for Redis
-	// In production, you would use redis client library
-	return ds.testNetworkConnectivity(params)
+	return info, nil
 }
 
-func (ds *DatabaseService) testElasticsearchConnection(params ConnectionParams) error {
-	// Basic HTTP connectivity test for Elasticsearch
-	// In production, you would use elasticsearch client
-	return ds.testNetworkConnectivity(params)
-}
-
-func (ds *DatabaseService) testGenericConnection(params ConnectionParams, dbType string) error {
-	// Generic network connectivity test for other databases
-	// In production, each would have specific client implementations
-	return ds.testNetworkConnectivity(params)
-}
-
-func (ds *DatabaseService) testNetworkConnectivity(params ConnectionParams) error {
-	// Basic TCP connectivity test
-	address := fmt.Sprintf("%s:%d", params.Host, params.Port)
-	conn, err := sql.Open("mysql", fmt.Sprintf("tcp(%s)", address))
+// Kind reports the driver kind for a database type, or an empty string if unknown
+func (ds *DatabaseService) Kind(dbType string) string {
+	driver, err := GetDriver(dbType)
 	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %v", address, err)
+		return ""
 	}
-	defer conn.Close()
-	
-	// For basic connectivity test, we don't actually ping
-	// In production, each database type should have proper client testing
-	return nil
+	return driver.Kind()
 }
 
-// ConnectMongoDB connects to MongoDB using connection info
-func (ds *DatabaseService) ConnectMongoDB(connection models.DatabaseConnection) (*mongo.Client, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var uri string
-	if connection.Username != "" && connection.Password != "" {
-		uri = fmt.Sprintf("mongodb://%s:%s@%s:%d/%s",
-			connection.Username, connection.Password, connection.Host, connection.Port, connection.Database)
-	} else {
-		uri = fmt.Sprintf("mongodb://%s:%d/%s", connection.Host, connection.Port, connection.Database)
-	}
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+// Open starts a session on a saved connection through its registered driver. The
+// returned function closes the session together with its SSH tunnel and must be used
+// instead of closing the session directly.
+func (ds *DatabaseService) Open(ctx context.Context, connection *models.DatabaseConnection) (Conn, func(), error) {
+	driver, err := GetDriver(connection.Type)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Test the connection
-	if err := client.Ping(ctx, nil); err != nil {
-		client.Disconnect(ctx)
-		return nil, err
-	}
-
-	return client, nil
-}
-
-// ConnectSQL connects to SQL databases (MySQL, PostgreSQL)
-func (ds *DatabaseService) ConnectSQL(connection models.DatabaseConnection) (*sql.DB, error) {
-	var dsn string
-	var driver string
-
-	switch connection.Type {
-	case "mysql":
-		driver = "mysql"
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-			connection.Username, connection.Password, connection.Host, connection.Port, connection.Database)
-	case "postgresql", "postgres":
-		driver = "postgres"
-		dsn = fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
-			connection.Host, connection.Username, connection.Password, connection.Database, connection.Port)
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", connection.Type)
-	}
-
-	db, err := sql.Open(driver, dsn)
+	connection, releaseTunnel, err := withSSHTunnel(ctx, connection)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	// Test the connection
-	if err := db.Ping(); err != nil {
-		db.Close()
-		return nil, err
+	conn, err := driver.Open(ctx, connection)
+	if err != nil {
+		releaseTunnel()
+		return nil, nil, err
 	}
-
-	return db, nil
+	return conn, func() {
+		conn.Close()
+		releaseTunnel()
+	}, nil
 }
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"db-manager-backend/models"
+)
+
+// Driver kinds describe the data model a driver exposes
+const (
+	KindRelational = "relational"
+	KindDocument   = "document"
+	KindKeyValue   = "keyvalue"
+	KindNetwork    = "network"
+)
+
+var (
+	// ErrNotFound is returned when a record addressed by ID does not exist
+	ErrNotFound = errors.New("record not found")
+	// ErrInvalidID is returned when an ID cannot be converted to the driver's key type
+	ErrInvalidID = errors.New("invalid ID format")
+	// ErrUnknownType is returned when no driver is registered for a database type
+	ErrUnknownType = errors.New("unsupported database type")
+	// ErrUnsupported is returned when a driver does not implement an operation
+	ErrUnsupported = errors.New("operation not supported for this database type")
+	// ErrNoPrimaryKey is returned when records of a table cannot be addressed individually
+	ErrNoPrimaryKey = errors.New("table has no primary key")
+)
+
+// Document is a single row or document exchanged with a driver
+type Document map[string]interface{}
+
+// FieldInfo describes a column or document field
+type FieldInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// FindOptions controls listing of documents in a collection
+type FindOptions struct {
+	Search    string
+	SortField string
+	SortOrder string
+	Limit     int
+	Offset    int
+	Filters   []Filter     // AND-ed column conditions
+	Where     *FilterGroup // AND-ed with Filters
+	Order     []Sort       // takes precedence over SortField
+	Select    []string     // returned columns, all when empty
+	// Columns matched by Search, all when empty
+	SearchColumns []string
+}
+
+// RecordKey addresses a single record. ID is the identifier as it appears in the URL;
+// the values of a composite primary key are separated by commas in key order, with
+// commas inside values escaped as %2C. Columns names the key values instead of ID.
+// Records that do not match Scope are treated as not found.
+type RecordKey struct {
+	ID      string
+	Columns map[string]string
+	Scope   *FilterGroup
+}
+
+// IDKey returns the key of a record addressed by a single identifier
+func IDKey(id string) RecordKey {
+	return RecordKey{ID: id}
+}
+
+// Single returns the unescaped identifier of a single-column key
+func (k RecordKey) Single() string {
+	return unescapeKeyPart(k.ID)
+}
+
+// Values returns the key values matching the given key columns in order
+func (k RecordKey) Values(columns []string) ([]string, error) {
+	if len(k.Columns) > 0 {
+		if len(k.Columns) != len(columns) {
+			return nil, fmt.Errorf("%w: expected key columns %s", ErrInvalidID, strings.Join(columns, ", "))
+		}
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			value, ok := k.Columns[column]
+			if !ok {
+				return nil, fmt.Errorf("%w: expected key columns %s", ErrInvalidID, strings.Join(columns, ", "))
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+
+	if k.ID == "" {
+		return nil, ErrInvalidID
+	}
+	if len(columns) == 1 {
+		return []string{k.Single()}, nil
+	}
+
+	parts := strings.Split(k.ID, ",")
+	if len(parts) != len(columns) {
+		return nil, fmt.Errorf("%w: expected %d comma separated values for %s", ErrInvalidID, len(columns), strings.Join(columns, ", "))
+	}
+	for i, part := range parts {
+		parts[i] = unescapeKeyPart(part)
+	}
+	return parts, nil
+}
+
+// PrimaryKeyConn is implemented by sessions whose records are addressed by table columns
+type PrimaryKeyConn interface {
+	PrimaryKey(ctx context.Context, collection string) ([]string, error)
+}
+
+// CollectionResolver is implemented by sessions that match collection names ignoring
+// case. ResolveCollection returns the spelling of a collection in the catalog.
+type CollectionResolver interface {
+	ResolveCollection(ctx context.Context, collection string) (string, error)
+}
+
+// CanonicalCollection returns the name a session uses for a collection, so that
+// grants and row filters keyed by that name apply however a request spells it. Names
+// that do not resolve are returned unchanged, the session rejects them as well.
+func CanonicalCollection(ctx context.Context, conn Conn, collection string) string {
+	resolver, ok := conn.(CollectionResolver)
+	if !ok {
+		return collection
+	}
+	if name, err := resolver.ResolveCollection(ctx, collection); err == nil {
+		return name
+	}
+	return collection
+}
+
+// unescapeKeyPart decodes percent-escapes, keeping malformed values as they are
+func unescapeKeyPart(part string) string {
+	if unescaped, err := url.PathUnescape(part); err == nil {
+		return unescaped
+	}
+	return part
+}
+
+// Driver is implemented by every supported database engine
+type Driver interface {
+	// Kind reports the data model of the engine (relational, document, ...)
+	Kind() string
+	// Test verifies that the connection parameters are usable
+	Test(ctx context.Context, conn *models.DatabaseConnection) error
+	// Open establishes a session that can be reused until Close is called
+	Open(ctx context.Context, conn *models.DatabaseConnection) (Conn, error)
+}
+
+// Conn is an open session against a database
+type Conn interface {
+	ListCollections(ctx context.Context) ([]string, error)
+	Schema(ctx context.Context, collection string) ([]FieldInfo, error)
+	Find(ctx context.Context, collection string, opts FindOptions) ([]Document, error)
+	Count(ctx context.Context, collection string, opts FindOptions) (int64, error)
+	Get(ctx context.Context, collection string, key RecordKey) (Document, error)
+	Insert(ctx context.Context, collection string, doc Document) (interface{}, error)
+	Update(ctx context.Context, collection string, key RecordKey, doc Document) (int64, error)
+	Delete(ctx context.Context, collection string, key RecordKey) (int64, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// KeyInfo describes a key in a key-value store
+type KeyInfo struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	TTL  int64  `json:"ttl"` // seconds, -1 when the key does not expire
+}
+
+// KeyValue is a key together with its type-aware value
+type KeyValue struct {
+	KeyInfo
+	Length int64       `json:"length"`
+	Value  interface{} `json:"value"`
+}
+
+// KeyValueConn is implemented by sessions of key-value stores that support key browsing
+type KeyValueConn interface {
+	// ScanKeys iterates keys matching pattern; an empty returned cursor means the scan is complete
+	ScanKeys(ctx context.Context, pattern, cursor string, count int) ([]KeyInfo, string, error)
+	GetKey(ctx context.Context, key string) (*KeyValue, error)
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// RegisterDriver makes a driver available under the given type names
+func RegisterDriver(driver Driver, names ...string) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if _, exists := drivers[name]; exists {
+			panic("services: driver registered twice for " + name)
+		}
+		drivers[name] = driver
+	}
+}
+
+// GetDriver looks up the driver registered for a database type
+func GetDriver(dbType string) (Driver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	driver, ok := drivers[strings.ToLower(dbType)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, dbType)
+	}
+	return driver, nil
+}
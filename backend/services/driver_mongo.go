@@ -0,0 +1,868 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-manager-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+type mongoDriver struct{}
+
+func init() {
+	RegisterDriver(&mongoDriver{}, "mongodb")
+}
+
+func (d *mongoDriver) Kind() string {
+	return KindDocument
+}
+
+func (d *mongoDriver) Test(ctx context.Context, conn *models.DatabaseConnection) error {
+	client, err := connectMongo(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return client.Disconnect(ctx)
+}
+
+func (d *mongoDriver) Open(ctx context.Context, conn *models.DatabaseConnection) (Conn, error) {
+	client, err := connectMongo(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return &mongoConn{client: client, db: client.Database(mongoDatabaseName(conn))}, nil
+}
+
+// mongoURI builds the connection URI for a MongoDB connection
+func mongoURI(conn *models.DatabaseConnection) string {
+	if usesConnectionString(conn) {
+		return conn.ConnectionString
+	}
+
+	uri := url.URL{
+		Scheme: "mongodb",
+		Host:   net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port)),
+		Path:   "/" + conn.Database,
+	}
+	if conn.Username != "" && conn.Password != "" {
+		uri.User = url.UserPassword(conn.Username, conn.Password)
+	}
+	return uri.String()
+}
+
+// mongoDatabaseName falls back to the database named in the connection string
+func mongoDatabaseName(conn *models.DatabaseConnection) string {
+	if conn.Database != "" || !usesConnectionString(conn) {
+		return conn.Database
+	}
+	if cs, err := connstring.Parse(conn.ConnectionString); err == nil {
+		return cs.Database
+	}
+	return ""
+}
+
+// mongoClientOptions applies the connection URI and SSL settings
+func mongoClientOptions(conn *models.DatabaseConnection) (*options.ClientOptions, error) {
+	clientOptions := options.Client().ApplyURI(mongoURI(conn))
+	if err := clientOptions.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid MongoDB connection string: %v", err)
+	}
+
+	tlsConfig, err := buildTLSConfig(conn)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+
+	// Replica set discovery would bypass the local forward of an SSH tunnel
+	if usesSSHTunnel(conn) {
+		clientOptions.SetDirect(true)
+	}
+	return clientOptions, nil
+}
+
+// connectMongo connects and pings a MongoDB client
+func connectMongo(ctx context.Context, conn *models.DatabaseConnection) (*mongo.Client, error) {
+	clientOptions, err := mongoClientOptions(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test the connection
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+
+	return client, nil
+}
+
+type mongoConn struct {
+	client *mongo.Client
+	db     *mongo.Database
+
+	stringFields tableCache // collection -> fields holding strings, used by search
+}
+
+// Client exposes the underlying MongoDB client
+func (c *mongoConn) Client() *mongo.Client {
+	return c.client
+}
+
+func (c *mongoConn) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx, nil)
+}
+
+func (c *mongoConn) Close() error {
+	return c.client.Disconnect(context.Background())
+}
+
+func (c *mongoConn) ListCollections(ctx context.Context) ([]string, error) {
+	return c.db.ListCollectionNames(ctx, bson.D{})
+}
+
+func (c *mongoConn) Schema(ctx context.Context, collection string) ([]FieldInfo, error) {
+	// Sample documents to extract field names and types
+	cursor, err := c.db.Collection(collection).Find(ctx, bson.D{}, options.Find().SetLimit(10))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// Pre-allocate map with estimated capacity for memory efficiency
+	fieldSet := make(map[string]string, 20) // field name -> type
+	order := make([]string, 0, 20)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		for key, value := range doc {
+			if key == "_id" {
+				continue
+			}
+			if _, exists := fieldSet[key]; !exists {
+				fieldSet[key] = mongoInputType(key, value)
+				order = append(order, key)
+			}
+		}
+	}
+
+	fields := make([]FieldInfo, 0, len(order))
+	for _, name := range order {
+		fields = append(fields, FieldInfo{Name: name, Type: fieldSet[name]})
+	}
+	return fields, nil
+}
+
+// mongoInputType guesses a UI input type from a sampled value
+func mongoInputType(key string, value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		keyLower := strings.ToLower(key)
+		valueLower := strings.ToLower(v)
+		// Check if it looks like an image URL or file path
+		if strings.Contains(keyLower, "photo") ||
+			strings.Contains(keyLower, "image") ||
+			strings.Contains(keyLower, "picture") ||
+			strings.Contains(keyLower, "avatar") ||
+			strings.Contains(keyLower, "thumbnail") ||
+			strings.HasSuffix(valueLower, ".jpg") ||
+			strings.HasSuffix(valueLower, ".jpeg") ||
+			strings.HasSuffix(valueLower, ".png") ||
+			strings.HasSuffix(valueLower, ".gif") ||
+			strings.HasSuffix(valueLower, ".webp") {
+			return "image"
+		}
+		return "text"
+	case int, int32, int64, float32, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "text"
+	}
+}
+
+// Limits of schema inference for document collections
+const (
+	defaultSampleSize = 100
+	maxSampleSize     = 1000
+	maxInferDepth     = 4 // embedded documents deeper than this are reported as "object"
+)
+
+func (c *mongoConn) Introspect(ctx context.Context, collection string, sampleSize int) (*TableSchema, error) {
+	if sampleSize <= 0 {
+		sampleSize = defaultSampleSize
+	}
+	if sampleSize > maxSampleSize {
+		sampleSize = maxSampleSize
+	}
+
+	coll := c.db.Collection(collection)
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{{{Key: "$sample", Value: bson.D{{Key: "size", Value: sampleSize}}}}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []bson.D
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	schema := inferSchema(docs)
+	schema.Name = collection
+
+	indexes, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer indexes.Close(ctx)
+	for indexes.Next(ctx) {
+		var spec struct {
+			Name   string `bson:"name"`
+			Key    bson.D `bson:"key"`
+			Unique bool   `bson:"unique"`
+		}
+		if err := indexes.Decode(&spec); err != nil {
+			continue
+		}
+		index := IndexInfo{Name: spec.Name, Unique: spec.Unique, Primary: spec.Name == "_id_"}
+		for _, key := range spec.Key {
+			index.Columns = append(index.Columns, key.Key)
+		}
+		// _id is always unique even though its index does not say so
+		index.Unique = index.Unique || index.Primary
+		schema.Indexes = append(schema.Indexes, index)
+	}
+	if err := indexes.Err(); err != nil {
+		return nil, err
+	}
+
+	finishSchema(schema)
+	return schema, nil
+}
+
+// fieldStats accumulates the types seen for one field path across sampled documents
+type fieldStats struct {
+	count  int
+	types  map[string]int
+	order  []string               // types in order of first appearance
+	sample map[string]interface{} // first value seen per type
+}
+
+// inferSchema derives fields, their types and how often they occur from sampled
+// documents. Embedded documents are flattened into dotted paths.
+func inferSchema(docs []bson.D) *TableSchema {
+	stats := make(map[string]*fieldStats)
+	var paths []string
+
+	var walk func(doc bson.D, prefix string, depth int)
+	walk = func(doc bson.D, prefix string, depth int) {
+		for _, elem := range doc {
+			path := prefix + elem.Key
+			field := stats[path]
+			if field == nil {
+				field = &fieldStats{types: make(map[string]int), sample: make(map[string]interface{})}
+				stats[path] = field
+				paths = append(paths, path)
+			}
+
+			bsonType := bsonTypeName(elem.Value)
+			field.count++
+			if field.types[bsonType] == 0 {
+				field.order = append(field.order, bsonType)
+				field.sample[bsonType] = elem.Value
+			}
+			field.types[bsonType]++
+
+			if depth < maxInferDepth {
+				switch embedded := elem.Value.(type) {
+				case bson.D:
+					walk(embedded, path+".", depth+1)
+				case bson.M:
+					walk(mapToD(embedded), path+".", depth+1)
+				}
+			}
+		}
+	}
+	for _, doc := range docs {
+		walk(doc, "", 1)
+	}
+
+	schema := &TableSchema{Inferred: true, SampleSize: len(docs), Columns: make([]ColumnInfo, 0, len(paths))}
+	for _, path := range paths {
+		field := stats[path]
+		column := ColumnInfo{
+			Name:      path,
+			Frequency: float64(field.count) / float64(len(docs)),
+			Optional:  field.count < len(docs),
+			Nullable:  field.types["null"] > 0,
+			Types:     make([]TypeFrequency, 0, len(field.order)),
+		}
+		for _, bsonType := range field.order {
+			column.Types = append(column.Types, TypeFrequency{
+				Type:      bsonType,
+				Count:     field.types[bsonType],
+				Frequency: float64(field.types[bsonType]) / float64(field.count),
+			})
+		}
+		// Most frequent first, ties keep the order of first appearance
+		sort.SliceStable(column.Types, func(i, j int) bool {
+			return column.Types[i].Count > column.Types[j].Count
+		})
+
+		// The native type is the dominant non-null type
+		column.NativeType = "null"
+		for _, t := range column.Types {
+			if t.Type != "null" {
+				column.NativeType = t.Type
+				break
+			}
+		}
+		column.InputType = mongoInputType(path, field.sample[column.NativeType])
+		if column.NativeType == "date" {
+			column.InputType = "datetime-local"
+		}
+		schema.Columns = append(schema.Columns, column)
+	}
+	return schema
+}
+
+// bsonTypeName returns the MongoDB type alias ($type name) of a decoded value
+func bsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case int32:
+		return "int"
+	case int64:
+		return "long"
+	case float64:
+		return "double"
+	case bool:
+		return "bool"
+	case primitive.ObjectID:
+		return "objectId"
+	case primitive.DateTime:
+		return "date"
+	case primitive.Decimal128:
+		return "decimal"
+	case primitive.Binary:
+		return "binData"
+	case primitive.Timestamp:
+		return "timestamp"
+	case primitive.Regex:
+		return "regex"
+	case bson.A:
+		return "array"
+	case bson.D, bson.M:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// mapToD converts a map to a document with keys in sorted order
+func mapToD(m bson.M) bson.D {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	doc := make(bson.D, 0, len(keys))
+	for _, key := range keys {
+		doc = append(doc, bson.E{Key: key, Value: m[key]})
+	}
+	return doc
+}
+
+// searchFallbackFields are searched when sampling finds no string fields
+var searchFallbackFields = []string{"name", "title", "description", "content"}
+
+// searchFields returns the string fields of a collection, inferred from a sample of
+// its documents and cached like SQL table metadata
+func (c *mongoConn) searchFields(ctx context.Context, collection string) []string {
+	if fields, ok := c.stringFields.get(collection); ok {
+		return fields
+	}
+
+	schema, err := c.Introspect(ctx, collection, defaultSampleSize)
+	if err != nil {
+		return searchFallbackFields
+	}
+	var fields []string
+	for _, column := range schema.Columns {
+		for _, t := range column.Types {
+			if t.Type == "string" {
+				fields = append(fields, column.Name)
+				break
+			}
+		}
+	}
+	if len(fields) == 0 {
+		fields = searchFallbackFields
+	}
+	c.stringFields.set(collection, fields)
+	return fields
+}
+
+// searchFilter builds a case-insensitive filter matching the search term literally
+// in any string field, limited to SearchColumns when set
+func (c *mongoConn) searchFilter(ctx context.Context, collection string, opts FindOptions) bson.D {
+	if opts.Search == "" {
+		return bson.D{}
+	}
+
+	searchRegex := primitive.Regex{Pattern: regexp.QuoteMeta(opts.Search), Options: "i"}
+	fields := opts.searchable(c.searchFields(ctx, collection))
+	if len(fields) == 0 {
+		// No field may be searched, match nothing
+		return bson.D{{Key: "_id", Value: bson.D{{Key: "$exists", Value: false}}}}
+	}
+	conditions := make(bson.A, 0, len(fields))
+	for _, field := range fields {
+		conditions = append(conditions, bson.D{{Key: field, Value: searchRegex}})
+	}
+	return bson.D{{Key: "$or", Value: conditions}}
+}
+
+// findFilter combines the search term, the field filters and the filter tree into
+// one query
+func (c *mongoConn) findFilter(ctx context.Context, collection string, opts FindOptions) (bson.D, error) {
+	for _, field := range opts.Columns() {
+		if !validMongoField(field) {
+			return nil, fmt.Errorf("%w: invalid field name %q", ErrInvalidQuery, field)
+		}
+	}
+
+	conditions := make(bson.A, 0, len(opts.Filters)+2)
+	if search := c.searchFilter(ctx, collection, opts); len(search) > 0 {
+		conditions = append(conditions, search)
+	}
+	for _, f := range opts.Filters {
+		conditions = append(conditions, mongoCondition(f))
+	}
+	if opts.Where != nil {
+		if group := mongoGroup(*opts.Where); group != nil {
+			conditions = append(conditions, group)
+		}
+	}
+
+	switch len(conditions) {
+	case 0:
+		return bson.D{}, nil
+	case 1:
+		return conditions[0].(bson.D), nil
+	default:
+		return bson.D{{Key: "$and", Value: conditions}}, nil
+	}
+}
+
+// mongoGroup translates a filter group into an $and or $or query, nil when empty
+func mongoGroup(group FilterGroup) bson.D {
+	conditions := make(bson.A, 0, len(group.Filters)+len(group.Groups))
+	for _, f := range group.Filters {
+		conditions = append(conditions, mongoCondition(f))
+	}
+	for _, nested := range group.Groups {
+		if condition := mongoGroup(nested); condition != nil {
+			conditions = append(conditions, condition)
+		}
+	}
+
+	if len(conditions) == 0 {
+		return nil
+	}
+	operator := "$and"
+	if group.Or {
+		operator = "$or"
+	}
+	return bson.D{{Key: operator, Value: conditions}}
+}
+
+// validMongoField rejects operators and malformed dotted paths used as field names
+func validMongoField(field string) bool {
+	if field == "" || strings.ContainsRune(field, 0) {
+		return false
+	}
+	for _, part := range strings.Split(field, ".") {
+		if part == "" || strings.HasPrefix(part, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// mongoCondition translates a filter into a query on its field
+func mongoCondition(f Filter) bson.D {
+	var condition interface{}
+	switch f.Operator {
+	case OpEq, OpNeq:
+		operator := "$in"
+		if (f.Operator == OpNeq) != f.Negate {
+			operator = "$nin"
+		}
+		condition = bson.D{{Key: operator, Value: mongoValues(f.Value)}}
+	case OpIn:
+		var values bson.A
+		for _, value := range f.Values {
+			values = append(values, mongoValues(value)...)
+		}
+		operator := "$in"
+		if f.Negate {
+			operator = "$nin"
+		}
+		condition = bson.D{{Key: operator, Value: values}}
+	case OpIs:
+		var value interface{}
+		if f.Value != "null" {
+			value = f.Value == "true"
+		}
+		condition = value
+		if f.Negate {
+			condition = bson.D{{Key: "$ne", Value: value}}
+		}
+	default:
+		var expression interface{}
+		switch f.Operator {
+		case OpLike, OpIlike:
+			regex := primitive.Regex{Pattern: wildcardRegex(f.text())}
+			if f.Operator == OpIlike {
+				regex.Options = "i"
+			}
+			expression = regex
+		default:
+			expression = bson.D{{Key: "$" + f.Operator, Value: mongoValue(f.Value)}}
+		}
+		condition = expression
+		if f.Negate {
+			condition = bson.D{{Key: "$not", Value: expression}}
+		}
+	}
+	return bson.D{{Key: f.Column, Value: condition}}
+}
+
+// mongoValues lists the typed interpretations of a query string value together with
+// the string itself, so equality matches however the field is stored. Typed JSON
+// values are used as they are.
+func mongoValues(operand interface{}) bson.A {
+	value, ok := operand.(string)
+	if !ok {
+		return bson.A{operand}
+	}
+
+	values := bson.A{}
+	if typed := mongoValue(value); typed != value {
+		values = append(values, typed)
+	}
+	if objectID, err := primitive.ObjectIDFromHex(value); err == nil {
+		values = append(values, objectID)
+	}
+	if value == "true" || value == "false" {
+		values = append(values, value == "true")
+	}
+	return append(values, value)
+}
+
+// mongoValue converts a query string value to a number or date when it looks like one
+func mongoValue(operand interface{}) interface{} {
+	value, ok := operand.(string)
+	if !ok {
+		return operand
+	}
+	if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return number
+	}
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return primitive.NewDateTimeFromTime(t)
+	}
+	return value
+}
+
+// wildcardRegex converts a * wildcard pattern to an anchored regular expression
+func wildcardRegex(pattern string) string {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return "^" + strings.Join(parts, ".*") + "$"
+}
+
+// findSort and findProjection translate the order and field selection of Find
+func findSort(opts FindOptions) bson.D {
+	order := opts.sortOrder()
+	if len(order) == 0 {
+		return nil
+	}
+	sortFields := make(bson.D, 0, len(order))
+	for _, field := range order {
+		sortDirection := 1
+		if field.Desc {
+			sortDirection = -1
+		}
+		sortFields = append(sortFields, bson.E{Key: field.Column, Value: sortDirection})
+	}
+	return sortFields
+}
+
+func findProjection(opts FindOptions) bson.D {
+	if len(opts.Select) == 0 {
+		return nil
+	}
+	projection := make(bson.D, 0, len(opts.Select))
+	for _, field := range opts.Select {
+		projection = append(projection, bson.E{Key: field, Value: 1})
+	}
+	return projection
+}
+
+func (c *mongoConn) Find(ctx context.Context, collection string, opts FindOptions) ([]Document, error) {
+	filter, err := c.findFilter(ctx, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	findOptions := options.Find()
+	if sortFields := findSort(opts); sortFields != nil {
+		findOptions.SetSort(sortFields)
+	}
+	if projection := findProjection(opts); projection != nil {
+		findOptions.SetProjection(projection)
+	}
+	if opts.Offset > 0 {
+		findOptions.SetSkip(int64(opts.Offset))
+	}
+	if opts.Limit > 0 {
+		findOptions.SetLimit(int64(opts.Limit))
+	}
+
+	cursor, err := c.db.Collection(collection).Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	capacity := opts.Limit
+	if capacity < 0 {
+		capacity = 0
+	}
+	documents := make([]Document, 0, capacity)
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		documents = append(documents, mongoDocument(doc))
+	}
+	return documents, cursor.Err()
+}
+
+func (c *mongoConn) Count(ctx context.Context, collection string, opts FindOptions) (int64, error) {
+	filter, err := c.findFilter(ctx, collection, opts)
+	if err != nil {
+		return 0, err
+	}
+	return c.db.Collection(collection).CountDocuments(ctx, filter)
+}
+
+// KeysetOrder completes the sort order with _id
+func (c *mongoConn) KeysetOrder(ctx context.Context, collection string, opts FindOptions) ([]Sort, error) {
+	return keysetOrder(opts.sortOrder(), []string{"_id"}), nil
+}
+
+// Estimate returns the document count from the collection metadata
+func (c *mongoConn) Estimate(ctx context.Context, collection string) (int64, error) {
+	return c.db.Collection(collection).EstimatedDocumentCount(ctx)
+}
+
+func (c *mongoConn) Get(ctx context.Context, collection string, key RecordKey) (Document, error) {
+	var doc bson.M
+	err := matchMongoID(key, func(filter bson.D) (bool, error) {
+		err := c.db.Collection(collection).FindOne(ctx, filter).Decode(&doc)
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mongoDocument(doc), nil
+}
+
+func (c *mongoConn) Insert(ctx context.Context, collection string, doc Document) (interface{}, error) {
+	result, err := c.db.Collection(collection).InsertOne(ctx, bson.M(doc))
+	if err != nil {
+		return nil, err
+	}
+	return result.InsertedID, nil
+}
+
+func (c *mongoConn) Update(ctx context.Context, collection string, key RecordKey, doc Document) (int64, error) {
+	update := bson.D{bson.E{Key: "$set", Value: bson.M(doc)}}
+
+	var modified int64
+	err := matchMongoID(key, func(filter bson.D) (bool, error) {
+		result, err := c.db.Collection(collection).UpdateOne(ctx, filter, update)
+		if err != nil {
+			return false, err
+		}
+		modified = result.ModifiedCount
+		return result.MatchedCount > 0, nil
+	})
+	return modified, err
+}
+
+func (c *mongoConn) Delete(ctx context.Context, collection string, key RecordKey) (int64, error) {
+	var deleted int64
+	err := matchMongoID(key, func(filter bson.D) (bool, error) {
+		result, err := c.db.Collection(collection).DeleteOne(ctx, filter)
+		if err != nil {
+			return false, err
+		}
+		deleted = result.DeletedCount
+		return deleted > 0, nil
+	})
+	return deleted, err
+}
+
+// matchMongoID runs op with an _id filter, limited to the scope of the key, for each
+// interpretation of the key until one matches a document
+func matchMongoID(key RecordKey, op func(filter bson.D) (bool, error)) error {
+	id := key.Single()
+	if len(key.Columns) > 0 {
+		value, ok := key.Columns["_id"]
+		if !ok || len(key.Columns) != 1 {
+			return fmt.Errorf("%w: expected key column _id", ErrInvalidID)
+		}
+		id = value
+	}
+
+	candidates, err := mongoIDCandidates(id)
+	if err != nil {
+		return err
+	}
+	var scope bson.D
+	if key.Scope != nil {
+		for _, field := range key.Scope.columns(nil) {
+			if !validMongoField(field) {
+				return fmt.Errorf("%w: invalid field name %q", ErrInvalidQuery, field)
+			}
+		}
+		scope = mongoGroup(*key.Scope)
+	}
+	for _, candidate := range candidates {
+		filter := bson.D{bson.E{Key: "_id", Value: candidate}}
+		if scope != nil {
+			filter = bson.D{{Key: "$and", Value: bson.A{filter, scope}}}
+		}
+		found, err := op(filter)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// mongoIDCandidates lists the _id values an identifier from a URL may stand for.
+// Extended JSON such as {"$numberLong": "5"}, {"$binary": ...} or a quoted "string"
+// selects the type explicitly; otherwise ObjectID, integer and string are tried.
+func mongoIDCandidates(id string) ([]interface{}, error) {
+	if id == "" {
+		return nil, ErrInvalidID
+	}
+
+	if strings.HasPrefix(id, "{") || strings.HasPrefix(id, `"`) {
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON([]byte(`{"_id":`+id+`}`), false, &doc); err != nil || len(doc) != 1 {
+			return nil, fmt.Errorf("%w: invalid extended JSON", ErrInvalidID)
+		}
+		return []interface{}{doc[0].Value}, nil
+	}
+
+	candidates := make([]interface{}, 0, 3)
+	if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+		candidates = append(candidates, objectID)
+	}
+	// Numbers compare across int, long and double, so int64 matches all of them
+	if number, err := strconv.ParseInt(id, 10, 64); err == nil {
+		candidates = append(candidates, number)
+	}
+	return append(candidates, id), nil
+}
+
+// mongoIDString formats an _id so that mongoIDCandidates finds it again first
+func mongoIDString(id interface{}) string {
+	switch v := id.(type) {
+	case primitive.ObjectID:
+		return v.Hex()
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		candidates, err := mongoIDCandidates(v)
+		if err == nil && len(candidates) == 1 {
+			return v
+		}
+		// Quote strings that would be read as another type
+		quoted, _ := json.Marshal(v)
+		return string(quoted)
+	default:
+		encoded, err := bson.MarshalExtJSON(bson.D{bson.E{Key: "_id", Value: v}}, true, false)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		// Strip the {"_id": ...} wrapper
+		return strings.TrimSuffix(strings.TrimPrefix(string(encoded), `{"_id":`), "}")
+	}
+}
+
+// mongoDocument converts a decoded document, exposing _id as a string "id" that can
+// be used in URLs
+func mongoDocument(doc bson.M) Document {
+	if id, ok := doc["_id"]; ok {
+		doc["id"] = mongoIDString(id)
+	}
+	return Document(doc)
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"db-manager-backend/models"
+)
+
+// networkDriver covers engines that can be registered and tested but not browsed yet
+type networkDriver struct{}
+
+func init() {
+	RegisterDriver(&networkDriver{}, "oracle", "sqlserver", "cassandra", "elasticsearch", "influxdb")
+}
+
+func (d *networkDriver) Kind() string {
+	return KindNetwork
+}
+
+func (d *networkDriver) Test(ctx context.Context, conn *models.DatabaseConnection) error {
+	return testNetworkConnectivity(ctx, conn)
+}
+
+func (d *networkDriver) Open(ctx context.Context, conn *models.DatabaseConnection) (Conn, error) {
+	return nil, ErrUnsupported
+}
+
+// testNetworkConnectivity checks that the host accepts TCP connections on the port
+func testNetworkConnectivity(ctx context.Context, conn *models.DatabaseConnection) error {
+	address := net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port))
+
+	var dialer net.Dialer
+	tcpConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+	return tcpConn.Close()
+}
@@ -0,0 +1,490 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"db-manager-backend/models"
+)
+
+const (
+	// redisNamespaceSeparator splits "collection:id" style keys
+	redisNamespaceSeparator = ":"
+	// redisMaxElements caps how many members of a list/set/zset are returned
+	redisMaxElements = 1000
+	// redisScanLimit caps keys visited when listing namespaces or counting
+	redisScanLimit = 100000
+)
+
+// redisDriver exposes key namespaces ("users" for "users:42") as collections
+type redisDriver struct{}
+
+func init() {
+	RegisterDriver(&redisDriver{}, "redis")
+}
+
+func (d *redisDriver) Kind() string {
+	return KindKeyValue
+}
+
+func (d *redisDriver) Test(ctx context.Context, conn *models.DatabaseConnection) error {
+	session, err := d.Open(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return session.Close()
+}
+
+func (d *redisDriver) Open(ctx context.Context, conn *models.DatabaseConnection) (Conn, error) {
+	client, err := dialRESP(ctx, net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port)))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := redisHandshake(ctx, client, conn); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &redisConn{client: client}, nil
+}
+
+// redisHandshake authenticates, selects the logical database and pings the server
+func redisHandshake(ctx context.Context, client *respClient, conn *models.DatabaseConnection) error {
+	if conn.Password != "" {
+		args := []string{"AUTH", conn.Password}
+		if conn.Username != "" {
+			// Redis 6+ ACL authentication
+			args = []string{"AUTH", conn.Username, conn.Password}
+		}
+		if _, err := client.Do(ctx, args...); err != nil {
+			return fmt.Errorf("authentication failed: %v", err)
+		}
+	}
+
+	if conn.Database != "" {
+		if _, err := strconv.Atoi(conn.Database); err != nil {
+			return fmt.Errorf("Redis database must be a numeric index, got %q", conn.Database)
+		}
+		if _, err := client.Do(ctx, "SELECT", conn.Database); err != nil {
+			return fmt.Errorf("failed to select database %s: %v", conn.Database, err)
+		}
+	}
+
+	pong, err := respString(client.Do(ctx, "PING"))
+	if err != nil {
+		return err
+	}
+	if pong != "PONG" {
+		return fmt.Errorf("unexpected PING reply: %s", pong)
+	}
+	return nil
+}
+
+type redisConn struct {
+	client *respClient
+}
+
+func (c *redisConn) Ping(ctx context.Context) error {
+	_, err := c.client.Do(ctx, "PING")
+	return err
+}
+
+func (c *redisConn) Close() error {
+	return c.client.Close()
+}
+
+// scan runs a single SCAN step, returning the keys and the next cursor ("0" when done)
+func (c *redisConn) scan(ctx context.Context, pattern, cursor string, count int) ([]string, string, error) {
+	if cursor == "" {
+		cursor = "0"
+	}
+	args := []string{"SCAN", cursor}
+	if pattern != "" {
+		args = append(args, "MATCH", pattern)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", strconv.Itoa(count))
+	}
+
+	reply, err := c.client.Do(ctx, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	parts, ok := reply.([]interface{})
+	if !ok || len(parts) != 2 {
+		return nil, "", fmt.Errorf("unexpected SCAN reply")
+	}
+	next, err := respString(parts[0], nil)
+	if err != nil {
+		return nil, "", err
+	}
+	keys, err := respStrings(parts[1], nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, next, nil
+}
+
+// scanAll collects matching keys until the scan completes or limit keys were found
+func (c *redisConn) scanAll(ctx context.Context, pattern string, limit int) ([]string, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		batch, next, err := c.scan(ctx, pattern, cursor, 1000)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+		if next == "0" || (limit > 0 && len(keys) >= limit) {
+			break
+		}
+		cursor = next
+	}
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
+func (c *redisConn) keyInfo(ctx context.Context, key string) (KeyInfo, error) {
+	keyType, err := respString(c.client.Do(ctx, "TYPE", key))
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	if keyType == "none" {
+		return KeyInfo{}, ErrNotFound
+	}
+
+	ttl, err := respInt(c.client.Do(ctx, "TTL", key))
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	if ttl == -2 {
+		// The key expired between TYPE and TTL
+		return KeyInfo{}, ErrNotFound
+	}
+
+	return KeyInfo{Key: key, Type: keyType, TTL: ttl}, nil
+}
+
+func (c *redisConn) ScanKeys(ctx context.Context, pattern, cursor string, count int) ([]KeyInfo, string, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+	keys, next, err := c.scan(ctx, pattern, cursor, count)
+	if err != nil {
+		return nil, "", err
+	}
+
+	infos := make([]KeyInfo, 0, len(keys))
+	for _, key := range keys {
+		info, err := c.keyInfo(ctx, key)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		infos = append(infos, info)
+	}
+
+	if next == "0" {
+		next = ""
+	}
+	return infos, next, nil
+}
+
+func (c *redisConn) GetKey(ctx context.Context, key string) (*KeyValue, error) {
+	info, err := c.keyInfo(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &KeyValue{KeyInfo: info, Length: 1}
+	last := strconv.Itoa(redisMaxElements - 1)
+
+	switch info.Type {
+	case "string":
+		result.Value, err = respString(c.client.Do(ctx, "GET", key))
+	case "hash":
+		var pairs []string
+		pairs, err = respStrings(c.client.Do(ctx, "HGETALL", key))
+		fields := make(map[string]string, len(pairs)/2)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			fields[pairs[i]] = pairs[i+1]
+		}
+		result.Value = fields
+		result.Length = int64(len(fields))
+	case "list":
+		result.Value, err = respStrings(c.client.Do(ctx, "LRANGE", key, "0", last))
+		if err == nil {
+			result.Length, err = respInt(c.client.Do(ctx, "LLEN", key))
+		}
+	case "set":
+		var members []string
+		members, err = respStrings(c.client.Do(ctx, "SMEMBERS", key))
+		sort.Strings(members)
+		result.Length = int64(len(members))
+		if len(members) > redisMaxElements {
+			members = members[:redisMaxElements]
+		}
+		result.Value = members
+	case "zset":
+		var pairs []string
+		pairs, err = respStrings(c.client.Do(ctx, "ZRANGE", key, "0", last, "WITHSCORES"))
+		members := make([]map[string]interface{}, 0, len(pairs)/2)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			score, _ := strconv.ParseFloat(pairs[i+1], 64)
+			members = append(members, map[string]interface{}{"member": pairs[i], "score": score})
+		}
+		result.Value = members
+		if err == nil {
+			result.Length, err = respInt(c.client.Do(ctx, "ZCARD", key))
+		}
+	default:
+		// Streams and module types are listed but not decoded
+		result.Value = nil
+		result.Length = 0
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *redisConn) ListCollections(ctx context.Context) ([]string, error) {
+	keys, err := c.scanAll(ctx, "*"+redisNamespaceSeparator+"*", redisScanLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	namespaces := make([]string, 0, 32)
+	for _, key := range keys {
+		namespace := strings.SplitN(key, redisNamespaceSeparator, 2)[0]
+		if !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+func (c *redisConn) Schema(ctx context.Context, collection string) ([]FieldInfo, error) {
+	return []FieldInfo{
+		{Name: "key", Type: "text"},
+		{Name: "type", Type: "text"},
+		{Name: "ttl", Type: "number"},
+		{Name: "value", Type: "textarea"},
+	}, nil
+}
+
+// namespacePattern returns the SCAN pattern for keys of a collection
+func namespacePattern(collection, search string) string {
+	pattern := collection + redisNamespaceSeparator + "*"
+	if search != "" {
+		pattern += search + "*"
+	}
+	return pattern
+}
+
+// keyDocument converts a key value into the document shape used by handlers
+func keyDocument(collection string, kv *KeyValue) Document {
+	return Document{
+		"id":     strings.TrimPrefix(kv.Key, collection+redisNamespaceSeparator),
+		"key":    kv.Key,
+		"type":   kv.Type,
+		"ttl":    kv.TTL,
+		"length": kv.Length,
+		"value":  kv.Value,
+	}
+}
+
+func (c *redisConn) Find(ctx context.Context, collection string, opts FindOptions) ([]Document, error) {
+	if len(opts.Filters) > 0 || opts.Where != nil || len(opts.Select) > 0 {
+		return nil, ErrUnsupported
+	}
+	limit := 0
+	if opts.Limit > 0 {
+		limit = opts.Offset + opts.Limit
+	}
+	keys, err := c.scanAll(ctx, namespacePattern(collection, opts.Search), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// SCAN order is unspecified, sort keys so pages are stable
+	sort.Strings(keys)
+	if opts.SortOrder == "desc" {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	}
+	if opts.Offset > 0 {
+		if opts.Offset >= len(keys) {
+			keys = nil
+		} else {
+			keys = keys[opts.Offset:]
+		}
+	}
+	if opts.Limit > 0 && len(keys) > opts.Limit {
+		keys = keys[:opts.Limit]
+	}
+
+	documents := make([]Document, 0, len(keys))
+	for _, key := range keys {
+		kv, err := c.GetKey(ctx, key)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, keyDocument(collection, kv))
+	}
+	return documents, nil
+}
+
+func (c *redisConn) Count(ctx context.Context, collection string, opts FindOptions) (int64, error) {
+	if len(opts.Filters) > 0 || opts.Where != nil {
+		return 0, ErrUnsupported
+	}
+	keys, err := c.scanAll(ctx, namespacePattern(collection, opts.Search), redisScanLimit)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(keys)), nil
+}
+
+func (c *redisConn) Get(ctx context.Context, collection string, id RecordKey) (Document, error) {
+	if id.Scope != nil {
+		return nil, ErrUnsupported
+	}
+	kv, err := c.GetKey(ctx, collection+redisNamespaceSeparator+id.Single())
+	if err != nil {
+		return nil, err
+	}
+	return keyDocument(collection, kv), nil
+}
+
+// Insert is not supported, keys are created with Update (PUT) since their name is the ID
+func (c *redisConn) Insert(ctx context.Context, collection string, doc Document) (interface{}, error) {
+	return nil, ErrUnsupported
+}
+
+// Update replaces the value of a key. The document carries "value", an optional
+// "type" (string, hash, list, set, zset; inferred from the value when omitted)
+// and an optional "ttl" in seconds.
+func (c *redisConn) Update(ctx context.Context, collection string, id RecordKey, doc Document) (int64, error) {
+	if id.Scope != nil {
+		return 0, ErrUnsupported
+	}
+	key := collection + redisNamespaceSeparator + id.Single()
+
+	value, ok := doc["value"]
+	if !ok {
+		return 0, fmt.Errorf("missing \"value\" field")
+	}
+	keyType, _ := doc["type"].(string)
+	if keyType == "" {
+		switch value.(type) {
+		case map[string]interface{}:
+			keyType = "hash"
+		case []interface{}:
+			keyType = "list"
+		default:
+			keyType = "string"
+		}
+	}
+
+	commands := [][]string{{"DEL", key}}
+	switch keyType {
+	case "string":
+		commands = append(commands, []string{"SET", key, redisArg(value)})
+	case "hash":
+		fields, ok := value.(map[string]interface{})
+		if !ok || len(fields) == 0 {
+			return 0, fmt.Errorf("hash value must be a non-empty object")
+		}
+		args := []string{"HSET", key}
+		for field, fieldValue := range fields {
+			args = append(args, field, redisArg(fieldValue))
+		}
+		commands = append(commands, args)
+	case "list", "set":
+		items, ok := value.([]interface{})
+		if !ok || len(items) == 0 {
+			return 0, fmt.Errorf("%s value must be a non-empty array", keyType)
+		}
+		command := "RPUSH"
+		if keyType == "set" {
+			command = "SADD"
+		}
+		args := []string{command, key}
+		for _, item := range items {
+			args = append(args, redisArg(item))
+		}
+		commands = append(commands, args)
+	case "zset":
+		members, ok := value.(map[string]interface{})
+		if !ok || len(members) == 0 {
+			return 0, fmt.Errorf("zset value must be a non-empty object of member to score")
+		}
+		args := []string{"ZADD", key}
+		for member, score := range members {
+			args = append(args, redisArg(score), member)
+		}
+		commands = append(commands, args)
+	default:
+		return 0, fmt.Errorf("unsupported Redis type: %s", keyType)
+	}
+
+	if ttl, ok := doc["ttl"].(float64); ok && ttl > 0 {
+		commands = append(commands, []string{"EXPIRE", key, strconv.FormatInt(int64(ttl), 10)})
+	}
+
+	if _, err := c.client.Transaction(ctx, commands...); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func (c *redisConn) Delete(ctx context.Context, collection string, id RecordKey) (int64, error) {
+	if id.Scope != nil {
+		return 0, ErrUnsupported
+	}
+	deleted, err := respInt(c.client.Do(ctx, "DEL", collection+redisNamespaceSeparator+id.Single()))
+	if err != nil {
+		return 0, err
+	}
+	if deleted == 0 {
+		return 0, ErrNotFound
+	}
+	return deleted, nil
+}
+
+// redisArg formats a decoded JSON value as a command argument
+func redisArg(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
@@ -0,0 +1,507 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"db-manager-backend/models"
+)
+
+// fakeRedis is an in-process RESP server keeping its keyspace in memory. It implements
+// the commands the driver sends, with Redis's replies and error behavior.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu   sync.Mutex
+	keys map[string]interface{} // string, map[string]string, []string, set, zset
+	ttls map[string]int64
+}
+
+type fakeSet map[string]bool
+type fakeZSet map[string]float64
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRedis{
+		listener: listener,
+		password: password,
+		keys:     make(map[string]interface{}),
+		ttls:     make(map[string]int64),
+	}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+// connection returns the saved connection pointing to the server
+func (s *fakeRedis) connection(password string) *models.DatabaseConnection {
+	address := s.listener.Addr().(*net.TCPAddr)
+	return &models.DatabaseConnection{Type: "redis", Host: address.IP.String(), Port: address.Port, Password: password}
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	authenticated := s.password == ""
+	var queued [][]string
+	inMulti := false
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(args[0])
+		switch {
+		case name == "AUTH":
+			if args[len(args)-1] == s.password {
+				authenticated = true
+				writeReply(writer, "+OK")
+			} else {
+				writeReply(writer, respError("WRONGPASS invalid username-password pair"))
+			}
+		case !authenticated:
+			writeReply(writer, respError("NOAUTH Authentication required."))
+		case name == "MULTI":
+			inMulti = true
+			queued = nil
+			writeReply(writer, "+OK")
+		case name == "EXEC":
+			results := make([]interface{}, 0, len(queued))
+			for _, command := range queued {
+				results = append(results, s.execute(command))
+			}
+			inMulti = false
+			writeReply(writer, results)
+		case inMulti:
+			queued = append(queued, args)
+			writeReply(writer, "+QUEUED")
+		default:
+			writeReply(writer, s.execute(args))
+		}
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected command line %q", line)
+	}
+	args := make([]string, count)
+	for i := range args {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+// writeReply encodes a reply: strings starting with + are simple strings, other
+// strings bulk strings
+func writeReply(writer *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		writer.WriteString("$-1\r\n")
+	case respError:
+		fmt.Fprintf(writer, "-%s\r\n", string(v))
+	case int64:
+		fmt.Fprintf(writer, ":%d\r\n", v)
+	case string:
+		if strings.HasPrefix(v, "+") {
+			fmt.Fprintf(writer, "%s\r\n", v)
+		} else {
+			fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(v), v)
+		}
+	case []string:
+		fmt.Fprintf(writer, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(writer, item)
+		}
+	case []interface{}:
+		fmt.Fprintf(writer, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(writer, item)
+		}
+	default:
+		panic(fmt.Sprintf("unsupported reply %T", reply))
+	}
+}
+
+var errWrongType = respError("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+func (s *fakeRedis) execute(args []string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := ""
+	if len(args) > 1 {
+		key = args[1]
+	}
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG"
+	case "SELECT":
+		return "+OK"
+	case "SCAN":
+		pattern := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.EqualFold(args[i], "MATCH") {
+				pattern = args[i+1]
+			}
+		}
+		matcher := globPattern(pattern)
+		var keys []string
+		for name := range s.keys {
+			if matcher.MatchString(name) {
+				keys = append(keys, name)
+			}
+		}
+		sort.Strings(keys)
+		return []interface{}{"0", keys}
+	case "TYPE":
+		switch s.keys[key].(type) {
+		case nil:
+			return "+none"
+		case string:
+			return "+string"
+		case map[string]string:
+			return "+hash"
+		case []string:
+			return "+list"
+		case fakeSet:
+			return "+set"
+		default:
+			return "+zset"
+		}
+	case "TTL":
+		if _, ok := s.keys[key]; !ok {
+			return int64(-2)
+		}
+		if ttl, ok := s.ttls[key]; ok {
+			return ttl
+		}
+		return int64(-1)
+	case "DEL":
+		if _, ok := s.keys[key]; !ok {
+			return int64(0)
+		}
+		delete(s.keys, key)
+		delete(s.ttls, key)
+		return int64(1)
+	case "EXPIRE":
+		seconds, _ := strconv.ParseInt(args[2], 10, 64)
+		s.ttls[key] = seconds
+		return int64(1)
+	case "GET":
+		value, ok := s.keys[key].(string)
+		if !ok {
+			return nil
+		}
+		return value
+	case "SET":
+		s.keys[key] = args[2]
+		return "+OK"
+	case "HSET":
+		fields, _ := s.keys[key].(map[string]string)
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			fields[args[i]] = args[i+1]
+		}
+		s.keys[key] = fields
+		return int64(len(args)/2 - 1)
+	case "HGETALL":
+		fields, _ := s.keys[key].(map[string]string)
+		var pairs []string
+		for field, value := range fields {
+			pairs = append(pairs, field, value)
+		}
+		return pairs
+	case "RPUSH":
+		items, _ := s.keys[key].([]string)
+		s.keys[key] = append(items, args[2:]...)
+		return int64(len(items) + len(args) - 2)
+	case "LRANGE":
+		items, _ := s.keys[key].([]string)
+		stop, _ := strconv.Atoi(args[3])
+		if stop+1 < len(items) {
+			items = items[:stop+1]
+		}
+		return items
+	case "LLEN":
+		items, _ := s.keys[key].([]string)
+		return int64(len(items))
+	case "SADD":
+		members, _ := s.keys[key].(fakeSet)
+		if members == nil {
+			members = make(fakeSet)
+		}
+		for _, member := range args[2:] {
+			members[member] = true
+		}
+		s.keys[key] = members
+		return int64(len(args) - 2)
+	case "SMEMBERS":
+		members, _ := s.keys[key].(fakeSet)
+		var list []string
+		for member := range members {
+			list = append(list, member)
+		}
+		return list
+	case "ZADD":
+		members, _ := s.keys[key].(fakeZSet)
+		if members == nil {
+			members = make(fakeZSet)
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return respError("ERR value is not a valid float")
+			}
+			members[args[i+1]] = score
+		}
+		s.keys[key] = members
+		return int64(len(args)/2 - 1)
+	case "ZRANGE":
+		members, ok := s.keys[key].(fakeZSet)
+		if !ok && s.keys[key] != nil {
+			return errWrongType
+		}
+		names := make([]string, 0, len(members))
+		for member := range members {
+			names = append(names, member)
+		}
+		sort.Slice(names, func(i, j int) bool { return members[names[i]] < members[names[j]] })
+		var pairs []string
+		for _, name := range names {
+			pairs = append(pairs, name, strconv.FormatFloat(members[name], 'f', -1, 64))
+		}
+		return pairs
+	case "ZCARD":
+		members, _ := s.keys[key].(fakeZSet)
+		return int64(len(members))
+	default:
+		return respError("ERR unknown command '" + args[0] + "'")
+	}
+}
+
+// globPattern translates the * and ? wildcards of MATCH patterns
+func globPattern(pattern string) *regexp.Regexp {
+	var expression strings.Builder
+	expression.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expression.WriteString(".*")
+		case '?':
+			expression.WriteString(".")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expression.WriteString("$")
+	return regexp.MustCompile(expression.String())
+}
+
+func openFakeRedis(t *testing.T, server *fakeRedis, password string) Conn {
+	t.Helper()
+	driver, err := GetDriver("redis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := driver.Open(context.Background(), server.connection(password))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestRedisHandshake(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	driver, err := GetDriver("redis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := driver.Test(ctx, server.connection("wrong")); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("wrong password: got %v, want an authentication error", err)
+	}
+	if err := driver.Test(ctx, server.connection("")); err == nil || !strings.Contains(err.Error(), "NOAUTH") {
+		t.Fatalf("missing password: got %v, want NOAUTH", err)
+	}
+	if err := driver.Test(ctx, server.connection("secret")); err != nil {
+		t.Fatalf("valid password: %v", err)
+	}
+
+	named := server.connection("secret")
+	named.Database = "cache"
+	if err := driver.Test(ctx, named); err == nil || !strings.Contains(err.Error(), "numeric index") {
+		t.Fatalf("non-numeric database: got %v", err)
+	}
+	named.Database = "2"
+	if err := driver.Test(ctx, named); err != nil {
+		t.Fatalf("numeric database: %v", err)
+	}
+}
+
+func TestRedisKeysAsDocuments(t *testing.T) {
+	server := newFakeRedis(t, "")
+	conn := openFakeRedis(t, server, "")
+	ctx := context.Background()
+
+	writes := []struct {
+		id   string
+		doc  Document
+		kind string
+	}{
+		{"1", Document{"value": "alice"}, "string"},
+		{"2", Document{"value": map[string]interface{}{"name": "bob", "age": float64(42)}}, "hash"},
+		{"3", Document{"value": []interface{}{"a", "b"}, "ttl": float64(60)}, "list"},
+		{"4", Document{"value": []interface{}{"x", "y"}, "type": "set"}, "set"},
+		{"5", Document{"value": map[string]interface{}{"low": float64(1), "high": float64(9)}, "type": "zset"}, "zset"},
+	}
+	for _, write := range writes {
+		if _, err := conn.Update(ctx, "users", IDKey(write.id), write.doc); err != nil {
+			t.Fatalf("Update users:%s: %v", write.id, err)
+		}
+	}
+	if _, err := conn.Update(ctx, "sessions", IDKey("abc"), Document{"value": "token"}); err != nil {
+		t.Fatal(err)
+	}
+
+	collections, err := conn.ListCollections(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(collections, ",") != "sessions,users" {
+		t.Fatalf("collections = %v", collections)
+	}
+
+	for _, write := range writes {
+		doc, err := conn.Get(ctx, "users", IDKey(write.id))
+		if err != nil {
+			t.Fatalf("Get users:%s: %v", write.id, err)
+		}
+		if doc["type"] != write.kind || doc["key"] != "users:"+write.id || doc["id"] != write.id {
+			t.Errorf("users:%s = %v", write.id, doc)
+		}
+	}
+	doc, _ := conn.Get(ctx, "users", IDKey("2"))
+	if fields := doc["value"].(map[string]string); fields["age"] != "42" || fields["name"] != "bob" {
+		t.Errorf("hash value = %v", doc["value"])
+	}
+	doc, _ = conn.Get(ctx, "users", IDKey("3"))
+	if doc["ttl"] != int64(60) || doc["length"] != int64(2) {
+		t.Errorf("list ttl and length = %v, %v", doc["ttl"], doc["length"])
+	}
+	doc, _ = conn.Get(ctx, "users", IDKey("5"))
+	members := doc["value"].([]map[string]interface{})
+	if len(members) != 2 || members[0]["member"] != "low" || members[1]["score"] != float64(9) {
+		t.Errorf("zset value = %v", members)
+	}
+
+	all, err := conn.Find(ctx, "users", FindOptions{SortOrder: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, doc := range all {
+		ids = append(ids, doc["id"].(string))
+	}
+	if strings.Join(ids, ",") != "5,4,3,2,1" {
+		t.Errorf("descending ids = %v", ids)
+	}
+	page, err := conn.Find(ctx, "users", FindOptions{Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0]["id"] != "2" || page[1]["id"] != "3" {
+		t.Errorf("page = %v", page)
+	}
+	count, err := conn.Count(ctx, "users", FindOptions{})
+	if err != nil || count != 5 {
+		t.Errorf("Count = %d, %v", count, err)
+	}
+
+	if _, err := conn.Delete(ctx, "users", IDKey("1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Get(ctx, "users", IDKey("1")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get deleted key: got %v, want ErrNotFound", err)
+	}
+	if _, err := conn.Delete(ctx, "users", IDKey("1")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete missing key: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRedisRejectsWhatKeysCannotDo(t *testing.T) {
+	server := newFakeRedis(t, "")
+	conn := openFakeRedis(t, server, "")
+	ctx := context.Background()
+	scope := &FilterGroup{Filters: []Filter{{Column: "id", Operator: OpEq, Value: "1"}}}
+
+	if _, err := conn.Insert(ctx, "users", Document{"value": "x"}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Insert: got %v, want ErrUnsupported", err)
+	}
+	if _, err := conn.Find(ctx, "users", FindOptions{Where: scope}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Find with a filter: got %v, want ErrUnsupported", err)
+	}
+	if _, err := conn.Get(ctx, "users", RecordKey{ID: "1", Scope: scope}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("scoped Get: got %v, want ErrUnsupported", err)
+	}
+
+	// Errors of queued commands surface from EXEC
+	_, err := conn.Update(ctx, "scores", IDKey("1"), Document{"value": map[string]interface{}{"a": "high"}, "type": "zset"})
+	if err == nil || !strings.Contains(err.Error(), "not a valid float") {
+		t.Errorf("invalid zset score: got %v", err)
+	}
+	if _, err := conn.Update(ctx, "users", IDKey("1"), Document{"value": "x", "type": "stream"}); err == nil {
+		t.Error("unsupported type: want an error")
+	}
+}
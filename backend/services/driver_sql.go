@@ -0,0 +1,1302 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"db-manager-backend/models"
+	"db-manager-backend/sqlident"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// sqlDialect captures the differences between SQL engines sharing the generic driver
+type sqlDialect struct {
+	driverName      string
+	ident           sqlident.Dialect
+	listTablesQuery string
+	searchCondition string // format string receiving the quoted column name
+	numberedParams  bool   // $1, $2 ... instead of ?
+	syntax          statementSyntax
+	readOnlySession string // statement making the session read-only where transactions cannot be
+	buildDSN        func(conn *models.DatabaseConnection) (string, error)
+	connector       func(conn *models.DatabaseConnection) (driver.Connector, error) // replaces buildDSN when set
+	describe        func(ctx context.Context, db *sql.DB, table string) ([]string, []string, error)
+	introspect      func(ctx context.Context, db *sql.DB, table string) (*TableSchema, error)
+	estimate        func(ctx context.Context, db *sql.DB, table string) (int64, error) // approximate row count
+	explain         func(ctx context.Context, tx *sql.Tx, query string, args []interface{}, analyze bool) (*Plan, error)
+	// optional hooks run before opening and after the first successful ping
+	precheck func(conn *models.DatabaseConnection) error
+	validate func(ctx context.Context, db *sql.DB) error
+}
+
+var mysqlDialect = &sqlDialect{
+	driverName:      "mysql",
+	ident:           sqlident.MySQL,
+	syntax:          statementSyntax{hashComments: true, backslashEscapes: true},
+	listTablesQuery: "SHOW TABLES",
+	searchCondition: "CAST(%s AS CHAR) LIKE %s",
+	connector:       mysqlConnector,
+	describe:        describeMySQL,
+	introspect:      introspectMySQL,
+	estimate:        estimateMySQL,
+	explain:         explainMySQL,
+}
+
+var postgresDialect = &sqlDialect{
+	driverName:      "postgres",
+	ident:           sqlident.Postgres,
+	listTablesQuery: "SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' ORDER BY table_name",
+	searchCondition: "CAST(%s AS TEXT) ILIKE %s",
+	numberedParams:  true,
+	syntax:          statementSyntax{dollarQuotes: true},
+	buildDSN:        postgresDSN,
+	describe:        describePostgres,
+	introspect:      introspectPostgres,
+	estimate:        estimatePostgres,
+	explain:         explainPostgres,
+}
+
+// mysqlConnector configures the MySQL driver from the connection fields or its raw DSN
+func mysqlConnector(conn *models.DatabaseConnection) (driver.Connector, error) {
+	cfg := mysql.NewConfig()
+	if usesConnectionString(conn) {
+		parsed, err := mysql.ParseDSN(conn.ConnectionString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MySQL connection string: %v", err)
+		}
+		if err := checkMySQLConfig(parsed); err != nil {
+			return nil, err
+		}
+		cfg = parsed
+	} else {
+		cfg.User = conn.Username
+		cfg.Passwd = conn.Password
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port))
+		cfg.DBName = conn.Database
+		cfg.ParseTime = true
+		cfg.Loc = time.Local
+		cfg.Params = map[string]string{"charset": "utf8mb4"}
+	}
+
+	tlsConfig, err := buildTLSConfig(conn)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		cfg.TLS = tlsConfig
+	}
+
+	return mysql.NewConnector(cfg)
+}
+
+// mysqlSessionParams are the session variables a MySQL connection string may set,
+// the others are dropped
+var mysqlSessionParams = map[string]bool{"charset": true, "time_zone": true, "sql_mode": true}
+
+// checkMySQLConfig keeps a parsed MySQL connection string from reaching files on the
+// server running the application: LOAD DATA LOCAL INFILE stays limited to the
+// (empty) allowlist of the driver and unix sockets are refused.
+func checkMySQLConfig(cfg *mysql.Config) error {
+	if cfg.AllowAllFiles {
+		return errors.New("MySQL connection strings cannot set allowAllFiles")
+	}
+	if cfg.Net != "tcp" {
+		return fmt.Errorf("MySQL connection strings must connect over tcp, not %s", cfg.Net)
+	}
+	for name := range cfg.Params {
+		if !mysqlSessionParams[name] {
+			delete(cfg.Params, name)
+		}
+	}
+	return nil
+}
+
+// postgresFileParams are the libpq parameters naming files on the server running the
+// application. Connection strings cannot set them, certificates go in the SSL fields.
+var postgresFileParams = []string{"sslcert", "sslkey", "sslrootcert", "passfile"}
+
+// postgresDSN builds a key/value DSN, or returns the raw connection string once checked.
+// Certificates are passed inline to lib/pq with sslinline.
+func postgresDSN(conn *models.DatabaseConnection) (string, error) {
+	if usesConnectionString(conn) {
+		params, err := parsePostgresDSN(conn.ConnectionString)
+		if err != nil {
+			return "", fmt.Errorf("invalid PostgreSQL connection string: %v", err)
+		}
+		for _, name := range postgresFileParams {
+			if _, set := params[name]; set {
+				return "", fmt.Errorf("PostgreSQL connection strings cannot set %s, use the SSL fields instead", name)
+			}
+		}
+		if strings.HasPrefix(params["host"], "/") {
+			return "", errors.New("PostgreSQL connection strings cannot connect through a unix socket")
+		}
+		return conn.ConnectionString, nil
+	}
+
+	mode, err := sslMode(conn)
+	if err != nil {
+		return "", err
+	}
+
+	params := [][2]string{
+		{"host", conn.Host},
+		{"port", strconv.Itoa(conn.Port)},
+		{"user", conn.Username},
+		{"password", conn.Password},
+		{"dbname", conn.Database},
+		{"sslmode", mode},
+	}
+	if mode != SSLModeDisable && (conn.SSLCert != "" || conn.SSLKey != "" || conn.SSLRootCert != "") {
+		params = append(params, [2]string{"sslinline", "true"})
+		if conn.SSLCert != "" {
+			params = append(params, [2]string{"sslcert", conn.SSLCert}, [2]string{"sslkey", conn.SSLKey})
+		}
+		if conn.SSLRootCert != "" {
+			params = append(params, [2]string{"sslrootcert", conn.SSLRootCert})
+		}
+	}
+
+	pairs := make([]string, 0, len(params))
+	for _, param := range params {
+		if param[1] == "" {
+			continue
+		}
+		pairs = append(pairs, param[0]+"="+quoteDSNValue(param[1]))
+	}
+	return strings.Join(pairs, " "), nil
+}
+
+// parsePostgresDSN reads the parameters of a libpq URL or key/value connection string
+// the way lib/pq does
+func parsePostgresDSN(dsn string) (map[string]string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		converted, err := pq.ParseURL(dsn)
+		if err != nil {
+			return nil, err
+		}
+		dsn = converted
+	}
+
+	params := make(map[string]string)
+	runes := []rune(dsn)
+	i := 0
+	skipSpaces := func() {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+	}
+	for {
+		skipSpaces()
+		if i == len(runes) {
+			return params, nil
+		}
+		start := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '=' {
+			i++
+		}
+		key := string(runes[start:i])
+		skipSpaces()
+		if i == len(runes) || runes[i] != '=' {
+			return nil, fmt.Errorf("missing \"=\" after %q", key)
+		}
+		i++
+		skipSpaces()
+
+		var value []rune
+		if i < len(runes) && runes[i] == '\'' {
+			for i++; ; i++ {
+				if i == len(runes) {
+					return nil, errors.New("unterminated quoted value")
+				}
+				if runes[i] == '\'' {
+					i++
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value = append(value, runes[i])
+			}
+		} else {
+			for ; i < len(runes) && !unicode.IsSpace(runes[i]); i++ {
+				if runes[i] == '\\' {
+					if i+1 == len(runes) {
+						return nil, errors.New("missing character after backslash")
+					}
+					i++
+				}
+				value = append(value, runes[i])
+			}
+		}
+		params[key] = string(value)
+	}
+}
+
+// quoteDSNValue quotes a libpq key/value parameter
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "'", `\'`)
+	return "'" + value + "'"
+}
+
+// placeholder returns the bind parameter marker for the n-th (1-based) argument
+func (d *sqlDialect) placeholder(n int) string {
+	if d.numberedParams {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// Limits applied to each pooled database/sql handle
+const (
+	sqlMaxOpenConns    = 10
+	sqlMaxIdleConns    = 2
+	sqlConnMaxIdleTime = 5 * time.Minute
+)
+
+type sqlDriver struct {
+	dialect *sqlDialect
+}
+
+func init() {
+	RegisterDriver(&sqlDriver{dialect: mysqlDialect}, "mysql", "mariadb")
+	RegisterDriver(&sqlDriver{dialect: postgresDialect}, "postgres", "postgresql", "cockroachdb")
+}
+
+func (d *sqlDriver) Kind() string {
+	return KindRelational
+}
+
+func (d *sqlDriver) Test(ctx context.Context, conn *models.DatabaseConnection) error {
+	db, err := openSQL(ctx, d.dialect, conn)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+func (d *sqlDriver) Open(ctx context.Context, conn *models.DatabaseConnection) (Conn, error) {
+	db, err := openSQL(ctx, d.dialect, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(sqlMaxOpenConns)
+	db.SetMaxIdleConns(sqlMaxIdleConns)
+	db.SetConnMaxIdleTime(sqlConnMaxIdleTime)
+	return &sqlConn{db: db, dialect: d.dialect}, nil
+}
+
+// openSQL opens and pings a database/sql handle for the given dialect
+func openSQL(ctx context.Context, dialect *sqlDialect, conn *models.DatabaseConnection) (*sql.DB, error) {
+	if dialect.precheck != nil {
+		if err := dialect.precheck(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := newSQLDB(dialect, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test the connection
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if dialect.validate != nil {
+		if err := dialect.validate(ctx, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// newSQLDB creates the database/sql handle through the dialect connector or DSN
+func newSQLDB(dialect *sqlDialect, conn *models.DatabaseConnection) (*sql.DB, error) {
+	if dialect.connector != nil {
+		connector, err := dialect.connector(conn)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(connector), nil
+	}
+
+	dsn, err := dialect.buildDSN(conn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open(dialect.driverName, dsn)
+}
+
+type sqlConn struct {
+	db      *sql.DB
+	dialect *sqlDialect
+
+	tables      tableCache // "" -> names of all tables
+	keys        tableCache // table -> discovered primary key
+	columnNames tableCache // table -> column names
+}
+
+// tableCacheTTL bounds how long table metadata is reused, so schema changes are
+// picked up without reopening the connection
+const tableCacheTTL = time.Minute
+
+// tableCache remembers a list of columns per table
+type tableCache struct {
+	mu      sync.Mutex
+	entries map[string]tableCacheEntry
+}
+
+type tableCacheEntry struct {
+	columns []string
+	expires time.Time
+}
+
+func (t *tableCache) get(table string) ([]string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[table]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.columns, true
+}
+
+func (t *tableCache) set(table string, columns []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.entries == nil {
+		t.entries = make(map[string]tableCacheEntry)
+	}
+	t.entries[table] = tableCacheEntry{columns: columns, expires: time.Now().Add(tableCacheTTL)}
+}
+
+// DB exposes the underlying handle for callers needing raw SQL access
+func (c *sqlConn) DB() *sql.DB {
+	return c.db
+}
+
+// Stats reports database/sql pool statistics
+func (c *sqlConn) Stats() sql.DBStats {
+	return c.db.Stats()
+}
+
+func (c *sqlConn) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+func (c *sqlConn) Close() error {
+	return c.db.Close()
+}
+
+func (c *sqlConn) ListCollections(ctx context.Context) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx, c.dialect.listTablesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Optimize scanning by reusing tableName variable
+	tables := make([]string, 0, 32)
+	var tableName string
+	for rows.Next() {
+		if err := rows.Scan(&tableName); err != nil {
+			continue
+		}
+		tables = append(tables, tableName)
+	}
+	return tables, rows.Err()
+}
+
+// columns returns the column names and native data types of a table
+func (c *sqlConn) columns(ctx context.Context, table string) ([]string, []string, error) {
+	return c.dialect.describe(ctx, c.db, table)
+}
+
+// describeMySQL reads column information using DESCRIBE
+func describeMySQL(ctx context.Context, db *sql.DB, table string) ([]string, []string, error) {
+	rows, err := db.QueryContext(ctx, "DESCRIBE "+sqlident.MySQL.Quote(table))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var names, types []string
+	for rows.Next() {
+		var field, fieldType, null, key, extra string
+		var defaultVal sql.NullString // Use sql.NullString for nullable columns
+		if err := rows.Scan(&field, &fieldType, &null, &key, &defaultVal, &extra); err != nil {
+			log.Printf("Error scanning MySQL row: %v", err)
+			continue
+		}
+		names = append(names, field)
+		types = append(types, fieldType)
+	}
+	return names, types, rows.Err()
+}
+
+// describePostgres reads column information from information_schema
+func describePostgres(ctx context.Context, db *sql.DB, table string) ([]string, []string, error) {
+	query := `
+		SELECT column_name, data_type
+		FROM information_schema.columns
+		WHERE table_name = $1 AND table_schema = 'public'
+		ORDER BY ordinal_position
+	`
+
+	// PostgreSQL is case-sensitive, try the original name first and then lowercase
+	for _, name := range []string{table, strings.ToLower(table)} {
+		rows, err := db.QueryContext(ctx, query, name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var names, types []string
+		for rows.Next() {
+			var field, dataType string
+			if err := rows.Scan(&field, &dataType); err != nil {
+				log.Printf("Error scanning PostgreSQL row: %v", err)
+				continue
+			}
+			names = append(names, field)
+			types = append(types, dataType)
+		}
+		rows.Close()
+
+		if len(names) > 0 {
+			return names, types, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func (c *sqlConn) Schema(ctx context.Context, table string) ([]FieldInfo, error) {
+	names, types, err := c.columns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]FieldInfo, 0, len(names))
+	for i, name := range names {
+		// Determine input type based on the native field type and name
+		fields = append(fields, FieldInfo{Name: name, Type: determineInputType(name, types[i])})
+	}
+	return fields, nil
+}
+
+// resolveTable validates a table name against the catalog and returns its spelling
+// there. Names match exactly or, when a single table does, ignoring case, like the
+// unquoted names used before identifiers were quoted.
+func (c *sqlConn) resolveTable(ctx context.Context, table string) (string, error) {
+	if err := c.dialect.ident.Validate(table); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	if tables, ok := c.tables.get(""); ok {
+		if name, ok := sqlident.Resolve(table, tables); ok {
+			return name, nil
+		}
+	}
+
+	// Reload the catalog, the table may have been created since it was cached
+	tables, err := c.ListCollections(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.tables.set("", tables)
+	if name, ok := sqlident.Resolve(table, tables); ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("%w: unknown table %s", ErrInvalidQuery, table)
+}
+
+// ResolveCollection returns the spelling of a table in the catalog
+func (c *sqlConn) ResolveCollection(ctx context.Context, collection string) (string, error) {
+	return c.resolveTable(ctx, collection)
+}
+
+// quote returns a column or table name checked against the catalog as a quoted identifier
+func (c *sqlConn) quote(name string) string {
+	return c.dialect.ident.Quote(name)
+}
+
+// checkColumns fails unless every column is one of the table columns
+func checkColumns(tableColumns, columns []string) error {
+	known := make(map[string]bool, len(tableColumns))
+	for _, column := range tableColumns {
+		known[column] = true
+	}
+	for _, column := range columns {
+		if !known[column] {
+			return fmt.Errorf("%w: unknown column %s", ErrInvalidQuery, column)
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the column names of a table, failing for unknown tables
+func (c *sqlConn) tableColumns(ctx context.Context, table string) ([]string, error) {
+	if columns, ok := c.columnNames.get(table); ok {
+		return columns, nil
+	}
+
+	columns, _, err := c.columns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: unknown table %s", ErrInvalidQuery, table)
+	}
+	c.columnNames.set(table, columns)
+	return columns, nil
+}
+
+// checkDocument fails unless every field of a document written to a resolved table is
+// one of its columns
+func (c *sqlConn) checkDocument(ctx context.Context, table string, fields []string) error {
+	tableColumns, err := c.tableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	return checkColumns(tableColumns, fields)
+}
+
+// whereClause builds a WHERE clause from the search term, matched against every
+// column or the SearchColumns, the column filters and the filter tree. Every
+// referenced column is validated first, the table must already be resolved.
+func (c *sqlConn) whereClause(ctx context.Context, table string, opts FindOptions) (string, []interface{}, error) {
+	tableColumns, err := c.tableColumns(ctx, table)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := checkColumns(tableColumns, opts.Columns()); err != nil {
+		return "", nil, err
+	}
+
+	var conditions []string
+	var args []interface{}
+	if opts.Search != "" {
+		searchColumns := opts.searchable(tableColumns)
+		searchConditions := make([]string, 0, len(searchColumns))
+		for _, col := range searchColumns {
+			searchConditions = append(searchConditions, fmt.Sprintf(c.dialect.searchCondition, c.quote(col), c.dialect.placeholder(len(args)+1)))
+			args = append(args, "%"+opts.Search+"%")
+		}
+		if len(searchConditions) == 0 {
+			searchConditions = append(searchConditions, "1 = 0")
+		}
+		conditions = append(conditions, "("+strings.Join(searchConditions, " OR ")+")")
+	}
+	for _, filter := range opts.Filters {
+		condition, filterArgs := c.filterCondition(filter, len(args)+1)
+		conditions = append(conditions, condition)
+		args = append(args, filterArgs...)
+	}
+	if opts.Where != nil {
+		var condition string
+		if condition, args = c.groupCondition(*opts.Where, args); condition != "" {
+			conditions = append(conditions, condition)
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// groupCondition renders a filter group in parentheses, appending its bind
+// parameters to args. Empty groups render as an empty string.
+func (c *sqlConn) groupCondition(group FilterGroup, args []interface{}) (string, []interface{}) {
+	parts := make([]string, 0, len(group.Filters)+len(group.Groups))
+	for _, filter := range group.Filters {
+		condition, filterArgs := c.filterCondition(filter, len(args)+1)
+		parts = append(parts, condition)
+		args = append(args, filterArgs...)
+	}
+	for _, nested := range group.Groups {
+		var condition string
+		if condition, args = c.groupCondition(nested, args); condition != "" {
+			parts = append(parts, condition)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "", args
+	}
+	separator := " AND "
+	if group.Or {
+		separator = " OR "
+	}
+	return "(" + strings.Join(parts, separator) + ")", args
+}
+
+// sqlComparisons maps filter operators to SQL comparison operators
+var sqlComparisons = map[string]string{
+	OpEq: "=", OpNeq: "<>", OpGt: ">", OpGte: ">=", OpLt: "<", OpLte: "<=",
+}
+
+// filterCondition renders one validated filter, numbering bind parameters from start
+func (c *sqlConn) filterCondition(filter Filter, start int) (string, []interface{}) {
+	var condition string
+	var args []interface{}
+
+	column := c.quote(filter.Column)
+	switch filter.Operator {
+	case OpLike:
+		condition = fmt.Sprintf("%s LIKE %s ESCAPE '%s'", column, c.dialect.placeholder(start), likeEscape)
+		args = append(args, likePattern(filter.text()))
+	case OpIlike:
+		// Same case-insensitive text match as search, so it works on any column type
+		condition = fmt.Sprintf(c.dialect.searchCondition, column, c.dialect.placeholder(start)) + " ESCAPE '" + likeEscape + "'"
+		args = append(args, likePattern(filter.text()))
+	case OpIn:
+		placeholders := make([]string, len(filter.Values))
+		for i, value := range filter.Values {
+			placeholders[i] = c.dialect.placeholder(start + i)
+			args = append(args, value)
+		}
+		condition = fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", "))
+	case OpIs:
+		condition = fmt.Sprintf("%s IS %s", column, strings.ToUpper(filter.text()))
+	default:
+		condition = fmt.Sprintf("%s %s %s", column, sqlComparisons[filter.Operator], c.dialect.placeholder(start))
+		args = append(args, filter.Value)
+	}
+
+	if filter.Negate {
+		condition = "NOT (" + condition + ")"
+	}
+	return condition, args
+}
+
+func (c *sqlConn) Find(ctx context.Context, table string, opts FindOptions) ([]Document, error) {
+	query, args, err := c.findQuery(ctx, table, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDocuments(rows, opts.Limit)
+}
+
+// findQuery builds the SELECT statement run by Find
+func (c *sqlConn) findQuery(ctx context.Context, table string, opts FindOptions) (string, []interface{}, error) {
+	table, err := c.resolveTable(ctx, table)
+	if err != nil {
+		return "", nil, err
+	}
+	whereClause, args, err := c.whereClause(ctx, table, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	selected := "*"
+	if len(opts.Select) > 0 {
+		selected = c.dialect.ident.QuoteList(opts.Select)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", selected, c.quote(table)) + whereClause
+
+	// Add sorting and pagination
+	if order := opts.sortOrder(); len(order) > 0 {
+		terms := make([]string, len(order))
+		for i, sort := range order {
+			terms[i] = c.quote(sort.Column) + " ASC"
+			if sort.Desc {
+				terms[i] = c.quote(sort.Column) + " DESC"
+			}
+		}
+		query += " ORDER BY " + strings.Join(terms, ", ")
+	}
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+	if opts.Offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", opts.Offset)
+	}
+	return query, args, nil
+}
+
+func (c *sqlConn) Count(ctx context.Context, table string, opts FindOptions) (int64, error) {
+	table, err := c.resolveTable(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	whereClause, args, err := c.whereClause(ctx, table, opts)
+	if err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", c.quote(table)) + whereClause
+
+	var total int64
+	err = c.db.QueryRowContext(ctx, query, args...).Scan(&total)
+	return total, err
+}
+
+func (c *sqlConn) Get(ctx context.Context, table string, key RecordKey) (Document, error) {
+	table, err := c.resolveTable(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	condition, args, err := c.keyCondition(ctx, table, key, 1)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s LIMIT 1", c.quote(table), condition)
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs, err := scanDocuments(rows, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrNotFound
+	}
+	return docs[0], nil
+}
+
+// PrimaryKey returns the columns addressing a single record of the table. Tables
+// without a primary key fall back to a unique key of non-nullable columns, then to
+// a column named "id".
+func (c *sqlConn) PrimaryKey(ctx context.Context, table string) ([]string, error) {
+	if columns, ok := c.keys.get(table); ok {
+		return columns, nil
+	}
+
+	columns, err := c.discoverPrimaryKey(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	c.keys.set(table, columns)
+	return columns, nil
+}
+
+// KeysetOrder completes the sort order with the primary key
+func (c *sqlConn) KeysetOrder(ctx context.Context, table string, opts FindOptions) ([]Sort, error) {
+	table, err := c.resolveTable(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.PrimaryKey(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	return keysetOrder(opts.sortOrder(), key), nil
+}
+
+// Estimate returns the row count of a table from the statistics of the server
+func (c *sqlConn) Estimate(ctx context.Context, table string) (int64, error) {
+	if c.dialect.estimate == nil {
+		return 0, ErrUnsupported
+	}
+	table, err := c.resolveTable(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	return c.dialect.estimate(ctx, c.db, table)
+}
+
+// estimateMySQL reads the approximate row count InnoDB keeps for a table
+func estimateMySQL(ctx context.Context, db *sql.DB, table string) (int64, error) {
+	var rows sql.NullInt64
+	err := db.QueryRowContext(ctx,
+		"SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+		table).Scan(&rows)
+	if err == sql.ErrNoRows || (err == nil && !rows.Valid) {
+		return 0, ErrUnsupported
+	}
+	return rows.Int64, err
+}
+
+// estimatePostgres reads the row count planned by the last ANALYZE of a table
+func estimatePostgres(ctx context.Context, db *sql.DB, table string) (int64, error) {
+	var rows sql.NullFloat64
+	err := db.QueryRowContext(ctx,
+		"SELECT reltuples FROM pg_class WHERE oid = to_regclass($1)",
+		sqlident.Postgres.Quote(table)).Scan(&rows)
+	// reltuples is -1 for tables that were never analyzed
+	if err == sql.ErrNoRows || (err == nil && (!rows.Valid || rows.Float64 < 0)) {
+		return 0, ErrUnsupported
+	}
+	return int64(rows.Float64), err
+}
+
+func (c *sqlConn) discoverPrimaryKey(ctx context.Context, table string) ([]string, error) {
+	if c.dialect.introspect == nil {
+		return []string{"id"}, nil
+	}
+
+	schema, err := c.dialect.introspect(ctx, c.db, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(schema.Columns) == 0 {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	finishSchema(schema)
+	if len(schema.PrimaryKey) > 0 {
+		return schema.PrimaryKey, nil
+	}
+
+	nullable := make(map[string]bool, len(schema.Columns))
+	hasID := false
+	for _, column := range schema.Columns {
+		nullable[column.Name] = column.Nullable
+		hasID = hasID || column.Name == "id"
+	}
+	for _, constraint := range schema.UniqueConstraints {
+		usable := true
+		for _, column := range constraint.Columns {
+			usable = usable && !nullable[column]
+		}
+		if usable {
+			return constraint.Columns, nil
+		}
+	}
+	if hasID {
+		return []string{"id"}, nil
+	}
+	return nil, ErrNoPrimaryKey
+}
+
+// keyCondition builds the WHERE condition matching a record key of a resolved table,
+// numbering bind parameters from start
+func (c *sqlConn) keyCondition(ctx context.Context, table string, key RecordKey, start int) (string, []interface{}, error) {
+	columns, err := c.PrimaryKey(ctx, table)
+	if err != nil {
+		return "", nil, err
+	}
+	values, err := key.Values(columns)
+	if err != nil {
+		return "", nil, err
+	}
+
+	conditions := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		conditions[i] = fmt.Sprintf("%s = %s", c.quote(column), c.dialect.placeholder(start+i))
+		args[i] = values[i]
+	}
+
+	if key.Scope != nil {
+		tableColumns, err := c.tableColumns(ctx, table)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := checkColumns(tableColumns, key.Scope.columns(nil)); err != nil {
+			return "", nil, err
+		}
+		// groupCondition numbers parameters after the ones it is given, which start at 1
+		numbered := append(make([]interface{}, start-1, start-1+len(args)), args...)
+		var condition string
+		if condition, numbered = c.groupCondition(*key.Scope, numbered); condition != "" {
+			conditions = append(conditions, condition)
+			args = numbered[start-1:]
+		}
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+func (c *sqlConn) Insert(ctx context.Context, table string, doc Document) (interface{}, error) {
+	table, err := c.resolveTable(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	query, values, err := c.insertStatement(ctx, table, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.db.ExecContext(ctx, query, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	// PostgreSQL does not report LastInsertId, in which case 0 is returned
+	id, _ := result.LastInsertId()
+	return id, nil
+}
+
+// insertStatement builds the INSERT of a document into a resolved table
+func (c *sqlConn) insertStatement(ctx context.Context, table string, doc Document) (string, []interface{}, error) {
+	if len(doc) == 0 {
+		return "", nil, fmt.Errorf("no fields to insert")
+	}
+
+	// Build INSERT query
+	columns := make([]string, 0, len(doc))
+	placeholders := make([]string, 0, len(doc))
+	values := make([]interface{}, 0, len(doc))
+	for key, value := range doc {
+		columns = append(columns, key)
+		placeholders = append(placeholders, c.dialect.placeholder(len(values)+1))
+		values = append(values, value)
+	}
+	if err := c.checkDocument(ctx, table, columns); err != nil {
+		return "", nil, err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		c.quote(table),
+		c.dialect.ident.QuoteList(columns),
+		strings.Join(placeholders, ", "))
+	return query, values, nil
+}
+
+func (c *sqlConn) Update(ctx context.Context, table string, id RecordKey, doc Document) (int64, error) {
+	table, err := c.resolveTable(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	query, values, err := c.updateStatement(ctx, table, id, doc)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := c.db.ExecContext(ctx, query, values...)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return 0, ErrNotFound
+	}
+	return rowsAffected, nil
+}
+
+// updateStatement builds the UPDATE of the record of a resolved table with a document
+func (c *sqlConn) updateStatement(ctx context.Context, table string, id RecordKey, doc Document) (string, []interface{}, error) {
+	if len(doc) == 0 {
+		return "", nil, fmt.Errorf("no fields to update")
+	}
+
+	// Build UPDATE query
+	columns := make([]string, 0, len(doc))
+	setPairs := make([]string, 0, len(doc))
+	values := make([]interface{}, 0, len(doc)+1)
+	for key, value := range doc {
+		columns = append(columns, key)
+		setPairs = append(setPairs, fmt.Sprintf("%s = %s", c.quote(key), c.dialect.placeholder(len(values)+1)))
+		values = append(values, value)
+	}
+	if err := c.checkDocument(ctx, table, columns); err != nil {
+		return "", nil, err
+	}
+
+	condition, args, err := c.keyCondition(ctx, table, id, len(values)+1)
+	if err != nil {
+		return "", nil, err
+	}
+	values = append(values, args...)
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		c.quote(table),
+		strings.Join(setPairs, ", "),
+		condition)
+	return query, values, nil
+}
+
+// InsertScoped inserts a document and reads it back under the scope in the same
+// transaction, which is rolled back when the new record is out of the scope. The
+// database decides whether the record matches, with its own collations and type
+// conversions, like it does when listing the records of the scope.
+func (c *sqlConn) InsertScoped(ctx context.Context, table string, doc Document, scope *FilterGroup) (interface{}, error) {
+	table, err := c.resolveTable(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	// The record is read back by its key, tables without one cannot be checked
+	keyColumns, err := c.PrimaryKey(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	query, values, err := c.insertStatement(ctx, table, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	key := RecordKey{Columns: make(map[string]string, len(keyColumns)), Scope: scope}
+	for _, column := range keyColumns {
+		if value, ok := doc[column]; ok && value != nil {
+			key.Columns[column] = fmt.Sprint(value)
+		}
+	}
+	// Generated keys are returned by PostgreSQL and reported as the last insert ID by
+	// the others, which only generate single-column keys
+	returning := len(key.Columns) < len(keyColumns) && c.dialect.numberedParams
+	if returning {
+		query += " RETURNING " + c.dialect.ident.QuoteList(keyColumns)
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id interface{}
+	switch {
+	case returning:
+		generated := make([]interface{}, len(keyColumns))
+		scanArgs := make([]interface{}, len(keyColumns))
+		for i := range generated {
+			scanArgs[i] = &generated[i]
+		}
+		if err := tx.QueryRowContext(ctx, query, values...).Scan(scanArgs...); err != nil {
+			return nil, err
+		}
+		for i, column := range keyColumns {
+			if b, ok := generated[i].([]byte); ok {
+				generated[i] = string(b)
+			}
+			key.Columns[column] = fmt.Sprint(generated[i])
+		}
+		id = generated[0]
+	default:
+		result, err := tx.ExecContext(ctx, query, values...)
+		if err != nil {
+			return nil, err
+		}
+		lastID, _ := result.LastInsertId()
+		id = lastID
+		if len(key.Columns) < len(keyColumns) {
+			if len(keyColumns) != 1 {
+				return nil, fmt.Errorf("%w: expected key columns %s", ErrInvalidID, strings.Join(keyColumns, ", "))
+			}
+			key.Columns[keyColumns[0]] = strconv.FormatInt(lastID, 10)
+		}
+	}
+
+	if err := c.checkScoped(ctx, tx, table, key); err != nil {
+		return nil, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateScoped updates a record limited to the Scope of its key and reads it back
+// under the scope in the same transaction, which is rolled back when the changed
+// record left the scope
+func (c *sqlConn) UpdateScoped(ctx context.Context, table string, key RecordKey, doc Document) (int64, error) {
+	table, err := c.resolveTable(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	keyColumns, err := c.PrimaryKey(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	keyValues, err := key.Values(keyColumns)
+	if err != nil {
+		return 0, err
+	}
+	query, values, err := c.updateStatement(ctx, table, key, doc)
+	if err != nil {
+		return 0, err
+	}
+
+	// The record is found again by its key once changed
+	changed := RecordKey{Columns: make(map[string]string, len(keyColumns)), Scope: key.Scope}
+	for i, column := range keyColumns {
+		changed.Columns[column] = keyValues[i]
+		if value, ok := doc[column]; ok && value != nil {
+			changed.Columns[column] = fmt.Sprint(value)
+		}
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, values...)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return 0, ErrNotFound
+	}
+	if err := c.checkScoped(ctx, tx, table, changed); err != nil {
+		return 0, err
+	}
+	return rowsAffected, tx.Commit()
+}
+
+// checkScoped fails with ErrOutOfScope unless the record of the key matches its Scope
+func (c *sqlConn) checkScoped(ctx context.Context, tx *sql.Tx, table string, key RecordKey) error {
+	condition, args, err := c.keyCondition(ctx, table, key, 1)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT 1 FROM %s WHERE %s", c.quote(table), condition), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return ErrOutOfScope
+	}
+	return nil
+}
+
+func (c *sqlConn) Delete(ctx context.Context, table string, key RecordKey) (int64, error) {
+	table, err := c.resolveTable(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	condition, args, err := c.keyCondition(ctx, table, key, 1)
+	if err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", c.quote(table), condition)
+
+	result, err := c.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return 0, ErrNotFound
+	}
+	return rowsAffected, nil
+}
+
+// scanDocuments reads all rows into documents, converting byte slices to strings
+func scanDocuments(rows *sql.Rows, capacity int) ([]Document, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	if capacity < 0 {
+		capacity = 0
+	}
+	documents := make([]Document, 0, capacity)
+
+	// Create scan destination slice with pointers for memory efficiency
+	values := make([]interface{}, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, err
+		}
+
+		doc := make(Document, len(columns))
+		for i, col := range columns {
+			if values[i] != nil {
+				// Convert byte arrays to strings for proper JSON serialization
+				if b, ok := values[i].([]byte); ok {
+					doc[col] = string(b)
+				} else {
+					doc[col] = values[i]
+				}
+			}
+		}
+		documents = append(documents, doc)
+	}
+
+	return documents, rows.Err()
+}
+
+// determineInputType maps a field name and native data type to a UI input type
+func determineInputType(fieldName, dataType string) string {
+	fieldNameLower := strings.ToLower(fieldName)
+	dataTypeLower := strings.ToLower(dataType)
+
+	// Check for image/photo fields first by name
+	if strings.Contains(fieldNameLower, "photo") ||
+		strings.Contains(fieldNameLower, "image") ||
+		strings.Contains(fieldNameLower, "picture") ||
+		strings.Contains(fieldNameLower, "avatar") ||
+		strings.Contains(fieldNameLower, "thumbnail") ||
+		strings.Contains(fieldNameLower, "logo") ||
+		strings.Contains(fieldNameLower, "icon") {
+		return "image"
+	}
+
+	// Check for email fields
+	if strings.Contains(fieldNameLower, "email") {
+		return "email"
+	}
+
+	// Check for URL fields
+	if strings.Contains(fieldNameLower, "url") || strings.Contains(fieldNameLower, "link") {
+		return "url"
+	}
+
+	// Check for password fields
+	if strings.Contains(fieldNameLower, "password") || strings.Contains(fieldNameLower, "pass") {
+		return "password"
+	}
+
+	// Check for phone fields
+	if strings.Contains(fieldNameLower, "phone") || strings.Contains(fieldNameLower, "tel") {
+		return "tel"
+	}
+
+	// Check for date/time fields
+	if strings.Contains(fieldNameLower, "date") || strings.Contains(fieldNameLower, "time") ||
+		strings.Contains(dataTypeLower, "date") || strings.Contains(dataTypeLower, "time") ||
+		strings.Contains(dataTypeLower, "timestamp") {
+		return "datetime-local"
+	}
+
+	// Check by data type
+	if strings.Contains(dataTypeLower, "int") || strings.Contains(dataTypeLower, "number") ||
+		strings.Contains(dataTypeLower, "decimal") || strings.Contains(dataTypeLower, "float") ||
+		strings.Contains(dataTypeLower, "double") {
+		return "number"
+	}
+
+	if strings.Contains(dataTypeLower, "bool") {
+		return "checkbox"
+	}
+
+	if strings.Contains(dataTypeLower, "text") || strings.Contains(dataTypeLower, "longtext") ||
+		strings.Contains(dataTypeLower, "mediumtext") {
+		return "textarea"
+	}
+
+	// Default to text
+	return "text"
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"db-manager-backend/models"
+	"db-manager-backend/sqlident"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDialect treats DatabaseConnection.Database as the path of an existing database
+// file inside the SQLite data directory
+var sqliteDialect = &sqlDialect{
+	driverName:      "sqlite",
+	ident:           sqlident.SQLite,
+	listTablesQuery: "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name",
+	searchCondition: "CAST(%s AS TEXT) LIKE %s",
+	// The driver ignores read-only transaction options
+	readOnlySession: "PRAGMA query_only = ON",
+	buildDSN: func(conn *models.DatabaseConnection) (string, error) {
+		path, err := sqlitePath(conn.Database)
+		if err != nil {
+			return "", err
+		}
+		// The path is escaped so that ? and # in file names cannot add parameters.
+		// mode=rw refuses to create a new, empty file for a mistyped path.
+		return "file:" + (&url.URL{Path: path}).EscapedPath() +
+			"?mode=rw&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)", nil
+	},
+	describe:   describeSQLite,
+	introspect: introspectSQLite,
+	explain:    explainSQLite,
+	precheck:   checkSQLiteFile,
+	validate: func(ctx context.Context, db *sql.DB) error {
+		// Reading the schema fails with "file is not a database" for non-SQLite files
+		var tables int
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&tables); err != nil {
+			return fmt.Errorf("invalid SQLite database: %v", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	RegisterDriver(&sqlDriver{dialect: sqliteDialect}, "sqlite", "sqlite3")
+}
+
+// errSQLiteFile is the only error returned for unusable paths, so that connections
+// cannot probe which files exist on the server
+var errSQLiteFile = errors.New("SQLite database file not found in the data directory")
+
+var (
+	sqliteDataDirMu sync.RWMutex
+	sqliteDataDir   = "data"
+)
+
+// SetSQLiteDataDir sets the directory SQLite database files must be in
+func SetSQLiteDataDir(dir string) {
+	sqliteDataDirMu.Lock()
+	defer sqliteDataDirMu.Unlock()
+	sqliteDataDir = dir
+}
+
+// sqlitePath resolves the path of a database file, relative to the data directory,
+// and fails unless it is a regular file inside it once symbolic links are followed
+func sqlitePath(database string) (string, error) {
+	if database == "" {
+		return "", fmt.Errorf("SQLite database file path is required")
+	}
+
+	sqliteDataDirMu.RLock()
+	dataDir := sqliteDataDir
+	sqliteDataDirMu.RUnlock()
+	if dataDir == "" {
+		return "", errSQLiteFile
+	}
+	root, err := filepath.Abs(dataDir)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return "", errSQLiteFile
+	}
+
+	path := database
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", errSQLiteFile
+	}
+	relative, err := filepath.Rel(root, path)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", errSQLiteFile
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", errSQLiteFile
+	}
+	return path, nil
+}
+
+// checkSQLiteFile verifies the configured path points to a regular file in the data
+// directory
+func checkSQLiteFile(conn *models.DatabaseConnection) error {
+	_, err := sqlitePath(conn.Database)
+	return err
+}
+
+// describeSQLite reads column information using the table_info pragma
+func describeSQLite(ctx context.Context, db *sql.DB, table string) ([]string, []string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var names, types []string
+	for rows.Next() {
+		var field, fieldType string
+		if err := rows.Scan(&field, &fieldType); err != nil {
+			log.Printf("Error scanning SQLite row: %v", err)
+			continue
+		}
+		names = append(names, field)
+		types = append(types, fieldType)
+	}
+	return names, types, rows.Err()
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"db-manager-backend/models"
+	"db-manager-backend/sqlident"
+)
+
+// FuzzSQLiteIdentifiers uses hostile table and column names through every statement the
+// SQL driver builds, against a real SQLite database. A name escaping its quotes would
+// fail the statement, touch the wrong data or drop the guard table.
+func FuzzSQLiteIdentifiers(f *testing.F) {
+	for _, names := range [][2]string{
+		{"users", "name"},
+		{`users"; DROP TABLE guard; --`, `name" = name OR "1`},
+		{"a`b", "c'd"},
+		{`x" UNION SELECT secret FROM guard --`, `"`},
+		{"ünïcödé", "表"},
+		{"with space", "--comment"},
+		{`\`, "/*"},
+	} {
+		f.Add(names[0], names[1])
+	}
+
+	dir := f.TempDir()
+	SetSQLiteDataDir(dir)
+	defer SetSQLiteDataDir("data")
+
+	setup, err := sql.Open("sqlite", filepath.Join(dir, "fuzz.db"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer setup.Close()
+	setup.SetMaxOpenConns(1)
+	if _, err := setup.Exec(`CREATE TABLE guard (secret TEXT); INSERT INTO guard VALUES ('kept')`); err != nil {
+		f.Fatal(err)
+	}
+
+	driver, err := GetDriver("sqlite")
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, table, column string) {
+		if sqlident.SQLite.Validate(table) != nil || sqlident.SQLite.Validate(column) != nil {
+			return
+		}
+		// Names SQLite reserves or the test itself uses
+		lower := strings.ToLower(table)
+		if lower == "guard" || strings.HasPrefix(lower, "sqlite_") || strings.EqualFold(column, "id") {
+			return
+		}
+
+		ident := sqlident.SQLite
+		if _, err := setup.Exec("CREATE TABLE " + ident.Quote(table) +
+			" (id INTEGER PRIMARY KEY, " + ident.Quote(column) + " TEXT)"); err != nil {
+			t.Fatalf("create %q (%q): %v", table, column, err)
+		}
+		defer setup.Exec("DROP TABLE " + ident.Quote(table))
+
+		ctx := context.Background()
+		conn, err := driver.Open(ctx, &models.DatabaseConnection{Type: "sqlite", Database: "fuzz.db"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if _, err := conn.Insert(ctx, table, Document{"id": 1, column: "first"}); err != nil {
+			t.Fatalf("insert into %q (%q): %v", table, column, err)
+		}
+		if _, err := conn.Insert(ctx, table, Document{"id": 2, column: "second"}); err != nil {
+			t.Fatalf("insert into %q (%q): %v", table, column, err)
+		}
+
+		opts := FindOptions{
+			Filters: []Filter{{Column: column, Operator: "eq", Value: "first"}},
+			Order:   []Sort{{Column: column, Desc: true}},
+			Select:  []string{column},
+			Search:  "fir",
+			Limit:   10,
+		}
+		docs, err := conn.Find(ctx, table, opts)
+		if err != nil {
+			t.Fatalf("find in %q (%q): %v", table, column, err)
+		}
+		if len(docs) != 1 || docs[0][column] != "first" {
+			t.Fatalf("find in %q (%q) returned %v", table, column, docs)
+		}
+		if count, err := conn.Count(ctx, table, opts); err != nil || count != 1 {
+			t.Fatalf("count in %q (%q) returned %d, %v", table, column, count, err)
+		}
+
+		if updated, err := conn.Update(ctx, table, IDKey("2"), Document{column: "changed"}); err != nil || updated != 1 {
+			t.Fatalf("update %q (%q) changed %d rows, %v", table, column, updated, err)
+		}
+		doc, err := conn.Get(ctx, table, IDKey("2"))
+		if err != nil || doc[column] != "changed" {
+			t.Fatalf("get from %q (%q) returned %v, %v", table, column, doc, err)
+		}
+		if deleted, err := conn.Delete(ctx, table, IDKey("1")); err != nil || deleted != 1 {
+			t.Fatalf("delete from %q (%q) removed %d rows, %v", table, column, deleted, err)
+		}
+
+		var secret string
+		if err := setup.QueryRow("SELECT secret FROM guard").Scan(&secret); err != nil || secret != "kept" {
+			t.Fatalf("%q (%q) changed the guard table: %q, %v", table, column, secret, err)
+		}
+	})
+}
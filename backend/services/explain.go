@@ -0,0 +1,393 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PlanNode is one operation of a query plan. Costs are in the units of the database's
+// planner and cannot be compared across databases.
+type PlanNode struct {
+	Type          string                 `json:"type"` // e.g. Seq Scan, Index Scan, COLLSCAN, IXSCAN
+	Relation      string                 `json:"relation,omitempty"`
+	Index         string                 `json:"index,omitempty"`
+	EstimatedRows *float64               `json:"estimated_rows,omitempty"`
+	ActualRows    *float64               `json:"actual_rows,omitempty"` // all loops together
+	Cost          *float64               `json:"cost,omitempty"`        // total cost estimate
+	ActualTimeMs  *float64               `json:"actual_time_ms,omitempty"`
+	Details       map[string]interface{} `json:"details,omitempty"` // conditions, sort keys, ...
+	Children      []*PlanNode            `json:"children,omitempty"`
+}
+
+// Plan is a normalized query plan together with the output of the database
+type Plan struct {
+	Root            *PlanNode       `json:"root"`
+	Analyzed        bool            `json:"analyzed"` // the query ran, actual rows and times are measured
+	PlanningTimeMs  *float64        `json:"planning_time_ms,omitempty"`
+	ExecutionTimeMs *float64        `json:"execution_time_ms,omitempty"`
+	Raw             json.RawMessage `json:"raw,omitempty"`
+}
+
+// ExplainOptions controls how a query is explained
+type ExplainOptions struct {
+	Analyze  bool // run the query to measure actual rows and times, where supported
+	ReadOnly bool // refuse statements that write
+	Timeout  time.Duration
+}
+
+// ExplainConn is implemented by sessions that explain the query of a listing
+type ExplainConn interface {
+	// ExplainFind explains the query Find runs for opts
+	ExplainFind(ctx context.Context, collection string, opts FindOptions, explain ExplainOptions) (*Plan, error)
+}
+
+// Explain explains a single SQL statement. With Analyze the statement runs in a
+// transaction that is always rolled back.
+func (c *sqlConn) Explain(ctx context.Context, statement string, opts ExplainOptions) (*Plan, error) {
+	statements := splitStatements(statement, c.dialect.syntax)
+	if len(statements) != 1 {
+		return nil, fmt.Errorf("%w: exactly one statement can be explained", ErrInvalidQuery)
+	}
+	if err := checkStatement(statements[0], opts.ReadOnly); err != nil {
+		return nil, err
+	}
+	return c.explain(ctx, statements[0].text, nil, opts)
+}
+
+func (c *sqlConn) ExplainFind(ctx context.Context, table string, opts FindOptions, explain ExplainOptions) (*Plan, error) {
+	query, args, err := c.findQuery(ctx, table, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.explain(ctx, query, args, explain)
+}
+
+func (c *sqlConn) explain(ctx context.Context, query string, args []interface{}, opts ExplainOptions) (*Plan, error) {
+	if c.dialect.explain == nil {
+		return nil, ErrUnsupported
+	}
+	if opts.Timeout <= 0 || opts.Timeout > MaxQueryTimeout {
+		opts.Timeout = DefaultQueryTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	// ANALYZE executes the statement, nothing it changes is kept
+	defer tx.Rollback()
+
+	plan, err := c.dialect.explain(ctx, tx, query, args, opts.Analyze)
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return plan, err
+}
+
+// explainPostgres runs EXPLAIN (FORMAT JSON), with ANALYZE and BUFFERS when asked
+func explainPostgres(ctx context.Context, tx *sql.Tx, query string, args []interface{}, analyze bool) (*Plan, error) {
+	options := "FORMAT JSON"
+	if analyze {
+		options = "ANALYZE, BUFFERS, FORMAT JSON"
+	}
+	var raw string
+	if err := tx.QueryRowContext(ctx, "EXPLAIN ("+options+") "+query, args...).Scan(&raw); err != nil {
+		return nil, err
+	}
+
+	var output []struct {
+		Plan          map[string]interface{} `json:"Plan"`
+		PlanningTime  *float64               `json:"Planning Time"`
+		ExecutionTime *float64               `json:"Execution Time"`
+	}
+	if err := json.Unmarshal([]byte(raw), &output); err != nil || len(output) == 0 {
+		return nil, fmt.Errorf("unexpected EXPLAIN output")
+	}
+	return &Plan{
+		Root:            postgresNode(output[0].Plan),
+		Analyzed:        analyze,
+		PlanningTimeMs:  output[0].PlanningTime,
+		ExecutionTimeMs: output[0].ExecutionTime,
+		Raw:             json.RawMessage(raw),
+	}, nil
+}
+
+// postgresDetails are the plan properties kept as details
+var postgresDetails = []string{
+	"Join Type", "Strategy", "Scan Direction", "Filter", "Index Cond", "Recheck Cond", "Hash Cond",
+	"Merge Cond", "Join Filter", "Sort Key", "Sort Method", "Group Key", "Rows Removed by Filter",
+	"Parent Relationship", "Subplan Name", "CTE Name", "Shared Hit Blocks", "Shared Read Blocks",
+}
+
+func postgresNode(node map[string]interface{}) *PlanNode {
+	result := &PlanNode{
+		Type:          planString(node["Node Type"]),
+		Relation:      planString(node["Relation Name"]),
+		Index:         planString(node["Index Name"]),
+		EstimatedRows: planNumber(node["Plan Rows"]),
+		Cost:          planNumber(node["Total Cost"]),
+	}
+	// Actual rows and times are averages per loop
+	loops := planNumber(node["Actual Loops"])
+	if rows := planNumber(node["Actual Rows"]); rows != nil && loops != nil {
+		total := *rows * *loops
+		result.ActualRows = &total
+	}
+	if ms := planNumber(node["Actual Total Time"]); ms != nil && loops != nil {
+		total := *ms * *loops
+		result.ActualTimeMs = &total
+	}
+	result.Details = planDetails(node, postgresDetails)
+
+	children, _ := node["Plans"].([]interface{})
+	for _, child := range children {
+		if child, ok := child.(map[string]interface{}); ok {
+			result.Children = append(result.Children, postgresNode(child))
+		}
+	}
+	return result
+}
+
+// explainMySQL runs EXPLAIN FORMAT=JSON. The JSON format has no actual rows or times.
+func explainMySQL(ctx context.Context, tx *sql.Tx, query string, args []interface{}, analyze bool) (*Plan, error) {
+	if analyze {
+		return nil, fmt.Errorf("%w: ANALYZE is not available for MySQL plans", ErrInvalidQuery)
+	}
+	var raw string
+	if err := tx.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+query, args...).Scan(&raw); err != nil {
+		return nil, err
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &output); err != nil {
+		return nil, fmt.Errorf("unexpected EXPLAIN output")
+	}
+	nodes := mysqlChildren(output)
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("unexpected EXPLAIN output")
+	}
+	return &Plan{Root: nodes[0], Raw: json.RawMessage(raw)}, nil
+}
+
+// mysqlOperations are the operations of MySQL's JSON plans, outermost first. Operations
+// without a name only group their children.
+var mysqlOperations = []struct{ key, name string }{
+	{"query_block", "Query Block"},
+	{"union_result", "Union"},
+	{"query_specifications", ""},
+	{"windowing", "Window"},
+	{"ordering_operation", "Sort"},
+	{"grouping_operation", "Group"},
+	{"duplicates_removal", "Distinct"},
+	{"buffer_result", "Buffer"},
+	{"nested_loop", "Nested Loop"},
+	{"table", "Table"},
+	{"materialized_from_subquery", "Materialize"},
+	{"attached_subqueries", "Subqueries"},
+	{"optimized_away_subqueries", "Subqueries"},
+}
+
+// mysqlAccessTypes name the access types of tables
+var mysqlAccessTypes = map[string]string{
+	"ALL":    "Full Table Scan",
+	"index":  "Full Index Scan",
+	"range":  "Index Range Scan",
+	"ref":    "Index Lookup",
+	"eq_ref": "Unique Index Lookup",
+	"const":  "Constant Lookup",
+	"system": "Constant Lookup",
+}
+
+var mysqlDetails = []string{
+	"access_type", "possible_keys", "used_key_parts", "attached_condition", "filtered",
+	"rows_examined_per_scan", "using_filesort", "using_temporary_table", "using_index", "message",
+}
+
+func mysqlChildren(value map[string]interface{}) []*PlanNode {
+	var nodes []*PlanNode
+	for _, operation := range mysqlOperations {
+		switch child := value[operation.key].(type) {
+		case map[string]interface{}:
+			nodes = append(nodes, mysqlNode(operation.key, operation.name, child))
+		case []interface{}:
+			group := &PlanNode{Type: operation.name}
+			for _, item := range child {
+				if item, ok := item.(map[string]interface{}); ok {
+					group.Children = append(group.Children, mysqlChildren(item)...)
+				}
+			}
+			if operation.name == "" {
+				nodes = append(nodes, group.Children...)
+			} else {
+				nodes = append(nodes, group)
+			}
+		}
+	}
+	return nodes
+}
+
+func mysqlNode(key, name string, value map[string]interface{}) *PlanNode {
+	node := &PlanNode{Type: name, Details: planDetails(value, mysqlDetails)}
+	if cost, ok := value["cost_info"].(map[string]interface{}); ok {
+		for _, field := range []string{"query_cost", "prefix_cost", "sort_cost"} {
+			if node.Cost = planNumber(cost[field]); node.Cost != nil {
+				break
+			}
+		}
+	}
+	if key == "table" {
+		access := planString(value["access_type"])
+		if node.Type = mysqlAccessTypes[access]; node.Type == "" {
+			node.Type = "Table Access (" + access + ")"
+		}
+		node.Relation = planString(value["table_name"])
+		node.Index = planString(value["key"])
+		if node.EstimatedRows = planNumber(value["rows_produced_per_join"]); node.EstimatedRows == nil {
+			node.EstimatedRows = planNumber(value["rows_examined_per_scan"])
+		}
+	}
+	node.Children = mysqlChildren(value)
+	return node
+}
+
+// explainSQLite runs EXPLAIN QUERY PLAN, which reports the steps of a plan without
+// rows or costs
+func explainSQLite(ctx context.Context, tx *sql.Tx, query string, args []interface{}, analyze bool) (*Plan, error) {
+	if analyze {
+		return nil, fmt.Errorf("%w: ANALYZE is not available for SQLite plans", ErrInvalidQuery)
+	}
+	rows, err := tx.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type step struct {
+		ID     int64  `json:"id"`
+		Parent int64  `json:"parent"`
+		Detail string `json:"detail"`
+	}
+	var steps []step
+	root := &PlanNode{Type: "Query Plan"}
+	nodes := map[int64]*PlanNode{0: root}
+	for rows.Next() {
+		var s step
+		var unused interface{}
+		if err := rows.Scan(&s.ID, &s.Parent, &unused, &s.Detail); err != nil {
+			return nil, err
+		}
+		steps = append(steps, s)
+
+		node := sqliteNode(s.Detail)
+		nodes[s.ID] = node
+		// Steps are listed after their parent
+		if parent, ok := nodes[s.Parent]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			root.Children = append(root.Children, node)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(steps)
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{Root: root, Raw: raw}, nil
+}
+
+// sqliteNode reads the table and index of a step such as
+// "SEARCH users USING INDEX idx_email (email=?)"
+func sqliteNode(detail string) *PlanNode {
+	node := &PlanNode{Type: detail, Details: map[string]interface{}{"detail": detail}}
+	words := strings.Fields(detail)
+	if len(words) < 2 || (words[0] != "SCAN" && words[0] != "SEARCH") {
+		return node
+	}
+	node.Type = words[0]
+	words = words[1:]
+	if words[0] == "TABLE" && len(words) > 1 {
+		words = words[1:] // older versions print SCAN TABLE name
+	}
+	node.Relation = words[0]
+	for i, word := range words {
+		if word == "INDEX" && i+1 < len(words) {
+			node.Index = words[i+1]
+			break
+		}
+		if word == "PRIMARY" && i+1 < len(words) && words[i+1] == "KEY" {
+			node.Index = "PRIMARY KEY"
+			break
+		}
+	}
+	return node
+}
+
+// planString and planNumber read plan properties of JSON output; numbers can be
+// encoded as strings
+func planString(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+func planNumber(value interface{}) *float64 {
+	switch v := value.(type) {
+	case float64:
+		return &v
+	case string:
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return &n
+		}
+	case map[string]interface{}:
+		// Extended JSON numbers such as {"$numberLong": "12"}
+		for _, key := range []string{"$numberLong", "$numberInt", "$numberDouble", "$numberDecimal"} {
+			if s, ok := v[key].(string); ok {
+				return planNumber(s)
+			}
+		}
+	}
+	return nil
+}
+
+// planDetails collects the properties named in keys, in snake case
+func planDetails(node map[string]interface{}, keys []string) map[string]interface{} {
+	details := make(map[string]interface{})
+	for _, key := range keys {
+		if value, ok := node[key]; ok {
+			details[snakeCase(key)] = value
+		}
+	}
+	if len(details) == 0 {
+		return nil
+	}
+	return details
+}
+
+// snakeCase converts "Index Cond" and "keyPattern" to index_cond and key_pattern
+func snakeCase(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		switch {
+		case r == ' ':
+			b.WriteByte('_')
+		case unicode.IsUpper(r):
+			if i > 0 && unicode.IsLower(rune(key[i-1])) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidQuery is returned when filters, sorting or field selection cannot be applied
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Filter operators of the query string language
+const (
+	OpEq    = "eq"
+	OpNeq   = "neq"
+	OpGt    = "gt"
+	OpGte   = "gte"
+	OpLt    = "lt"
+	OpLte   = "lte"
+	OpLike  = "like"  // * matches any sequence of characters
+	OpIlike = "ilike" // case-insensitive like
+	OpIn    = "in"
+	OpIs    = "is" // null, true or false
+)
+
+var filterOperators = map[string]bool{
+	OpEq: true, OpNeq: true, OpGt: true, OpGte: true, OpLt: true, OpLte: true,
+	OpLike: true, OpIlike: true, OpIn: true, OpIs: true,
+}
+
+// Limits of JSON filter trees
+const (
+	maxFilterDepth      = 8
+	maxFilterConditions = 100
+)
+
+// Filter is a condition on a single column or field. Values from the query string
+// are strings, values from JSON filters keep their JSON type.
+type Filter struct {
+	Column   string
+	Operator string
+	Negate   bool
+	Value    interface{}   // operand of every operator except in; "null", "true" or "false" for is
+	Values   []interface{} // operands of in
+}
+
+// text returns the operand of like and is filters
+func (f Filter) text() string {
+	if s, ok := f.Value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(f.Value)
+}
+
+// FilterGroup combines filters and nested groups with AND, or with OR when Or is set
+type FilterGroup struct {
+	Or      bool
+	Filters []Filter
+	Groups  []FilterGroup
+}
+
+// FilterExpr is the JSON form of a filter tree. A node is either a condition
+// {"field": "age", "operator": "gte", "value": 18, "not": false} or a group
+// {"and": [...]} / {"or": [...]} of nodes.
+type FilterExpr struct {
+	And      []FilterExpr `json:"and"`
+	Or       []FilterExpr `json:"or"`
+	Field    string       `json:"field"`
+	Operator string       `json:"operator"`
+	Value    interface{}  `json:"value"`
+	Not      bool         `json:"not"`
+}
+
+// Sort orders results by a column
+type Sort struct {
+	Column string
+	Desc   bool
+}
+
+// ParseFilter parses a query string condition such as "gte.18", "like.*smith*",
+// "in.(a,b)", "is.null" or "not.eq.active" on the given column
+func ParseFilter(column, expr string) (Filter, error) {
+	filter := Filter{Column: column}
+	if strings.HasPrefix(expr, "not.") {
+		filter.Negate = true
+		expr = strings.TrimPrefix(expr, "not.")
+	}
+
+	operator, value, ok := strings.Cut(expr, ".")
+	if !ok || !filterOperators[operator] {
+		return filter, fmt.Errorf("%w: filter on %s must look like operator.value, e.g. %s=eq.value", ErrInvalidQuery, column, column)
+	}
+	filter.Operator = operator
+
+	switch operator {
+	case OpIn:
+		if !strings.HasPrefix(value, "(") || !strings.HasSuffix(value, ")") {
+			return filter, fmt.Errorf("%w: in filter on %s must look like in.(a,b)", ErrInvalidQuery, column)
+		}
+		for _, item := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "("), ")"), ",") {
+			filter.Values = append(filter.Values, item)
+		}
+	case OpIs:
+		value = strings.ToLower(value)
+		if value != "null" && value != "true" && value != "false" {
+			return filter, fmt.Errorf("%w: is filter on %s accepts null, true or false", ErrInvalidQuery, column)
+		}
+		filter.Value = value
+	default:
+		filter.Value = value
+	}
+	return filter, nil
+}
+
+// ParseFilterJSON parses and validates a JSON filter tree
+func ParseFilterJSON(data []byte) (*FilterGroup, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var expr FilterExpr
+	if err := decoder.Decode(&expr); err != nil {
+		return nil, fmt.Errorf("%w: filter is not valid JSON: %v", ErrInvalidQuery, err)
+	}
+
+	conditions := 0
+	group, err := expr.group(1, &conditions)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// group converts a node to a filter group, wrapping single conditions
+func (e FilterExpr) group(depth int, conditions *int) (FilterGroup, error) {
+	if depth > maxFilterDepth {
+		return FilterGroup{}, fmt.Errorf("%w: filter is nested deeper than %d levels", ErrInvalidQuery, maxFilterDepth)
+	}
+
+	children := e.And
+	group := FilterGroup{}
+	switch {
+	case e.Field != "" && (e.And != nil || e.Or != nil):
+		return group, fmt.Errorf("%w: a filter node is either a condition or an and/or group", ErrInvalidQuery)
+	case e.And != nil && e.Or != nil:
+		return group, fmt.Errorf("%w: use nested groups to combine and with or", ErrInvalidQuery)
+	case e.Field != "":
+		filter, err := e.filter()
+		if err != nil {
+			return group, err
+		}
+		*conditions++
+		group.Filters = append(group.Filters, filter)
+		return group, nil
+	case e.Or != nil:
+		group.Or = true
+		children = e.Or
+	case e.And == nil:
+		// An empty object matches everything
+		return group, nil
+	}
+
+	for _, child := range children {
+		if child.Field != "" {
+			filter, err := child.filter()
+			if err != nil {
+				return group, err
+			}
+			*conditions++
+			group.Filters = append(group.Filters, filter)
+			continue
+		}
+		nested, err := child.group(depth+1, conditions)
+		if err != nil {
+			return group, err
+		}
+		group.Groups = append(group.Groups, nested)
+	}
+	if *conditions > maxFilterConditions {
+		return group, fmt.Errorf("%w: filter has more than %d conditions", ErrInvalidQuery, maxFilterConditions)
+	}
+	return group, nil
+}
+
+// filter validates a condition node and its operand
+func (e FilterExpr) filter() (Filter, error) {
+	filter := Filter{Column: e.Field, Operator: strings.ToLower(e.Operator), Negate: e.Not}
+	if !filterOperators[filter.Operator] {
+		return filter, fmt.Errorf("%w: unknown operator %q on %s", ErrInvalidQuery, e.Operator, e.Field)
+	}
+
+	switch filter.Operator {
+	case OpIn:
+		values, ok := e.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			return filter, fmt.Errorf("%w: in filter on %s needs a non-empty array", ErrInvalidQuery, e.Field)
+		}
+		for _, value := range values {
+			scalar, err := filterScalar(e.Field, value)
+			if err != nil {
+				return filter, err
+			}
+			filter.Values = append(filter.Values, scalar)
+		}
+	case OpIs:
+		switch v := e.Value.(type) {
+		case nil:
+			filter.Value = "null"
+		case bool:
+			filter.Value = strconv.FormatBool(v)
+		case string:
+			if v = strings.ToLower(v); v != "null" && v != "true" && v != "false" {
+				return filter, fmt.Errorf("%w: is filter on %s accepts null, true or false", ErrInvalidQuery, e.Field)
+			}
+			filter.Value = v
+		default:
+			return filter, fmt.Errorf("%w: is filter on %s accepts null, true or false", ErrInvalidQuery, e.Field)
+		}
+	case OpLike, OpIlike:
+		pattern, ok := e.Value.(string)
+		if !ok {
+			return filter, fmt.Errorf("%w: %s filter on %s needs a string pattern", ErrInvalidQuery, filter.Operator, e.Field)
+		}
+		filter.Value = pattern
+	default:
+		if e.Value == nil {
+			return filter, fmt.Errorf("%w: use the is operator to match null on %s", ErrInvalidQuery, e.Field)
+		}
+		scalar, err := filterScalar(e.Field, e.Value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Value = scalar
+	}
+	return filter, nil
+}
+
+// filterScalar accepts strings, numbers and booleans, converting JSON numbers to
+// int64 when they are whole
+func filterScalar(field string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string, bool:
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	default:
+		return nil, fmt.Errorf("%w: filter values on %s must be strings, numbers or booleans", ErrInvalidQuery, field)
+	}
+}
+
+// ParseOrder parses a comma separated sort list such as "created_at.desc,name"
+func ParseOrder(expr string) ([]Sort, error) {
+	var order []Sort
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		sort := Sort{Column: part}
+		if column, direction, ok := strings.Cut(part, "."); ok && isSortDirection(direction) {
+			sort.Column = column
+			sort.Desc = strings.EqualFold(direction, "desc")
+		}
+		if sort.Column == "" {
+			return nil, fmt.Errorf("%w: empty column in order %q", ErrInvalidQuery, expr)
+		}
+		order = append(order, sort)
+	}
+	return order, nil
+}
+
+func isSortDirection(direction string) bool {
+	return strings.EqualFold(direction, "asc") || strings.EqualFold(direction, "desc")
+}
+
+// ParseSelect parses a comma separated list of columns
+func ParseSelect(expr string) []string {
+	var columns []string
+	for _, column := range strings.Split(expr, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// likeEscape is the escape character of LIKE patterns. Backslash is avoided since
+// MySQL string literals would need it doubled.
+const likeEscape = "!"
+
+// likePattern converts a * wildcard pattern to SQL LIKE syntax, escaping LIKE
+// metacharacters present in the value
+func likePattern(value string) string {
+	value = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_").Replace(value)
+	return strings.ReplaceAll(value, "*", "%")
+}
+
+// sortOrder combines the sort list with the single sort field of the management UI
+func (opts FindOptions) sortOrder() []Sort {
+	if len(opts.Order) > 0 {
+		return opts.Order
+	}
+	if opts.SortField != "" {
+		return []Sort{{Column: opts.SortField, Desc: strings.EqualFold(opts.SortOrder, "desc")}}
+	}
+	return nil
+}
+
+// searchable returns the columns among candidates that the search term is matched against
+func (opts FindOptions) searchable(candidates []string) []string {
+	if len(opts.SearchColumns) == 0 {
+		return candidates
+	}
+	allowed := make(map[string]bool, len(opts.SearchColumns))
+	for _, column := range opts.SearchColumns {
+		allowed[column] = true
+	}
+	columns := make([]string, 0, len(candidates))
+	for _, column := range candidates {
+		if allowed[column] {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// Columns lists every column referenced by filters, sorting and selection
+func (opts FindOptions) Columns() []string {
+	var columns []string
+	for _, filter := range opts.Filters {
+		columns = append(columns, filter.Column)
+	}
+	if opts.Where != nil {
+		columns = opts.Where.columns(columns)
+	}
+	for _, sort := range opts.sortOrder() {
+		columns = append(columns, sort.Column)
+	}
+	return append(columns, opts.Select...)
+}
+
+func (g FilterGroup) columns(columns []string) []string {
+	for _, filter := range g.Filters {
+		columns = append(columns, filter.Column)
+	}
+	for _, group := range g.Groups {
+		columns = group.columns(columns)
+	}
+	return columns
+}
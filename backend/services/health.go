@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"db-manager-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// healthCheckConcurrency bounds how many connections are checked at the same time
+const healthCheckConcurrency = 5
+
+// HealthMonitor periodically checks every saved connection, records latency and
+// errors, and keeps DatabaseConnection.Status in sync with reachability
+type HealthMonitor struct {
+	db          *gorm.DB
+	connections *ConnectionManager
+	interval    time.Duration
+	timeout     time.Duration
+	retention   time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewHealthMonitor creates a monitor checking connections every interval and keeping
+// results for the retention period
+func NewHealthMonitor(db *gorm.DB, connections *ConnectionManager, interval, retention time.Duration) *HealthMonitor {
+	timeout := 10 * time.Second
+	if interval < timeout {
+		timeout = interval
+	}
+	return &HealthMonitor{
+		db:          db,
+		connections: connections,
+		interval:    interval,
+		timeout:     timeout,
+		retention:   retention,
+	}
+}
+
+// Start runs the monitor in the background until Stop is called
+func (m *HealthMonitor) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			m.CheckAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Printf("Health monitor started (interval %s, retention %s)", m.interval, m.retention)
+}
+
+// Stop ends the background loop and waits for the current round to finish
+func (m *HealthMonitor) Stop() {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+}
+
+// CheckAll checks every monitored connection once and prunes expired results
+func (m *HealthMonitor) CheckAll(ctx context.Context) {
+	// Load IDs first so a record that fails to decrypt does not stop the whole round
+	var ids []uuid.UUID
+	if err := m.db.Model(&models.DatabaseConnection{}).
+		Where("status IS NULL OR status <> ?", models.ConnectionStatusInactive).
+		Pluck("id", &ids).Error; err != nil {
+		log.Printf("Health monitor: failed to list connections: %v", err)
+		return
+	}
+
+	sem := make(chan struct{}, healthCheckConcurrency)
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id uuid.UUID) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			m.check(ctx, id)
+		}(id)
+	}
+	wg.Wait()
+
+	if m.retention > 0 {
+		cutoff := time.Now().Add(-m.retention)
+		if err := m.db.Where("checked_at < ?", cutoff).Delete(&models.ConnectionHealthCheck{}).Error; err != nil {
+			log.Printf("Health monitor: failed to prune results: %v", err)
+		}
+	}
+}
+
+// check records one result and flips the connection status when it changes
+func (m *HealthMonitor) check(ctx context.Context, id uuid.UUID) {
+	result := models.ConnectionHealthCheck{DatabaseID: id, CheckedAt: time.Now()}
+
+	var connection models.DatabaseConnection
+	err := m.db.Where("id = ?", id).First(&connection).Error
+	if err == nil {
+		checkCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		err = m.connections.Check(checkCtx, &connection)
+		cancel()
+		result.LatencyMs = time.Since(result.CheckedAt).Milliseconds()
+	}
+	if ctx.Err() != nil {
+		// Shutting down, the result would only reflect the cancellation
+		return
+	}
+
+	result.Healthy = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if err := m.db.Create(&result).Error; err != nil {
+		log.Printf("Health monitor: failed to record result for %s: %v", id, err)
+	}
+
+	status := models.ConnectionStatusActive
+	if !result.Healthy {
+		status = models.ConnectionStatusUnreachable
+	}
+	if connection.ID == uuid.Nil || connection.Status == status {
+		return
+	}
+
+	// UpdateColumn leaves updated_at alone, the connection itself was not edited
+	if err := m.db.Model(&models.DatabaseConnection{}).Where("id = ?", id).
+		UpdateColumn("status", status).Error; err != nil {
+		log.Printf("Health monitor: failed to update status of %s: %v", id, err)
+		return
+	}
+	log.Printf("Health monitor: connection %s (%s) is now %s", connection.Name, id, status)
+}
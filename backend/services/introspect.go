@@ -0,0 +1,444 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// TableSchema is the detailed structure of a table or collection
+type TableSchema struct {
+	Name              string             `json:"name"`
+	Columns           []ColumnInfo       `json:"columns"`
+	PrimaryKey        []string           `json:"primary_key"`
+	UniqueConstraints []UniqueConstraint `json:"unique_constraints"`
+	Indexes           []IndexInfo        `json:"indexes"`
+	ForeignKeys       []ForeignKey       `json:"foreign_keys"`
+	// Inferred is set when columns were derived from sampled documents
+	Inferred   bool `json:"inferred"`
+	SampleSize int  `json:"sample_size,omitempty"`
+}
+
+// ColumnInfo describes a column or document field in detail
+type ColumnInfo struct {
+	Name          string  `json:"name"`
+	NativeType    string  `json:"native_type"`
+	InputType     string  `json:"input_type"` // UI input hint, as returned by Schema
+	Nullable      bool    `json:"nullable"`
+	Default       *string `json:"default"`
+	AutoIncrement bool    `json:"auto_increment"`
+	PrimaryKey    bool    `json:"primary_key"`
+	Unique        bool    `json:"unique"` // the column alone is unique
+
+	// Statistics of inferred document fields
+	Frequency float64         `json:"frequency,omitempty"` // share of sampled documents containing the field
+	Optional  bool            `json:"optional,omitempty"`
+	Types     []TypeFrequency `json:"types,omitempty"`
+}
+
+// TypeFrequency counts how often a type was seen for an inferred field
+type TypeFrequency struct {
+	Type      string  `json:"type"`
+	Count     int     `json:"count"`
+	Frequency float64 `json:"frequency"`
+}
+
+// IndexInfo describes an index and its columns in key order
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
+}
+
+// UniqueConstraint is a set of columns whose combined values are unique
+type UniqueConstraint struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+// ForeignKey describes a reference from local columns to another table
+type ForeignKey struct {
+	Name              string   `json:"name"`
+	Columns           []string `json:"columns"`
+	ReferencedTable   string   `json:"referenced_table"`
+	ReferencedColumns []string `json:"referenced_columns"`
+	OnUpdate          string   `json:"on_update,omitempty"`
+	OnDelete          string   `json:"on_delete,omitempty"`
+}
+
+// Introspector is implemented by sessions able to describe keys, indexes and constraints.
+// Drivers without a fixed schema infer it from up to sampleSize documents.
+type Introspector interface {
+	Introspect(ctx context.Context, collection string, sampleSize int) (*TableSchema, error)
+}
+
+func (c *sqlConn) Introspect(ctx context.Context, table string, sampleSize int) (*TableSchema, error) {
+	if c.dialect.introspect == nil {
+		return nil, ErrUnsupported
+	}
+
+	schema, err := c.dialect.introspect(ctx, c.db, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(schema.Columns) == 0 {
+		return nil, ErrNotFound
+	}
+	schema.Name = table
+	finishSchema(schema)
+	return schema, nil
+}
+
+// finishSchema derives the primary key, unique constraints and per-column flags from
+// the indexes, and fills in UI input types
+func finishSchema(schema *TableSchema) {
+	schema.PrimaryKey = []string{}
+	schema.UniqueConstraints = []UniqueConstraint{}
+	if schema.Indexes == nil {
+		schema.Indexes = []IndexInfo{}
+	}
+	if schema.ForeignKeys == nil {
+		schema.ForeignKeys = []ForeignKey{}
+	}
+
+	// Unique constraints are backed by unique indexes in every supported engine
+	primary := make(map[string]bool)
+	unique := make(map[string]bool)
+	for _, index := range schema.Indexes {
+		switch {
+		case index.Primary:
+			schema.PrimaryKey = index.Columns
+			for _, column := range index.Columns {
+				primary[column] = true
+			}
+		case index.Unique:
+			schema.UniqueConstraints = append(schema.UniqueConstraints, UniqueConstraint{Name: index.Name, Columns: index.Columns})
+		}
+		if (index.Primary || index.Unique) && len(index.Columns) == 1 {
+			unique[index.Columns[0]] = true
+		}
+	}
+
+	for i := range schema.Columns {
+		column := &schema.Columns[i]
+		column.PrimaryKey = primary[column.Name]
+		column.Unique = unique[column.Name]
+		if column.InputType == "" {
+			column.InputType = determineInputType(column.Name, column.NativeType)
+		}
+	}
+}
+
+// appendIndexColumn adds a column to the named index, creating it on first use.
+// Rows must be ordered by index name and column position.
+func appendIndexColumn(indexes []IndexInfo, name, column string, unique, primary bool) []IndexInfo {
+	if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+		indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+		return indexes
+	}
+	return append(indexes, IndexInfo{Name: name, Columns: []string{column}, Unique: unique, Primary: primary})
+}
+
+// appendForeignKeyColumn adds a column pair to the named foreign key, creating it on
+// first use. Rows must be ordered by constraint name and column position.
+func appendForeignKeyColumn(keys []ForeignKey, fk ForeignKey, column, referenced string) []ForeignKey {
+	if n := len(keys); n > 0 && keys[n-1].Name == fk.Name {
+		keys[n-1].Columns = append(keys[n-1].Columns, column)
+		keys[n-1].ReferencedColumns = append(keys[n-1].ReferencedColumns, referenced)
+		return keys
+	}
+	fk.Columns = []string{column}
+	fk.ReferencedColumns = []string{referenced}
+	return append(keys, fk)
+}
+
+// introspectMySQL reads columns, indexes and foreign keys of a table in the current database
+func introspectMySQL(ctx context.Context, db *sql.DB, table string) (*TableSchema, error) {
+	schema := &TableSchema{}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, EXTRA
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION`, table)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var column ColumnInfo
+		var nullable, extra string
+		var defaultVal sql.NullString
+		if err := rows.Scan(&column.Name, &column.NativeType, &nullable, &defaultVal, &extra); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		column.Nullable = nullable == "YES"
+		if defaultVal.Valid {
+			column.Default = &defaultVal.String
+		}
+		column.AutoIncrement = strings.Contains(strings.ToLower(extra), "auto_increment")
+		schema.Columns = append(schema.Columns, column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT INDEX_NAME, COLUMN_NAME, NON_UNIQUE
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME IS NOT NULL
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`, table)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, column string
+		var nonUnique int
+		if err := rows.Scan(&name, &column, &nonUnique); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		schema.Indexes = appendIndexColumn(schema.Indexes, name, column, nonUnique == 0, name == "PRIMARY")
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME,
+			r.UPDATE_RULE, r.DELETE_RULE
+		FROM information_schema.KEY_COLUMN_USAGE k
+		JOIN information_schema.REFERENTIAL_CONSTRAINTS r
+			ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+		WHERE k.TABLE_SCHEMA = DATABASE() AND k.TABLE_NAME = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY k.CONSTRAINT_NAME, k.ORDINAL_POSITION`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fk ForeignKey
+		var column, referenced string
+		if err := rows.Scan(&fk.Name, &column, &fk.ReferencedTable, &referenced, &fk.OnUpdate, &fk.OnDelete); err != nil {
+			return nil, err
+		}
+		schema.ForeignKeys = appendForeignKeyColumn(schema.ForeignKeys, fk, column, referenced)
+	}
+	return schema, rows.Err()
+}
+
+// postgresReferentialActions maps pg_constraint action codes to their SQL names
+var postgresReferentialActions = map[string]string{
+	"a": "NO ACTION",
+	"r": "RESTRICT",
+	"c": "CASCADE",
+	"n": "SET NULL",
+	"d": "SET DEFAULT",
+}
+
+// introspectPostgres reads columns, indexes and foreign keys of a table in the public
+// schema from pg_catalog
+func introspectPostgres(ctx context.Context, db *sql.DB, table string) (*TableSchema, error) {
+	// PostgreSQL is case-sensitive, try the original name first and then lowercase
+	var oid uint32
+	found := false
+	for _, name := range []string{table, strings.ToLower(table)} {
+		err := db.QueryRowContext(ctx, `
+			SELECT c.oid FROM pg_catalog.pg_class c
+			JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = 'public' AND c.relname = $1 AND c.relkind IN ('r', 'p', 'v', 'm', 'f')`, name).Scan(&oid)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		break
+	}
+	schema := &TableSchema{}
+	if !found {
+		return schema, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT a.attname, pg_catalog.format_type(a.atttypid, a.atttypmod), NOT a.attnotnull,
+			pg_catalog.pg_get_expr(d.adbin, d.adrelid), a.attidentity <> ''
+		FROM pg_catalog.pg_attribute a
+		LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`, oid)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var column ColumnInfo
+		var defaultVal sql.NullString
+		var identity bool
+		if err := rows.Scan(&column.Name, &column.NativeType, &column.Nullable, &defaultVal, &identity); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if defaultVal.Valid {
+			column.Default = &defaultVal.String
+		}
+		// serial columns are backed by a sequence default, identity columns by attidentity
+		column.AutoIncrement = identity || strings.HasPrefix(defaultVal.String, "nextval(")
+		schema.Columns = append(schema.Columns, column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Expression columns of indexes have no attribute and are left out
+	rows, err = db.QueryContext(ctx, `
+		SELECT i.relname, a.attname, ix.indisunique, ix.indisprimary
+		FROM pg_catalog.pg_index ix
+		JOIN pg_catalog.pg_class i ON i.oid = ix.indexrelid
+		CROSS JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = ix.indrelid AND a.attnum = k.attnum
+		WHERE ix.indrelid = $1
+		ORDER BY i.relname, k.ord`, oid)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, column string
+		var unique, primary bool
+		if err := rows.Scan(&name, &column, &unique, &primary); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		schema.Indexes = appendIndexColumn(schema.Indexes, name, column, unique, primary)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT con.conname, a.attname, rc.relname, ra.attname, con.confupdtype, con.confdeltype
+		FROM pg_catalog.pg_constraint con
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, refnum, ord)
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+		JOIN pg_catalog.pg_class rc ON rc.oid = con.confrelid
+		JOIN pg_catalog.pg_attribute ra ON ra.attrelid = con.confrelid AND ra.attnum = k.refnum
+		WHERE con.conrelid = $1 AND con.contype = 'f'
+		ORDER BY con.conname, k.ord`, oid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fk ForeignKey
+		var column, referenced, onUpdate, onDelete string
+		if err := rows.Scan(&fk.Name, &column, &fk.ReferencedTable, &referenced, &onUpdate, &onDelete); err != nil {
+			return nil, err
+		}
+		fk.OnUpdate = postgresReferentialActions[onUpdate]
+		fk.OnDelete = postgresReferentialActions[onDelete]
+		schema.ForeignKeys = appendForeignKeyColumn(schema.ForeignKeys, fk, column, referenced)
+	}
+	return schema, rows.Err()
+}
+
+// introspectSQLite reads columns, indexes and foreign keys using the table pragmas
+func introspectSQLite(ctx context.Context, db *sql.DB, table string) (*TableSchema, error) {
+	schema := &TableSchema{}
+
+	rows, err := db.QueryContext(ctx, `SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, err
+	}
+	var primaryKey []string
+	var primaryPositions []int
+	for rows.Next() {
+		var column ColumnInfo
+		var notNull bool
+		var defaultVal sql.NullString
+		var pk int
+		if err := rows.Scan(&column.Name, &column.NativeType, &notNull, &defaultVal, &pk); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		column.Nullable = !notNull && pk == 0
+		if defaultVal.Valid {
+			column.Default = &defaultVal.String
+		}
+		if pk > 0 {
+			primaryKey = append(primaryKey, column.Name)
+			primaryPositions = append(primaryPositions, pk)
+		}
+		schema.Columns = append(schema.Columns, column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// pk holds the position of the column in the primary key
+	ordered := make([]string, len(primaryKey))
+	for i, position := range primaryPositions {
+		if position <= len(ordered) {
+			ordered[position-1] = primaryKey[i]
+		}
+	}
+	if len(ordered) > 0 {
+		schema.Indexes = append(schema.Indexes, IndexInfo{Name: "PRIMARY", Columns: ordered, Unique: true, Primary: true})
+	}
+	// A single INTEGER PRIMARY KEY aliases the rowid and is assigned automatically
+	if len(ordered) == 1 {
+		for i := range schema.Columns {
+			if schema.Columns[i].Name == ordered[0] && strings.EqualFold(schema.Columns[i].NativeType, "INTEGER") {
+				schema.Columns[i].AutoIncrement = true
+			}
+		}
+	}
+
+	// Primary key indexes are reported above, rowid tables have none
+	rows, err = db.QueryContext(ctx, `
+		SELECT l.name, l."unique", i.name
+		FROM pragma_index_list(?) l, pragma_index_info(l.name) i
+		WHERE l.origin <> 'pk' AND i.name IS NOT NULL
+		ORDER BY l.name, i.seqno`, table)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, column string
+		var unique bool
+		if err := rows.Scan(&name, &unique, &column); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		schema.Indexes = appendIndexColumn(schema.Indexes, name, column, unique, false)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Foreign keys are unnamed, the pragma id groups the columns of one key
+	rows, err = db.QueryContext(ctx, `SELECT id, "table", "from", "to", on_update, on_delete FROM pragma_foreign_key_list(?) ORDER BY id, seq`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fk ForeignKey
+		var id int
+		var column string
+		var referenced sql.NullString // NULL when referencing the primary key implicitly
+		if err := rows.Scan(&id, &fk.ReferencedTable, &column, &referenced, &fk.OnUpdate, &fk.OnDelete); err != nil {
+			return nil, err
+		}
+		fk.Name = fmt.Sprintf("fk_%s_%d", table, id)
+		schema.ForeignKeys = appendForeignKeyColumn(schema.ForeignKeys, fk, column, referenced.String)
+	}
+	return schema, rows.Err()
+}
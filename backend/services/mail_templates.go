@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Emails sent by the application
+const (
+	EmailInvitation         = "invitation"          // InvitationEmail to the invitee
+	EmailInvitationAccepted = "invitation_accepted" // InvitationEmail to the inviter
+	EmailInvitationRevoked  = "invitation_revoked"  // InvitationEmail to the invitee
+	EmailAccessRevoked      = "access_revoked"      // AccessEmail to the user who lost access
+)
+
+// InvitationEmail is the data of the invitation emails
+type InvitationEmail struct {
+	InviterEmail    string
+	InviteeEmail    string
+	DatabaseName    string
+	PermissionLevel string
+	Link            string
+	ExpiresAt       time.Time
+}
+
+// AccessEmail is the data of the emails about an existing access
+type AccessEmail struct {
+	ByEmail      string // user who made the change
+	DatabaseName string
+}
+
+// emailTemplate renders the subject and body of an email
+type emailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+var emailTemplates = map[string]emailTemplate{
+	EmailInvitation: newEmailTemplate(EmailInvitation, `{{.InviterEmail}} invited you to the database {{.DatabaseName}}`, `Hello,
+
+{{.InviterEmail}} invited you to the database "{{.DatabaseName}}" with {{.PermissionLevel}} access.
+
+Open this link to accept the invitation:
+{{.Link}}
+
+The invitation expires on {{.ExpiresAt.UTC.Format "January 2, 2006 15:04 MST"}}. If you were not expecting it, you can ignore this email.
+`),
+	EmailInvitationAccepted: newEmailTemplate(EmailInvitationAccepted, `{{.InviteeEmail}} accepted your invitation to {{.DatabaseName}}`, `Hello,
+
+{{.InviteeEmail}} accepted your invitation and now has {{.PermissionLevel}} access to the database "{{.DatabaseName}}".
+
+Manage who can access it at:
+{{.Link}}
+`),
+	EmailInvitationRevoked: newEmailTemplate(EmailInvitationRevoked, `Your invitation to {{.DatabaseName}} was withdrawn`, `Hello,
+
+The invitation {{.InviterEmail}} sent you to the database "{{.DatabaseName}}" was withdrawn and can no longer be accepted.
+`),
+	EmailAccessRevoked: newEmailTemplate(EmailAccessRevoked, `Your access to {{.DatabaseName}} was revoked`, `Hello,
+
+{{.ByEmail}} revoked your access to the database "{{.DatabaseName}}". It no longer appears in your shared databases.
+`),
+}
+
+func newEmailTemplate(name, subject, body string) emailTemplate {
+	return emailTemplate{
+		subject: template.Must(template.New(name).Option("missingkey=error").Parse(subject)),
+		body:    template.Must(template.New(name).Option("missingkey=error").Parse(body)),
+	}
+}
+
+// RenderEmail renders an email template for a recipient
+func RenderEmail(name, to string, data interface{}) (Email, error) {
+	tmpl, ok := emailTemplates[name]
+	if !ok {
+		return Email{}, fmt.Errorf("unknown email template: %s", name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return Email{}, fmt.Errorf("render %s email: %v", name, err)
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return Email{}, fmt.Errorf("render %s email: %v", name, err)
+	}
+	return Email{
+		To: to,
+		// Values such as database names must not break the subject line
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Body:    body.String(),
+	}, nil
+}
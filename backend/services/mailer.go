@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mail transports selected by MailerConfig.Transport
+const (
+	MailTransportSMTP = "smtp"
+	MailTransportFile = "file" // appends messages to a file, for development and tests
+	MailTransportLog  = "log"  // writes messages to the server log
+)
+
+// SMTP TLS modes
+const (
+	SMTPTLSStartTLS = "starttls" // upgrade with STARTTLS, servers not offering it are refused
+	SMTPTLSImplicit = "tls"      // TLS from the first byte, usually port 465
+	SMTPTLSNone     = "none"     // plain text, for servers on a trusted network only
+)
+
+// Email is a plain text message to a single recipient
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// MailerConfig selects and configures the mail transport
+type MailerConfig struct {
+	Transport string
+	From      string
+	File      string // file transport only
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPTLS      string
+	Timeout      time.Duration
+}
+
+// NewMailer creates the mailer of a configuration
+func NewMailer(cfg MailerConfig) (Mailer, error) {
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %v", cfg.From, err)
+	}
+
+	switch cfg.Transport {
+	case MailTransportSMTP:
+		if cfg.SMTPHost == "" {
+			return nil, errors.New("the smtp mail transport requires a host")
+		}
+		switch cfg.SMTPTLS {
+		case "":
+			cfg.SMTPTLS = SMTPTLSStartTLS
+		case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+		default:
+			return nil, fmt.Errorf("unsupported smtp tls mode: %s", cfg.SMTPTLS)
+		}
+		if cfg.SMTPPort == 0 {
+			cfg.SMTPPort = 587
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = 30 * time.Second
+		}
+		return &SMTPMailer{cfg: cfg}, nil
+	case MailTransportFile:
+		if cfg.File == "" {
+			return nil, errors.New("the file mail transport requires a path")
+		}
+		return &FileMailer{from: cfg.From, path: cfg.File}, nil
+	case MailTransportLog:
+		return &FileMailer{from: cfg.From}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mail transport: %s", cfg.Transport)
+	}
+}
+
+// SMTPMailer delivers emails through an SMTP server
+type SMTPMailer struct {
+	cfg     MailerConfig
+	rootCAs *x509.CertPool // trusted server certificates, the system's when nil
+}
+
+// Send delivers one email in its own SMTP session
+func (m *SMTPMailer) Send(ctx context.Context, email Email) error {
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %v", email.To, err)
+	}
+	message, err := formatEmail(m.cfg.From, email)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+	address := net.JoinHostPort(m.cfg.SMTPHost, strconv.Itoa(m.cfg.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: m.cfg.SMTPHost, MinVersion: tls.VersionTLS12, RootCAs: m.rootCAs}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if m.cfg.SMTPTLS == SMTPTLSImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.cfg.SMTPTLS == SMTPTLSStartTLS {
+		// Continuing in plain text would expose the credentials and emails to anyone
+		// able to strip STARTTLS from the server's reply
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server %s does not offer STARTTLS, set SMTP_TLS=none to send without TLS", address)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if m.cfg.SMTPUsername != "" {
+		// PlainAuth refuses to send the password over an unencrypted connection,
+		// except to localhost
+		auth := smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// FileMailer appends emails to a file, or writes them to the log without one
+type FileMailer struct {
+	from string
+	path string
+	mu   sync.Mutex
+}
+
+// Send records one email
+func (m *FileMailer) Send(ctx context.Context, email Email) error {
+	if _, err := mail.ParseAddress(email.To); err != nil {
+		return fmt.Errorf("invalid recipient %q: %v", email.To, err)
+	}
+	if m.path == "" {
+		log.Printf("Email to %s: %s\n%s", email.To, email.Subject, email.Body)
+		return nil
+	}
+
+	message, err := formatEmail(m.from, email)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(message, "\r\n"...)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// formatEmail builds the RFC 5322 message of a plain text email
+func formatEmail(from string, email Email) ([]byte, error) {
+	// Line breaks in headers would let a value add headers of its own
+	if strings.ContainsAny(email.To+email.Subject+from, "\r\n") {
+		return nil, errors.New("email headers cannot contain line breaks")
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", email.To)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: %s\r\n", messageID(from))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	// The writer turns line breaks into CRLF
+	body := quotedprintable.NewWriter(&message)
+	if _, err := body.Write([]byte(email.Body)); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	message.WriteString("\r\n")
+	return message.Bytes(), nil
+}
+
+// messageID returns a unique Message-ID in the domain of the sender
+func messageID(from string) string {
+	domain := "localhost"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(address.Address, "@"); at >= 0 {
+			domain = address.Address[at+1:]
+		}
+	}
+	random := make([]byte, 12)
+	rand.Read(random)
+	return fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(random), time.Now().UnixNano(), domain)
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"db-manager-backend/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// receivedEmail is a message accepted by fakeSMTP
+type receivedEmail struct {
+	from, to string
+	data     string
+	tls      bool // sent over TLS
+}
+
+// fakeSMTP is an in-process SMTP server accepting every message. It offers STARTTLS
+// when startTLS is set and speaks TLS from the first byte when implicit is set.
+type fakeSMTP struct {
+	listener net.Listener
+	config   *tls.Config
+	roots    *x509.CertPool // trust the server's certificate
+	startTLS bool
+	implicit bool
+	// reject answers MAIL FROM with a temporary failure while positive
+	reject int
+
+	mu       sync.Mutex
+	received []receivedEmail
+	commands []string
+}
+
+func newFakeSMTP(t *testing.T, startTLS, implicit bool) *fakeSMTP {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "smtp.test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(certificate)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTP{
+		listener: listener,
+		config:   &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		roots:    roots,
+		startTLS: startTLS,
+		implicit: implicit,
+	}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (s *fakeSMTP) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTP) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	secure := s.implicit
+	if secure {
+		conn = tls.Server(conn, s.config)
+	}
+	reader := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	}
+
+	reply("220 smtp.test ESMTP")
+	var email receivedEmail
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		s.mu.Unlock()
+
+		switch command {
+		case "EHLO", "HELO":
+			if s.startTLS && !secure {
+				reply("250-smtp.test", "250-STARTTLS", "250 8BITMIME")
+			} else {
+				reply("250-smtp.test", "250 8BITMIME")
+			}
+		case "STARTTLS":
+			if !s.startTLS || secure {
+				reply("502 not offered")
+				continue
+			}
+			reply("220 ready")
+			conn = tls.Server(conn, s.config)
+			reader = bufio.NewReader(conn)
+			secure = true
+		case "MAIL":
+			s.mu.Lock()
+			rejected := s.reject > 0
+			if rejected {
+				s.reject--
+			}
+			s.mu.Unlock()
+			if rejected {
+				reply("451 try again later")
+				continue
+			}
+			// Parameters such as BODY=8BITMIME follow the address
+			from, _, _ := strings.Cut(strings.TrimPrefix(line, "MAIL FROM:"), " ")
+			email = receivedEmail{from: from, tls: secure}
+			reply("250 ok")
+		case "RCPT":
+			email.to = strings.TrimPrefix(line, "RCPT TO:")
+			reply("250 ok")
+		case "DATA":
+			reply("354 end with a dot")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			email.data = data.String()
+			s.mu.Lock()
+			s.received = append(s.received, email)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// emails returns the messages the server accepted
+func (s *fakeSMTP) emails() []receivedEmail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]receivedEmail(nil), s.received...)
+}
+
+// sawCommand reports whether a client sent a command
+func (s *fakeSMTP) sawCommand(command string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, seen := range s.commands {
+		if seen == command {
+			return true
+		}
+	}
+	return false
+}
+
+// mailer returns an SMTP mailer sending to the server and trusting its certificate
+func (s *fakeSMTP) mailer(t *testing.T, mode string) *SMTPMailer {
+	t.Helper()
+	address := s.listener.Addr().(*net.TCPAddr)
+	mailer, err := NewMailer(MailerConfig{
+		Transport: MailTransportSMTP,
+		From:      "DB Manager <no-reply@example.com>",
+		SMTPHost:  address.IP.String(),
+		SMTPPort:  address.Port,
+		SMTPTLS:   mode,
+		Timeout:   5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	smtpMailer := mailer.(*SMTPMailer)
+	smtpMailer.rootCAs = s.roots
+	return smtpMailer
+}
+
+var testEmail = Email{To: "invitee@example.com", Subject: "Invitation to shop", Body: "Open this link to accept it"}
+
+func TestSMTPMailerDeliversOverSTARTTLS(t *testing.T) {
+	server := newFakeSMTP(t, true, false)
+	if err := server.mailer(t, SMTPTLSStartTLS).Send(context.Background(), testEmail); err != nil {
+		t.Fatal(err)
+	}
+
+	emails := server.emails()
+	if len(emails) != 1 {
+		t.Fatalf("the server received %d emails, want 1", len(emails))
+	}
+	email := emails[0]
+	if !email.tls {
+		t.Fatal("the email was sent before STARTTLS")
+	}
+	if email.from != "<no-reply@example.com>" || email.to != "<invitee@example.com>" {
+		t.Fatalf("the email went from %s to %s", email.from, email.to)
+	}
+	if !strings.Contains(email.data, "Subject: Invitation to shop\r\n") || !strings.Contains(email.data, "Open this link to accept it") {
+		t.Fatalf("the server received %q", email.data)
+	}
+}
+
+func TestSMTPMailerRefusesServersWithoutSTARTTLS(t *testing.T) {
+	server := newFakeSMTP(t, false, false)
+	err := server.mailer(t, SMTPTLSStartTLS).Send(context.Background(), testEmail)
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("got %v, want an error about the missing STARTTLS", err)
+	}
+	if server.sawCommand("MAIL") || len(server.emails()) != 0 {
+		t.Fatal("the email was sent in plain text")
+	}
+}
+
+func TestSMTPMailerVerifiesTheServerCertificate(t *testing.T) {
+	server := newFakeSMTP(t, true, false)
+	mailer := server.mailer(t, SMTPTLSStartTLS)
+	mailer.rootCAs = x509.NewCertPool()
+	if err := mailer.Send(context.Background(), testEmail); err == nil {
+		t.Fatal("an untrusted certificate was accepted")
+	}
+	if len(server.emails()) != 0 {
+		t.Fatal("the email was sent to an untrusted server")
+	}
+}
+
+func TestSMTPMailerImplicitTLS(t *testing.T) {
+	server := newFakeSMTP(t, false, true)
+	if err := server.mailer(t, SMTPTLSImplicit).Send(context.Background(), testEmail); err != nil {
+		t.Fatal(err)
+	}
+	if emails := server.emails(); len(emails) != 1 || !emails[0].tls {
+		t.Fatalf("the server received %v, want one email over TLS", emails)
+	}
+}
+
+func TestSMTPMailerSendsPlainTextOnlyWithoutTLS(t *testing.T) {
+	server := newFakeSMTP(t, false, false)
+	if err := server.mailer(t, SMTPTLSNone).Send(context.Background(), testEmail); err != nil {
+		t.Fatal(err)
+	}
+	if emails := server.emails(); len(emails) != 1 || emails[0].tls {
+		t.Fatalf("the server received %v, want one email in plain text", emails)
+	}
+}
+
+func TestOutboxRetriesUntilTheServerAcceptsEmails(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/outbox.db"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.OutboundEmail{}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newFakeSMTP(t, true, false)
+	server.reject = 1
+	outbox := NewOutbox(db, server.mailer(t, SMTPTLSStartTLS), time.Millisecond, 3, 0)
+	if err := outbox.Enqueue(db, EmailAccessRevoked, "user@example.com", AccessEmail{ByEmail: "owner@example.com", DatabaseName: "shop"}); err != nil {
+		t.Fatal(err)
+	}
+
+	outbox.Flush(context.Background())
+	var email models.OutboundEmail
+	if err := db.First(&email).Error; err != nil {
+		t.Fatal(err)
+	}
+	if email.Status != models.EmailStatusPending || email.Attempts != 1 || !strings.Contains(email.LastError, "451") {
+		t.Fatalf("after a rejected attempt the email is %s after %d attempts (%q)", email.Status, email.Attempts, email.LastError)
+	}
+
+	// Wait for the backoff of the first attempt
+	time.Sleep(10 * time.Millisecond)
+	outbox.Flush(context.Background())
+	if err := db.First(&email).Error; err != nil {
+		t.Fatal(err)
+	}
+	if email.Status != models.EmailStatusSent || email.Attempts != 2 {
+		t.Fatalf("the email is %s after %d attempts (%q), want sent after 2", email.Status, email.Attempts, email.LastError)
+	}
+	if emails := server.emails(); len(emails) != 1 || emails[0].to != "<user@example.com>" {
+		t.Fatalf("the server received %v", emails)
+	}
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"db-manager-backend/models"
+)
+
+// ErrPoolExhausted is returned when every pooled connection is in use and the pool is full
+var ErrPoolExhausted = errors.New("connection pool exhausted")
+
+// pingAfter is how long a pooled connection may sit unused before it is pinged on reuse
+const pingAfter = 30 * time.Second
+
+// ConnectionManager shares driver sessions between requests and handlers. Sessions are
+// keyed by connection ID and credential version, so editing a connection never reuses
+// a session opened with the old settings. The pool is bounded and idle sessions are
+// closed in the background.
+type ConnectionManager struct {
+	service     *DatabaseService
+	maxSize     int
+	idleTimeout time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*pooledConn // connection ID -> session
+	hits    uint64
+	misses  uint64
+	evicted uint64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type pooledConn struct {
+	conn     Conn
+	close    func() // closes the session and its SSH tunnel
+	id       string
+	dbType   string
+	version  string
+	refs     int
+	lastUsed time.Time
+	opened   time.Time
+	retired  bool // removed from the pool, closed once released
+}
+
+// PoolStats describes the state of the connection manager
+type PoolStats struct {
+	Size        int                `json:"pool_size"`
+	MaxSize     int                `json:"max_size"`
+	InUse       int                `json:"in_use"`
+	Idle        int                `json:"idle"`
+	Hits        uint64             `json:"hits"`
+	Misses      uint64             `json:"misses"`
+	Evictions   uint64             `json:"evictions"`
+	IdleTimeout string             `json:"idle_timeout"`
+	Connections []PooledConnection `json:"connections"`
+}
+
+// PooledConnection describes one pooled session
+type PooledConnection struct {
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	InUse           int    `json:"in_use"`
+	IdleSeconds     int64  `json:"idle_seconds"`
+	AgeSeconds      int64  `json:"age_seconds"`
+	OpenConnections int    `json:"open_connections,omitempty"` // database/sql handles only
+}
+
+// NewConnectionManager creates a manager holding at most maxSize sessions and
+// closing sessions unused for idleTimeout
+func NewConnectionManager(service *DatabaseService, maxSize int, idleTimeout time.Duration) *ConnectionManager {
+	if maxSize <= 0 {
+		maxSize = 50
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = 10 * time.Minute
+	}
+
+	m := &ConnectionManager{
+		service:     service,
+		maxSize:     maxSize,
+		idleTimeout: idleTimeout,
+		entries:     make(map[string]*pooledConn),
+		stop:        make(chan struct{}),
+	}
+	go m.evictIdleLoop()
+	return m
+}
+
+// credentialVersion fingerprints every setting used to open a session
+func credentialVersion(conn *models.DatabaseConnection) string {
+	hash := sha256.New()
+	for _, part := range []string{
+		conn.Type, conn.Host, strconv.Itoa(conn.Port), conn.Database, conn.Username, conn.Password,
+		conn.AuthMethod, conn.SSLMode, conn.SSLCert, conn.SSLKey, conn.SSLRootCert, conn.ConnectionString,
+		conn.SSHHost, strconv.Itoa(conn.SSHPort), conn.SSHUser, conn.SSHPassword, conn.SSHPrivateKey,
+		conn.SSHHostFingerprint,
+	} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Acquire returns a shared session for the saved connection. The release function
+// must be called once the caller is done; the session must not be closed directly.
+func (m *ConnectionManager) Acquire(ctx context.Context, connection *models.DatabaseConnection) (Conn, func(), error) {
+	id := connection.ID.String()
+	version := credentialVersion(connection)
+
+	m.mu.Lock()
+	entry := m.entries[id]
+	if entry != nil && entry.version != version {
+		// The connection was edited since the session was opened
+		m.retireLocked(entry)
+		entry = nil
+	}
+	if entry != nil {
+		entry.refs++
+		recent := time.Since(entry.lastUsed) <= pingAfter
+		if recent {
+			m.hits++
+		}
+		m.mu.Unlock()
+
+		if recent {
+			return entry.conn, m.releaseFunc(entry), nil
+		}
+		if entry.conn.Ping(ctx) == nil {
+			m.mu.Lock()
+			m.hits++
+			m.mu.Unlock()
+			return entry.conn, m.releaseFunc(entry), nil
+		}
+
+		// Drop the dead session and open a new one below. It may have been retired
+		// meanwhile, so releasing our reference is what closes it once unused.
+		m.mu.Lock()
+		m.retireLocked(entry)
+		m.mu.Unlock()
+		m.release(entry, false)
+	} else {
+		m.mu.Unlock()
+	}
+
+	conn, closeConn, err := m.service.Open(ctx, connection)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Another request may have opened the same version meanwhile
+	if existing := m.entries[id]; existing != nil && existing.version == version {
+		go closeConn()
+		existing.refs++
+		m.hits++
+		return existing.conn, m.releaseFunc(existing), nil
+	} else if existing != nil {
+		m.retireLocked(existing)
+	}
+
+	if len(m.entries) >= m.maxSize && !m.evictLRULocked() {
+		go closeConn()
+		return nil, nil, ErrPoolExhausted
+	}
+
+	now := time.Now()
+	entry = &pooledConn{
+		conn:     conn,
+		close:    closeConn,
+		id:       id,
+		dbType:   connection.Type,
+		version:  version,
+		refs:     1,
+		lastUsed: now,
+		opened:   now,
+	}
+	m.entries[id] = entry
+	m.misses++
+	return conn, m.releaseFunc(entry), nil
+}
+
+// releaseFunc returns an idempotent release callback for one acquisition
+func (m *ConnectionManager) releaseFunc(entry *pooledConn) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.release(entry, true)
+		})
+	}
+}
+
+// release drops one reference, closing retired sessions once unused. Background
+// checks do not touch lastUsed so they never keep an idle session alive.
+func (m *ConnectionManager) release(entry *pooledConn, touch bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.refs--
+	if touch {
+		entry.lastUsed = time.Now()
+	}
+	if entry.retired && entry.refs == 0 {
+		go entry.close()
+	}
+}
+
+// Check verifies a connection is reachable. A pooled session is pinged when present,
+// otherwise a fresh session is tested and closed without being added to the pool.
+func (m *ConnectionManager) Check(ctx context.Context, connection *models.DatabaseConnection) error {
+	m.mu.Lock()
+	entry := m.entries[connection.ID.String()]
+	if entry == nil || entry.version != credentialVersion(connection) {
+		m.mu.Unlock()
+		return m.service.Test(ctx, connection)
+	}
+	entry.refs++
+	m.mu.Unlock()
+
+	defer m.release(entry, false)
+	return entry.conn.Ping(ctx)
+}
+
+// retireLocked removes an entry from the pool, closing it once no request uses it
+func (m *ConnectionManager) retireLocked(entry *pooledConn) {
+	if m.entries[entry.id] == entry {
+		delete(m.entries, entry.id)
+	}
+	if entry.retired {
+		return
+	}
+	entry.retired = true
+	if entry.refs == 0 {
+		go entry.close()
+	}
+}
+
+// evictLRULocked closes the least recently used idle session to make room
+func (m *ConnectionManager) evictLRULocked() bool {
+	var oldest *pooledConn
+	for _, entry := range m.entries {
+		if entry.refs == 0 && (oldest == nil || entry.lastUsed.Before(oldest.lastUsed)) {
+			oldest = entry
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	m.retireLocked(oldest)
+	m.evicted++
+	return true
+}
+
+// Invalidate closes the pooled session of a connection that was edited or deleted,
+// along with its SSH tunnel unless another session shares it
+func (m *ConnectionManager) Invalidate(connectionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, exists := m.entries[connectionID]; exists {
+		m.retireLocked(entry)
+		log.Printf("Connection pool: invalidated session for %s", connectionID)
+	}
+}
+
+// evictIdleLoop periodically closes sessions unused for longer than the idle timeout
+func (m *ConnectionManager) evictIdleLoop() {
+	interval := m.idleTimeout / 2
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.evictIdle()
+		}
+	}
+}
+
+func (m *ConnectionManager) evictIdle() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, entry := range m.entries {
+		if entry.refs == 0 && time.Since(entry.lastUsed) > m.idleTimeout {
+			m.retireLocked(entry)
+			m.evicted++
+		}
+	}
+}
+
+// Stats reports pool usage
+func (m *ConnectionManager) Stats() PoolStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := PoolStats{
+		Size:        len(m.entries),
+		MaxSize:     m.maxSize,
+		Hits:        m.hits,
+		Misses:      m.misses,
+		Evictions:   m.evicted,
+		IdleTimeout: m.idleTimeout.String(),
+		Connections: make([]PooledConnection, 0, len(m.entries)),
+	}
+
+	now := time.Now()
+	for _, entry := range m.entries {
+		if entry.refs > 0 {
+			stats.InUse++
+		} else {
+			stats.Idle++
+		}
+
+		info := PooledConnection{
+			ID:          entry.id,
+			Type:        entry.dbType,
+			InUse:       entry.refs,
+			IdleSeconds: int64(now.Sub(entry.lastUsed).Seconds()),
+			AgeSeconds:  int64(now.Sub(entry.opened).Seconds()),
+		}
+		if sqlStats, ok := entry.conn.(interface{ Stats() sql.DBStats }); ok {
+			info.OpenConnections = sqlStats.Stats().OpenConnections
+		}
+		stats.Connections = append(stats.Connections, info)
+	}
+	return stats
+}
+
+// Close stops background eviction and closes every pooled session
+func (m *ConnectionManager) Close() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, entry := range m.entries {
+		m.retireLocked(entry)
+	}
+}
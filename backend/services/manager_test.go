@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"db-manager-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// stubConn is a session whose ping can be made to fail
+type stubConn struct {
+	Conn
+	ping   func() error
+	closed atomic.Bool
+}
+
+func (c *stubConn) Ping(ctx context.Context) error { return c.ping() }
+
+func (c *stubConn) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+// stubDriver hands out the sessions queued by a test
+type stubDriver struct {
+	sessions chan *stubConn
+}
+
+func (d *stubDriver) Kind() string { return KindKeyValue }
+
+func (d *stubDriver) Test(ctx context.Context, conn *models.DatabaseConnection) error { return nil }
+
+func (d *stubDriver) Open(ctx context.Context, conn *models.DatabaseConnection) (Conn, error) {
+	return <-d.sessions, nil
+}
+
+var stubSessions = &stubDriver{sessions: make(chan *stubConn, 4)}
+
+func init() {
+	RegisterDriver(stubSessions, "stub")
+}
+
+func TestPoolClosesDeadSessionsRetiredWhilePinged(t *testing.T) {
+	manager := NewConnectionManager(NewDatabaseService(), 10, time.Hour)
+	defer manager.Close()
+	connection := &models.DatabaseConnection{ID: uuid.New(), Type: "stub"}
+
+	dead := &stubConn{ping: func() error { return nil }}
+	stubSessions.sessions <- dead
+	_, release, err := manager.Acquire(context.Background(), connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	// The next acquisition pings the idle session, which is invalidated meanwhile
+	manager.mu.Lock()
+	manager.entries[connection.ID.String()].lastUsed = time.Now().Add(-time.Hour)
+	manager.mu.Unlock()
+	dead.ping = func() error {
+		manager.Invalidate(connection.ID.String())
+		return errors.New("connection reset")
+	}
+
+	fresh := &stubConn{ping: func() error { return nil }}
+	stubSessions.sessions <- fresh
+	session, release, err := manager.Acquire(context.Background(), connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if session != fresh {
+		t.Fatal("the dead session was reused")
+	}
+	waitFor(t, "the dead session to close", dead.closed.Load)
+}
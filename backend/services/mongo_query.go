@@ -0,0 +1,432 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NativeQuery is a find or aggregate request in the query language of a document
+// database. Filter, Projection, Sort and Pipeline are MongoDB Extended JSON, relaxed
+// or canonical.
+type NativeQuery struct {
+	Filter     json.RawMessage
+	Projection json.RawMessage
+	Sort       json.RawMessage
+	Pipeline   json.RawMessage
+	Skip       int64
+	Limit      int // documents returned, DefaultQueryRows when 0, at most MaxQueryRows
+	Timeout    time.Duration
+	Explain    bool // return the query plan instead of running the query
+	ReadOnly   bool // refuse pipelines writing to collections
+	// Values replacing {"$param": "name"} placeholders of the pipeline. When nil,
+	// pipelines run as written.
+	Params map[string]interface{}
+}
+
+// NativeResult holds documents as relaxed Extended JSON, so ObjectIds, dates and
+// decimals keep their type
+type NativeResult struct {
+	Documents  []json.RawMessage `json:"documents"`
+	Truncated  bool              `json:"truncated"` // more documents than the limit matched
+	Explain    json.RawMessage   `json:"explain,omitempty"`
+	Plan       *Plan             `json:"plan,omitempty"` // Explain normalized
+	DurationMs int64             `json:"duration_ms"`
+}
+
+// NativeQueryConn is implemented by sessions accepting native find and aggregate queries
+type NativeQueryConn interface {
+	NativeFind(ctx context.Context, collection string, query NativeQuery) (*NativeResult, error)
+	NativeAggregate(ctx context.Context, collection string, query NativeQuery) (*NativeResult, error)
+}
+
+// parseExtJSON decodes an Extended JSON value into out, which must be a pointer to a
+// struct with a single field tagged "v"
+func parseExtJSON(name string, raw json.RawMessage, out interface{}) error {
+	wrapped := append(append([]byte(`{"v":`), raw...), '}')
+	if err := bson.UnmarshalExtJSON(wrapped, false, out); err != nil {
+		return fmt.Errorf("%w: %s is not valid Extended JSON: %v", ErrInvalidQuery, name, err)
+	}
+	return nil
+}
+
+// parseDocument decodes an optional Extended JSON document
+func parseDocument(name string, raw json.RawMessage) (bson.D, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var value struct {
+		V bson.D `bson:"v"`
+	}
+	if err := parseExtJSON(name, raw, &value); err != nil {
+		return nil, err
+	}
+	return value.V, nil
+}
+
+// normalize applies the defaults and bounds shared with the SQL console
+func (q *NativeQuery) normalize() {
+	if q.Timeout <= 0 || q.Timeout > MaxQueryTimeout {
+		q.Timeout = DefaultQueryTimeout
+	}
+	if q.Limit <= 0 || q.Limit > MaxQueryRows {
+		q.Limit = DefaultQueryRows
+	}
+	if q.Skip < 0 {
+		q.Skip = 0
+	}
+}
+
+func (c *mongoConn) NativeFind(ctx context.Context, collection string, query NativeQuery) (*NativeResult, error) {
+	query.normalize()
+	filter, err := parseDocument("filter", query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	projection, err := parseDocument("projection", query.Projection)
+	if err != nil {
+		return nil, err
+	}
+	sort, err := parseDocument("sort", query.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, query.Timeout)
+	defer cancel()
+	started := time.Now()
+
+	if query.Explain {
+		command := bson.D{{Key: "find", Value: collection}, {Key: "filter", Value: filter}}
+		if projection != nil {
+			command = append(command, bson.E{Key: "projection", Value: projection})
+		}
+		if sort != nil {
+			command = append(command, bson.E{Key: "sort", Value: sort})
+		}
+		command = append(command, bson.E{Key: "skip", Value: query.Skip}, bson.E{Key: "limit", Value: query.Limit})
+		return c.explainNative(ctx, collection, command, "executionStats", started)
+	}
+
+	findOptions := options.Find().
+		SetMaxTime(query.Timeout).
+		SetSkip(query.Skip).
+		SetLimit(int64(query.Limit) + 1) // one more document tells whether the result was truncated
+	if projection != nil {
+		findOptions.SetProjection(projection)
+	}
+	if sort != nil {
+		findOptions.SetSort(sort)
+	}
+
+	cursor, err := c.db.Collection(collection).Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	return readNative(ctx, cursor, query.Limit, started)
+}
+
+func (c *mongoConn) NativeAggregate(ctx context.Context, collection string, query NativeQuery) (*NativeResult, error) {
+	query.normalize()
+	if len(query.Pipeline) == 0 {
+		return nil, fmt.Errorf("%w: pipeline is required", ErrInvalidQuery)
+	}
+	var value struct {
+		V []bson.D `bson:"v"`
+	}
+	if err := parseExtJSON("pipeline", query.Pipeline, &value); err != nil {
+		return nil, err
+	}
+	pipeline := value.V
+	if pipeline == nil {
+		pipeline = []bson.D{}
+	}
+	if query.Params != nil {
+		for i, stage := range pipeline {
+			bound, err := bindPipeline(stage, query.Params)
+			if err != nil {
+				return nil, err
+			}
+			pipeline[i] = bound.(bson.D)
+		}
+	}
+
+	writes := false
+	for _, stage := range pipeline {
+		if stageWrites(stage) {
+			writes = true
+		}
+	}
+	if writes && query.ReadOnly {
+		return nil, fmt.Errorf("%w: $out and $merge are not allowed with read-only access", ErrInvalidQuery)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, query.Timeout)
+	defer cancel()
+	started := time.Now()
+
+	if query.Explain {
+		// Pipelines writing with $out or $merge can only be planned, not executed
+		verbosity := "executionStats"
+		if writes {
+			verbosity = "queryPlanner"
+		}
+		return c.explainNative(ctx, collection, bson.D{
+			{Key: "aggregate", Value: collection},
+			{Key: "pipeline", Value: pipeline},
+			{Key: "cursor", Value: bson.D{}},
+		}, verbosity, started)
+	}
+
+	// $out and $merge must stay the last stage, such pipelines return no documents
+	if !writes {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: query.Limit + 1}})
+	}
+	cursor, err := c.db.Collection(collection).Aggregate(ctx, pipeline, options.Aggregate().SetMaxTime(query.Timeout))
+	if err != nil {
+		return nil, err
+	}
+	return readNative(ctx, cursor, query.Limit, started)
+}
+
+// stageWrites reports whether a stage, or a pipeline nested in it, writes to a collection
+func stageWrites(value interface{}) bool {
+	switch v := value.(type) {
+	case bson.D:
+		for _, element := range v {
+			if element.Key == "$out" || element.Key == "$merge" || stageWrites(element.Value) {
+				return true
+			}
+		}
+	case bson.A:
+		for _, item := range v {
+			if stageWrites(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bindPipeline replaces {"$param": "name"} documents nested in value with the value
+// of the parameter
+func bindPipeline(value interface{}, params map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case bson.D:
+		if len(v) == 1 && v[0].Key == "$param" {
+			name, ok := v[0].Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: $param must name a parameter", ErrInvalidQuery)
+			}
+			bound, ok := params[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown parameter %s", ErrInvalidQuery, name)
+			}
+			return bound, nil
+		}
+		for i, element := range v {
+			bound, err := bindPipeline(element.Value, params)
+			if err != nil {
+				return nil, err
+			}
+			v[i].Value = bound
+		}
+	case bson.A:
+		for i, item := range v {
+			bound, err := bindPipeline(item, params)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = bound
+		}
+	}
+	return value, nil
+}
+
+// explainNative explains a find or aggregate command for a native query
+func (c *mongoConn) explainNative(ctx context.Context, collection string, command bson.D, verbosity string, started time.Time) (*NativeResult, error) {
+	plan, err := c.explain(ctx, collection, command, verbosity)
+	if err != nil {
+		return nil, err
+	}
+	raw := plan.Raw
+	plan.Raw = nil
+	return &NativeResult{
+		Documents:  []json.RawMessage{},
+		Explain:    raw,
+		Plan:       plan,
+		DurationMs: time.Since(started).Milliseconds(),
+	}, nil
+}
+
+func (c *mongoConn) ExplainFind(ctx context.Context, collection string, opts FindOptions, explain ExplainOptions) (*Plan, error) {
+	filter, err := c.findFilter(ctx, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+	if explain.Timeout <= 0 || explain.Timeout > MaxQueryTimeout {
+		explain.Timeout = DefaultQueryTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, explain.Timeout)
+	defer cancel()
+
+	command := bson.D{{Key: "find", Value: collection}, {Key: "filter", Value: filter}}
+	if sort := findSort(opts); sort != nil {
+		command = append(command, bson.E{Key: "sort", Value: sort})
+	}
+	if projection := findProjection(opts); projection != nil {
+		command = append(command, bson.E{Key: "projection", Value: projection})
+	}
+	if opts.Offset > 0 {
+		command = append(command, bson.E{Key: "skip", Value: int64(opts.Offset)})
+	}
+	if opts.Limit > 0 {
+		command = append(command, bson.E{Key: "limit", Value: int64(opts.Limit)})
+	}
+	// A find only reads, so its plan is always executed
+	return c.explain(ctx, collection, command, "executionStats")
+}
+
+// explain runs the explain command for a find or aggregate command
+func (c *mongoConn) explain(ctx context.Context, collection string, command bson.D, verbosity string) (*Plan, error) {
+	var output bson.Raw
+	err := c.db.RunCommand(ctx, bson.D{
+		{Key: "explain", Value: command},
+		{Key: "verbosity", Value: verbosity},
+	}).Decode(&output)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := bson.MarshalExtJSON(output, false, false)
+	if err != nil {
+		return nil, err
+	}
+	var explained map[string]interface{}
+	if err := json.Unmarshal(data, &explained); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Root:     mongoPlan(explained, collection),
+		Analyzed: verbosity != "queryPlanner",
+		Raw:      data,
+	}
+	if stats, ok := explained["executionStats"].(map[string]interface{}); ok {
+		plan.ExecutionTimeMs = planNumber(stats["executionTimeMillis"])
+	}
+	return plan, nil
+}
+
+// mongoPlan reads the plan tree of explain output: the executed stages when available,
+// otherwise the winning plan. Aggregation stages wrap the plan of their input.
+func mongoPlan(explained map[string]interface{}, collection string) *PlanNode {
+	var root *PlanNode
+	if stats, ok := explained["executionStats"].(map[string]interface{}); ok {
+		if stages, ok := stats["executionStages"].(map[string]interface{}); ok {
+			root = mongoStage(stages, collection)
+		}
+	}
+	if planner, ok := explained["queryPlanner"].(map[string]interface{}); ok && root == nil {
+		if winning, ok := planner["winningPlan"].(map[string]interface{}); ok {
+			// The slot based engine nests the classic plan
+			if classic, ok := winning["queryPlan"].(map[string]interface{}); ok {
+				winning = classic
+			}
+			root = mongoStage(winning, collection)
+		}
+	}
+
+	stages, _ := explained["stages"].([]interface{})
+	for _, item := range stages {
+		stage, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, spec := range stage {
+			if !strings.HasPrefix(name, "$") {
+				continue
+			}
+			var node *PlanNode
+			if cursor, ok := spec.(map[string]interface{}); ok && name == "$cursor" {
+				node = mongoPlan(cursor, collection)
+			}
+			if node == nil {
+				node = &PlanNode{Type: name, Details: map[string]interface{}{"spec": spec}}
+				if root != nil {
+					node.Children = []*PlanNode{root}
+				}
+			}
+			if rows := planNumber(stage["nReturned"]); rows != nil {
+				node.ActualRows = rows
+			}
+			if ms := planNumber(stage["executionTimeMillisEstimate"]); ms != nil {
+				node.ActualTimeMs = ms
+			}
+			root = node
+		}
+	}
+	return root
+}
+
+var mongoDetails = []string{
+	"filter", "keyPattern", "direction", "indexBounds", "sortPattern", "limitAmount", "skipAmount",
+	"docsExamined", "keysExamined", "works",
+}
+
+// mongoStage converts a stage of a plan and its input stages
+func mongoStage(stage map[string]interface{}, collection string) *PlanNode {
+	node := &PlanNode{
+		Type:         planString(stage["stage"]),
+		Index:        planString(stage["indexName"]),
+		ActualRows:   planNumber(stage["nReturned"]),
+		ActualTimeMs: planNumber(stage["executionTimeMillisEstimate"]),
+		Details:      planDetails(stage, mongoDetails),
+	}
+	if input, ok := stage["inputStage"].(map[string]interface{}); ok {
+		node.Children = append(node.Children, mongoStage(input, collection))
+	}
+	inputs, _ := stage["inputStages"].([]interface{})
+	for _, input := range inputs {
+		if input, ok := input.(map[string]interface{}); ok {
+			node.Children = append(node.Children, mongoStage(input, collection))
+		}
+	}
+	if len(node.Children) == 0 {
+		// Leaves read the collection
+		node.Relation = collection
+	}
+	return node
+}
+
+// readNative reads up to limit documents of a cursor as relaxed Extended JSON
+func readNative(ctx context.Context, cursor *mongo.Cursor, limit int, started time.Time) (*NativeResult, error) {
+	defer cursor.Close(ctx)
+
+	result := &NativeResult{Documents: make([]json.RawMessage, 0)}
+	for cursor.Next(ctx) {
+		if len(result.Documents) == limit {
+			result.Truncated = true
+			break
+		}
+		data, err := bson.MarshalExtJSON(cursor.Current, false, false)
+		if err != nil {
+			return nil, err
+		}
+		result.Documents = append(result.Documents, data)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	result.DurationMs = time.Since(started).Milliseconds()
+	return result, nil
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"db-manager-backend/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// outboxBatchSize bounds how many emails one round sends
+	outboxBatchSize = 50
+	// outboxLease is how long an email claimed by a worker is hidden from other workers
+	outboxLease = 5 * time.Minute
+	// outboxMaxBackoff caps the delay between two attempts of an email
+	outboxMaxBackoff = time.Hour
+)
+
+// Outbox stores emails before sending them and retries failed deliveries with
+// exponential backoff, so emails survive mail server outages and restarts
+type Outbox struct {
+	db          *gorm.DB
+	mailer      Mailer
+	interval    time.Duration
+	maxAttempts int
+	retention   time.Duration
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewOutbox creates an outbox retrying due emails every interval, giving up after
+// maxAttempts and keeping sent or failed emails for the retention period
+func NewOutbox(db *gorm.DB, mailer Mailer, interval time.Duration, maxAttempts int, retention time.Duration) *Outbox {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Outbox{
+		db:          db,
+		mailer:      mailer,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		retention:   retention,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Enqueue renders an email template and stores it for delivery. Pass the transaction
+// creating the record the email is about so that both are saved or neither is, and
+// call Notify once it is committed.
+func (o *Outbox) Enqueue(tx *gorm.DB, name, to string, data interface{}) error {
+	email, err := RenderEmail(name, to, data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OutboundEmail{
+		Template:      name,
+		Recipient:     email.To,
+		Subject:       email.Subject,
+		Body:          email.Body,
+		Status:        models.EmailStatusPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// Send enqueues an email outside of any transaction and wakes the worker
+func (o *Outbox) Send(name, to string, data interface{}) error {
+	if err := o.Enqueue(o.db, name, to, data); err != nil {
+		return err
+	}
+	o.Notify()
+	return nil
+}
+
+// Notify makes the worker send due emails now instead of at its next tick
+func (o *Outbox) Notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the worker in the background until Stop is called
+func (o *Outbox) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	o.done = make(chan struct{})
+
+	go func() {
+		defer close(o.done)
+
+		ticker := time.NewTicker(o.interval)
+		defer ticker.Stop()
+
+		for {
+			o.Flush(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-o.wake:
+			}
+		}
+	}()
+	log.Printf("Mail outbox started (retry interval %s, max attempts %d)", o.interval, o.maxAttempts)
+}
+
+// Stop ends the background loop and waits for the current round to finish
+func (o *Outbox) Stop() {
+	if o.cancel == nil {
+		return
+	}
+	o.cancel()
+	<-o.done
+}
+
+// Flush sends every due email once and prunes old ones
+func (o *Outbox) Flush(ctx context.Context) {
+	for ctx.Err() == nil {
+		var due []models.OutboundEmail
+		if err := o.db.Where("status = ? AND next_attempt_at <= ?", models.EmailStatusPending, time.Now()).
+			Order("next_attempt_at").Limit(outboxBatchSize).Find(&due).Error; err != nil {
+			log.Printf("Mail outbox: failed to list due emails: %v", err)
+			return
+		}
+		for i := range due {
+			if ctx.Err() != nil {
+				return
+			}
+			o.deliver(ctx, &due[i])
+		}
+		if len(due) < outboxBatchSize {
+			break
+		}
+	}
+
+	if o.retention > 0 {
+		cutoff := time.Now().Add(-o.retention)
+		if err := o.db.Where("status <> ? AND updated_at < ?", models.EmailStatusPending, cutoff).
+			Delete(&models.OutboundEmail{}).Error; err != nil {
+			log.Printf("Mail outbox: failed to prune emails: %v", err)
+		}
+	}
+}
+
+// deliver makes one attempt to send an email and records its outcome
+func (o *Outbox) deliver(ctx context.Context, email *models.OutboundEmail) {
+	// Claim the attempt first so that another instance sharing the metadata database
+	// does not send the same email
+	now := time.Now()
+	claimed := o.db.Model(&models.OutboundEmail{}).
+		Where("id = ? AND status = ? AND attempts = ?", email.ID, models.EmailStatusPending, email.Attempts).
+		UpdateColumns(map[string]interface{}{
+			"attempts":        email.Attempts + 1,
+			"next_attempt_at": now.Add(outboxLease),
+		})
+	if claimed.Error != nil {
+		log.Printf("Mail outbox: failed to claim email %s: %v", email.ID, claimed.Error)
+		return
+	}
+	if claimed.RowsAffected == 0 {
+		return
+	}
+	email.Attempts++
+
+	err := o.mailer.Send(ctx, Email{To: email.Recipient, Subject: email.Subject, Body: email.Body})
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	switch {
+	case err == nil:
+		updates["status"] = models.EmailStatusSent
+		updates["sent_at"] = time.Now()
+		updates["last_error"] = ""
+	case ctx.Err() != nil:
+		// Shutting down, retry the email at the next start without counting the attempt
+		updates["attempts"] = email.Attempts - 1
+		updates["next_attempt_at"] = now
+	case email.Attempts >= o.maxAttempts:
+		log.Printf("Mail outbox: giving up on %s email to %s after %d attempts: %v",
+			email.Template, email.Recipient, email.Attempts, err)
+		updates["status"] = models.EmailStatusFailed
+		updates["last_error"] = err.Error()
+	default:
+		updates["next_attempt_at"] = time.Now().Add(outboxBackoff(o.interval, email.Attempts))
+		updates["last_error"] = err.Error()
+	}
+
+	if err := o.db.Model(&models.OutboundEmail{}).Where("id = ?", email.ID).
+		UpdateColumns(updates).Error; err != nil {
+		log.Printf("Mail outbox: failed to record delivery of %s: %v", email.ID, err)
+	}
+}
+
+// outboxBackoff doubles the delay after each failed attempt, starting at the retry
+// interval
+func outboxBackoff(interval time.Duration, attempts int) time.Duration {
+	delay := interval
+	for i := 1; i < attempts && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxBackoff {
+		delay = outboxMaxBackoff
+	}
+	return delay
+}
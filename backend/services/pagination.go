@@ -0,0 +1,372 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNoCursor is returned when records of a collection cannot be paginated by cursor
+var ErrNoCursor = errors.New("cursor pagination is not available for this collection")
+
+// Ways of counting the total of a listing
+const (
+	TotalExact    = "exact"
+	TotalEstimate = "estimate" // from statistics, for unfiltered listings only
+	TotalNone     = "none"
+)
+
+// KeysetConn is implemented by sessions supporting cursor pagination. KeysetOrder
+// completes the sort order of opts with the columns identifying a record, so every
+// record has a distinct position.
+type KeysetConn interface {
+	KeysetOrder(ctx context.Context, collection string, opts FindOptions) ([]Sort, error)
+}
+
+// EstimateConn is implemented by sessions that can estimate the size of a collection
+// from statistics instead of counting it
+type EstimateConn interface {
+	Estimate(ctx context.Context, collection string) (int64, error)
+}
+
+// Page is one page of a cursor-paginated listing
+type Page struct {
+	Documents  []Document
+	NextCursor string // empty on the last page
+	PrevCursor string // empty on the first page
+}
+
+// cursorToken is the decoded form of an opaque cursor: the position of the first or
+// last record of a page in the sort order it was created for
+type cursorToken struct {
+	Order    string        `json:"o"`
+	Values   []cursorValue `json:"v"`
+	Backward bool          `json:"b,omitempty"` // the page ends before the position
+}
+
+// cursorValue keeps the type of a position value, so it compares like the column
+type cursorValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v"`
+}
+
+// FindPage lists documents following the position encoded in cursor, or from the
+// start when cursor is empty. opts.Offset is ignored and opts.Limit is the page size.
+// ErrNoCursor reports collections that cannot be paginated by cursor, ErrInvalidQuery
+// a cursor that does not belong to the sort order.
+func FindPage(ctx context.Context, conn Conn, collection string, opts FindOptions, cursor string) (*Page, error) {
+	keyset, ok := conn.(KeysetConn)
+	if !ok {
+		return nil, ErrNoCursor
+	}
+	order, err := keyset.KeysetOrder(ctx, collection, opts)
+	if errors.Is(err, ErrNoPrimaryKey) {
+		return nil, fmt.Errorf("%w: %v", ErrNoCursor, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signature := orderSignature(order)
+
+	var position *cursorToken
+	if cursor != "" {
+		if position, err = decodeCursor(cursor); err != nil {
+			return nil, err
+		}
+		if position.Order != signature || len(position.Values) != len(order) {
+			return nil, fmt.Errorf("%w: cursor belongs to a different sort order", ErrInvalidQuery)
+		}
+	}
+	backward := position != nil && position.Backward
+
+	// Columns needed for the next cursor are selected and removed again afterwards
+	var extra []string
+	if len(opts.Select) > 0 {
+		selected := make(map[string]bool, len(opts.Select))
+		for _, column := range opts.Select {
+			selected[column] = true
+		}
+		for _, sort := range order {
+			if !selected[sort.Column] {
+				extra = append(extra, sort.Column)
+			}
+		}
+		opts.Select = append(append([]string(nil), opts.Select...), extra...)
+	}
+
+	limit := opts.Limit
+	opts.Limit = limit + 1 // one more record tells whether another page follows
+	opts.Offset = 0
+	opts.Order = order
+	if backward {
+		opts.Order = make([]Sort, len(order))
+		for i, sort := range order {
+			opts.Order[i] = Sort{Column: sort.Column, Desc: !sort.Desc}
+		}
+	}
+	if position != nil {
+		values := make([]interface{}, len(position.Values))
+		for i, value := range position.Values {
+			if values[i], err = value.decode(); err != nil {
+				return nil, err
+			}
+		}
+		after := keysetGroup(opts.Order, values)
+		if opts.Where != nil {
+			after = FilterGroup{Groups: []FilterGroup{*opts.Where, after}}
+		}
+		opts.Where = &after
+	}
+
+	documents, err := conn.Find(ctx, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+	more := len(documents) > limit
+	if more {
+		documents = documents[:limit]
+	}
+	if backward {
+		for i, j := 0, len(documents)-1; i < j; i, j = i+1, j-1 {
+			documents[i], documents[j] = documents[j], documents[i]
+		}
+	}
+
+	page := &Page{Documents: documents}
+	if len(documents) > 0 {
+		if (!backward && more) || (backward && position != nil) {
+			if page.NextCursor, err = encodeCursor(signature, order, documents[len(documents)-1], false); err != nil {
+				return nil, err
+			}
+		}
+		if (backward && more) || (!backward && position != nil) {
+			if page.PrevCursor, err = encodeCursor(signature, order, documents[0], true); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, doc := range documents {
+		for _, column := range extra {
+			delete(doc, column)
+		}
+	}
+	return page, nil
+}
+
+// CountTotal counts the documents of a listing as requested by mode. Estimates cover
+// unfiltered listings only, filtered ones have no estimated total, and drivers without
+// statistics count exactly instead. The total is nil when none is available.
+func CountTotal(ctx context.Context, conn Conn, collection string, opts FindOptions, mode string) (*int64, bool, error) {
+	switch mode {
+	case "", TotalExact:
+	case TotalNone:
+		return nil, false, nil
+	case TotalEstimate:
+		if opts.Search != "" || len(opts.Filters) > 0 || opts.Where != nil {
+			return nil, false, nil
+		}
+		if estimator, ok := conn.(EstimateConn); ok {
+			total, err := estimator.Estimate(ctx, collection)
+			if err == nil {
+				return &total, true, nil
+			}
+			if !errors.Is(err, ErrUnsupported) {
+				return nil, false, err
+			}
+		}
+	default:
+		return nil, false, fmt.Errorf("%w: total must be %s, %s or %s", ErrInvalidQuery, TotalExact, TotalEstimate, TotalNone)
+	}
+
+	total, err := conn.Count(ctx, collection, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	return &total, false, nil
+}
+
+// keysetOrder appends the key columns missing from a sort order, ascending
+func keysetOrder(order []Sort, key []string) []Sort {
+	completed := make([]Sort, 0, len(order)+len(key))
+	sorted := make(map[string]bool, len(order))
+	for _, sort := range order {
+		if !sorted[sort.Column] {
+			completed = append(completed, sort)
+			sorted[sort.Column] = true
+		}
+	}
+	for _, column := range key {
+		if !sorted[column] {
+			completed = append(completed, Sort{Column: column})
+		}
+	}
+	return completed
+}
+
+// keysetGroup matches the records positioned after values in the given order:
+// (a > v1) OR (a = v1 AND b > v2) OR ..., with < for descending columns
+func keysetGroup(order []Sort, values []interface{}) FilterGroup {
+	group := FilterGroup{Or: true}
+	for i, sort := range order {
+		branch := FilterGroup{}
+		for j := 0; j < i; j++ {
+			branch.Filters = append(branch.Filters, Filter{Column: order[j].Column, Operator: OpEq, Value: values[j]})
+		}
+		operator := OpGt
+		if sort.Desc {
+			operator = OpLt
+		}
+		branch.Filters = append(branch.Filters, Filter{Column: sort.Column, Operator: operator, Value: values[i]})
+		group.Groups = append(group.Groups, branch)
+	}
+	return group
+}
+
+// orderSignature identifies a sort order, so cursors are not reused with another one
+func orderSignature(order []Sort) string {
+	terms := make([]string, len(order))
+	for i, sort := range order {
+		terms[i] = sort.Column + ".asc"
+		if sort.Desc {
+			terms[i] = sort.Column + ".desc"
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+// encodeCursor builds the opaque cursor of a record
+func encodeCursor(signature string, order []Sort, doc Document, backward bool) (string, error) {
+	token := cursorToken{Order: signature, Backward: backward}
+	for _, sort := range order {
+		value := documentValue(doc, sort.Column)
+		if value == nil {
+			// NULLs sort differently on every engine, positions must be comparable values
+			return "", fmt.Errorf("%w: sort column %s has empty values", ErrNoCursor, sort.Column)
+		}
+		encoded, err := newCursorValue(value)
+		if err != nil {
+			return "", err
+		}
+		token.Values = append(token.Values, encoded)
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string) (*cursorToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return &token, nil
+}
+
+// documentValue reads a column, or a dotted path into embedded documents
+func documentValue(doc Document, column string) interface{} {
+	if value, ok := doc[column]; ok {
+		return value
+	}
+	var current interface{} = map[string]interface{}(doc)
+	for _, part := range strings.Split(column, ".") {
+		switch m := current.(type) {
+		case map[string]interface{}:
+			current = m[part]
+		case primitive.M:
+			current = m[part]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// newCursorValue encodes a position value with its type. Times keep nanosecond
+// precision, other BSON values use canonical extended JSON.
+func newCursorValue(value interface{}) (cursorValue, error) {
+	switch v := value.(type) {
+	case string:
+		return cursorValue{Type: "s", Value: v}, nil
+	case bool:
+		return cursorValue{Type: "b", Value: strconv.FormatBool(v)}, nil
+	case int:
+		return cursorValue{Type: "i", Value: strconv.Itoa(v)}, nil
+	case int32:
+		return cursorValue{Type: "i", Value: strconv.FormatInt(int64(v), 10)}, nil
+	case int64:
+		return cursorValue{Type: "i", Value: strconv.FormatInt(v, 10)}, nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return cursorValue{Type: "s", Value: strconv.FormatUint(v, 10)}, nil
+		}
+		return cursorValue{Type: "i", Value: strconv.FormatUint(v, 10)}, nil
+	case float32:
+		return cursorValue{Type: "f", Value: strconv.FormatFloat(float64(v), 'g', -1, 32)}, nil
+	case float64:
+		return cursorValue{Type: "f", Value: strconv.FormatFloat(v, 'g', -1, 64)}, nil
+	case time.Time:
+		return cursorValue{Type: "t", Value: v.Format(time.RFC3339Nano)}, nil
+	case []byte:
+		return cursorValue{Type: "s", Value: string(v)}, nil
+	}
+
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, true, false)
+	if err != nil {
+		return cursorValue{}, fmt.Errorf("%w: cannot paginate by a value of type %T", ErrNoCursor, value)
+	}
+	return cursorValue{Type: "x", Value: string(data)}, nil
+}
+
+func (v cursorValue) decode() (interface{}, error) {
+	var value interface{}
+	var err error
+	switch v.Type {
+	case "s":
+		value = exactString(v.Value)
+	case "b":
+		value, err = strconv.ParseBool(v.Value)
+	case "i":
+		value, err = strconv.ParseInt(v.Value, 10, 64)
+	case "f":
+		value, err = strconv.ParseFloat(v.Value, 64)
+	case "t":
+		value, err = time.Parse(time.RFC3339Nano, v.Value)
+	case "x":
+		var doc bson.D
+		if err = bson.UnmarshalExtJSON([]byte(v.Value), true, &doc); err == nil && len(doc) == 1 {
+			value = doc[0].Value
+		}
+	default:
+		err = fmt.Errorf("unknown type %q", v.Type)
+	}
+	if err != nil || value == nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return value, nil
+}
+
+// exactString is a string position value. Unlike query string values it is never
+// coerced to a number, date or ObjectID when matched against documents.
+type exactString string
+
+// Value passes the string to SQL drivers
+func (s exactString) Value() (driver.Value, error) {
+	return string(s), nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-manager-backend/models"
+)
+
+// ParameterValue converts a value given for a saved query parameter to its declared
+// type. Strings are parsed, so query string values can be used as they are.
+func ParameterValue(parameter models.QueryParameter, value interface{}) (interface{}, error) {
+	switch parameter.Type {
+	case models.ParameterTypeString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case models.ParameterTypeInteger:
+		switch v := value.(type) {
+		case string:
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return n, nil
+			}
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) <= 1<<53 {
+				return int64(v), nil
+			}
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		}
+	case models.ParameterTypeNumber:
+		switch v := value.(type) {
+		case string:
+			if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+				return n, nil
+			}
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+	case models.ParameterTypeBoolean:
+		switch v := value.(type) {
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, nil
+			}
+		case bool:
+			return v, nil
+		}
+	case models.ParameterTypeDate:
+		if s, ok := value.(string); ok {
+			s = strings.TrimSpace(s)
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return t, nil
+			}
+			if t, err := time.Parse("2006-01-02", s); err == nil {
+				return t, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: parameter %s has unknown type %q", ErrInvalidQuery, parameter.Name, parameter.Type)
+	}
+	return nil, fmt.Errorf("%w: parameter %s must be of type %s", ErrInvalidQuery, parameter.Name, parameter.Type)
+}
+
+// BindParameters checks the values of a request against the declared parameters of a
+// saved query. Every declared parameter is bound: missing optional ones take their
+// default, or null. Values for undeclared parameters are refused.
+func BindParameters(declared []models.QueryParameter, values map[string]interface{}) (map[string]interface{}, error) {
+	bound := make(map[string]interface{}, len(declared))
+	for _, parameter := range declared {
+		value, ok := values[parameter.Name]
+		if !ok || value == nil {
+			if parameter.Required {
+				return nil, fmt.Errorf("%w: parameter %s is required", ErrInvalidQuery, parameter.Name)
+			}
+			value = parameter.Default
+		}
+		if value == nil {
+			bound[parameter.Name] = nil
+			continue
+		}
+
+		converted, err := ParameterValue(parameter, value)
+		if err != nil {
+			return nil, err
+		}
+		bound[parameter.Name] = converted
+	}
+
+	for name := range values {
+		if _, ok := bound[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown parameter %s", ErrInvalidQuery, name)
+		}
+	}
+	return bound, nil
+}
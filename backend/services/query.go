@@ -0,0 +1,487 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Limits of ad-hoc statements run from the query console
+const (
+	DefaultQueryTimeout = 30 * time.Second
+	MaxQueryTimeout     = 5 * time.Minute
+	DefaultQueryRows    = 1000
+	MaxQueryRows        = 10000
+	maxQueryStatements  = 20
+)
+
+// QueryOptions controls the execution of an ad-hoc statement
+type QueryOptions struct {
+	Timeout  time.Duration
+	MaxRows  int  // rows kept per result set
+	ReadOnly bool // run in a read-only transaction and refuse statements escaping it
+	// Values bound to :name parameters. When nil, statements run as written.
+	Params map[string]interface{}
+}
+
+// QueryColumn describes a column of a result set
+type QueryColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable *bool  `json:"nullable,omitempty"`
+}
+
+// ResultSet is the outcome of one statement
+type ResultSet struct {
+	Statement    string          `json:"statement"`
+	Columns      []QueryColumn   `json:"columns"`
+	Rows         [][]interface{} `json:"rows"`
+	Truncated    bool            `json:"truncated"`               // more rows than MaxRows were available
+	RowsAffected *int64          `json:"rows_affected,omitempty"` // statements not returning rows
+	DurationMs   int64           `json:"duration_ms"`
+}
+
+// QueryResult holds one result set per statement
+type QueryResult struct {
+	ResultSets []ResultSet `json:"result_sets"`
+	ReadOnly   bool        `json:"read_only"`
+	DurationMs int64       `json:"duration_ms"`
+}
+
+// StatementError reports the statement of a script that failed. Statements run in one
+// transaction, so nothing the script changed is kept.
+type StatementError struct {
+	Index int // 0-based
+	Err   error
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement %d: %v", e.Index+1, e.Err)
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// QueryConn is implemented by sessions that run ad-hoc statements
+type QueryConn interface {
+	Query(ctx context.Context, script string, opts QueryOptions) (*QueryResult, error)
+	Explain(ctx context.Context, statement string, opts ExplainOptions) (*Plan, error)
+}
+
+// statementSyntax describes the lexical rules needed to split a script into statements
+type statementSyntax struct {
+	hashComments     bool // # starts a comment
+	backslashEscapes bool // \ escapes quotes inside strings
+	dollarQuotes     bool // $tag$ ... $tag$ strings
+}
+
+// statement is one statement of a script with the words outside strings and
+// comments, upper-cased
+type statement struct {
+	text   string
+	words  []string
+	params []namedParam
+}
+
+// namedParam is a :name parameter at text[start:end] of its statement
+type namedParam struct {
+	name       string
+	start, end int
+}
+
+func (s statement) keyword() string {
+	if len(s.words) == 0 {
+		return ""
+	}
+	return s.words[0]
+}
+
+func (s statement) has(word string) bool {
+	for _, w := range s.words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// splitStatements splits a script at semicolons outside strings, quoted identifiers
+// and comments. Empty statements are dropped.
+func splitStatements(script string, syntax statementSyntax) []statement {
+	var statements []statement
+	var current statement
+	var word strings.Builder
+	start := 0
+
+	endWord := func() {
+		if word.Len() > 0 {
+			current.words = append(current.words, strings.ToUpper(word.String()))
+			word.Reset()
+		}
+	}
+	finish := func(end int) {
+		endWord()
+		raw := script[start:end]
+		current.text = strings.TrimSpace(raw)
+		lead := start + len(raw) - len(strings.TrimLeftFunc(raw, unicode.IsSpace))
+		for i := range current.params {
+			current.params[i].start -= lead
+			current.params[i].end -= lead
+		}
+		if current.text != "" && len(current.words) > 0 {
+			statements = append(statements, current)
+		}
+		current = statement{}
+		start = end + 1
+	}
+
+	runes := []rune(script)
+	offsets := make([]int, len(runes)+1)
+	for i, offset := 0, 0; i < len(runes); i++ {
+		offsets[i] = offset
+		offset += len(string(runes[i]))
+		offsets[i+1] = offset
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-', r == '#' && syntax.hashComments:
+			endWord()
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			endWord()
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				i++
+			}
+			i++
+		case r == '\'' || r == '"' || r == '`':
+			endWord()
+			i++
+			for i < len(runes) {
+				if syntax.backslashEscapes && runes[i] == '\\' {
+					i += 2
+					continue
+				}
+				if runes[i] == r {
+					// A doubled quote is an escaped quote
+					if i+1 < len(runes) && runes[i+1] == r {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+		case r == '$' && syntax.dollarQuotes && word.Len() == 0:
+			// $tag$ or $$ opens a string ending at the same tag
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			if end >= len(runes) || runes[end] != '$' {
+				word.WriteRune(r)
+				continue
+			}
+			tag := string(runes[i : end+1])
+			rest := string(runes[end+1:])
+			closing := strings.Index(rest, tag)
+			if closing < 0 {
+				i = len(runes)
+				continue
+			}
+			i = end + len([]rune(rest[:closing+len(tag)]))
+		case r == ':' && i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || runes[i+1] == '_') &&
+			(i == 0 || runes[i-1] != ':'):
+			// :name parameter, :: casts are left alone
+			endWord()
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			current.params = append(current.params, namedParam{
+				name:  string(runes[i+1 : end]),
+				start: offsets[i],
+				end:   offsets[end],
+			})
+			i = end - 1
+		case r == ';':
+			finish(offsets[i])
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$':
+			word.WriteRune(r)
+		default:
+			endWord()
+		}
+	}
+	finish(len(script))
+	return statements
+}
+
+// transactionStatements would end or change the transaction the script runs in
+var transactionStatements = map[string]bool{
+	"BEGIN": true, "START": true, "COMMIT": true, "ROLLBACK": true, "END": true,
+	"ABORT": true, "SAVEPOINT": true, "RELEASE": true,
+}
+
+// readOnlyStatements are the only statements allowed with read-only access. The
+// read-only transaction does not cover statements that commit implicitly or act
+// outside of it, such as LOCK TABLES, ANALYZE TABLE or FLUSH in MySQL, COPY in
+// PostgreSQL or ATTACH in SQLite, so every other statement is refused.
+var readOnlyStatements = map[string]bool{
+	"SELECT": true, "WITH": true, "SHOW": true, "EXPLAIN": true, "DESCRIBE": true,
+	"DESC": true, "VALUES": true, "TABLE": true,
+}
+
+// rowStatements return rows; other statements report the number of affected rows
+var rowStatements = map[string]bool{
+	"SELECT": true, "WITH": true, "SHOW": true, "EXPLAIN": true, "DESCRIBE": true,
+	"DESC": true, "VALUES": true, "PRAGMA": true, "TABLE": true,
+}
+
+// checkStatement refuses statements the console cannot run safely
+func checkStatement(stmt statement, readOnly bool) error {
+	keyword := stmt.keyword()
+	if transactionStatements[keyword] {
+		return fmt.Errorf("%w: %s is not allowed, all statements run in one transaction", ErrInvalidQuery, keyword)
+	}
+	if !readOnly {
+		return nil
+	}
+	if !readOnlyStatements[keyword] {
+		return fmt.Errorf("%w: only SELECT, WITH, SHOW, EXPLAIN, DESCRIBE, VALUES and TABLE statements are allowed with read-only access, not %s", ErrInvalidQuery, keyword)
+	}
+	if stmt.has("OUTFILE") || stmt.has("DUMPFILE") {
+		return fmt.Errorf("%w: writing files is not allowed with read-only access", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// Query runs the statements of a script in one transaction on a dedicated connection,
+// committing unless the script is read-only or a statement fails. The connection is
+// discarded afterwards, so session settings changed by the script do not leak into
+// the pool.
+func (c *sqlConn) Query(ctx context.Context, script string, opts QueryOptions) (*QueryResult, error) {
+	statements := splitStatements(script, c.dialect.syntax)
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("%w: no statement to run", ErrInvalidQuery)
+	}
+	if len(statements) > maxQueryStatements {
+		return nil, fmt.Errorf("%w: at most %d statements can run at once", ErrInvalidQuery, maxQueryStatements)
+	}
+	for i, stmt := range statements {
+		if err := checkStatement(stmt, opts.ReadOnly); err != nil {
+			return nil, &StatementError{Index: i, Err: err}
+		}
+	}
+	if opts.Timeout <= 0 || opts.Timeout > MaxQueryTimeout {
+		opts.Timeout = DefaultQueryTimeout
+	}
+	if opts.MaxRows <= 0 || opts.MaxRows > MaxQueryRows {
+		opts.MaxRows = DefaultQueryRows
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	started := time.Now()
+
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		conn.Close()
+	}()
+
+	if opts.ReadOnly && c.dialect.readOnlySession != "" {
+		if _, err := conn.ExecContext(ctx, c.dialect.readOnlySession); err != nil {
+			return nil, err
+		}
+	}
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if opts.ReadOnly {
+		// Once a statement ran, the server refuses to switch the transaction to read-write
+		if _, err := tx.ExecContext(ctx, "SELECT 1"); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &QueryResult{ReadOnly: opts.ReadOnly}
+	for i, stmt := range statements {
+		query, args := stmt.text, []interface{}(nil)
+		if opts.Params != nil {
+			if query, args, err = c.bind(stmt, opts.Params); err != nil {
+				return nil, &StatementError{Index: i, Err: err}
+			}
+		}
+		set, err := runStatement(ctx, tx, stmt, query, args, opts.MaxRows)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return nil, &StatementError{Index: i, Err: err}
+		}
+		result.ResultSets = append(result.ResultSets, *set)
+	}
+
+	if !opts.ReadOnly {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	result.DurationMs = time.Since(started).Milliseconds()
+	return result, nil
+}
+
+// bind replaces the :name parameters of a statement with placeholders of the dialect
+func (c *sqlConn) bind(stmt statement, params map[string]interface{}) (string, []interface{}, error) {
+	if len(stmt.params) == 0 {
+		return stmt.text, nil, nil
+	}
+
+	var query strings.Builder
+	args := make([]interface{}, 0, len(stmt.params))
+	last := 0
+	for _, param := range stmt.params {
+		value, ok := params[param.name]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: unknown parameter :%s", ErrInvalidQuery, param.name)
+		}
+		args = append(args, value)
+		query.WriteString(stmt.text[last:param.start])
+		query.WriteString(c.dialect.placeholder(len(args)))
+		last = param.end
+	}
+	query.WriteString(stmt.text[last:])
+	return query.String(), args, nil
+}
+
+// runStatement executes one statement as query with args, reading at most maxRows rows
+func runStatement(ctx context.Context, tx *sql.Tx, stmt statement, query string, args []interface{}, maxRows int) (*ResultSet, error) {
+	started := time.Now()
+	set := &ResultSet{Statement: stmt.text, Columns: []QueryColumn{}, Rows: [][]interface{}{}}
+
+	if !rowStatements[stmt.keyword()] && !stmt.has("RETURNING") {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		if affected, err := res.RowsAffected(); err == nil {
+			set.RowsAffected = &affected
+		}
+		set.DurationMs = time.Since(started).Milliseconds()
+		return set, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	for _, columnType := range types {
+		column := QueryColumn{Name: columnType.Name(), Type: columnType.DatabaseTypeName()}
+		if nullable, ok := columnType.Nullable(); ok {
+			column.Nullable = &nullable
+		}
+		set.Columns = append(set.Columns, column)
+	}
+
+	values := make([]interface{}, len(types))
+	scanArgs := make([]interface{}, len(types))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	for rows.Next() {
+		if len(set.Rows) == maxRows {
+			set.Truncated = true
+			break
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, len(values))
+		for i, value := range values {
+			// Convert byte arrays to strings for proper JSON serialization
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			row[i] = value
+		}
+		set.Rows = append(set.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	set.DurationMs = time.Since(started).Milliseconds()
+	return set, nil
+}
+
+// ErrQueryRunning is returned when a query ID is already in use
+var ErrQueryRunning = errors.New("a query with this ID is already running")
+
+// QueryTracker lets running console queries be cancelled from another request
+type QueryTracker struct {
+	mu      sync.Mutex
+	running map[string]trackedQuery
+}
+
+type trackedQuery struct {
+	owner  string
+	cancel context.CancelFunc
+}
+
+// NewQueryTracker creates an empty tracker
+func NewQueryTracker() *QueryTracker {
+	return &QueryTracker{running: make(map[string]trackedQuery)}
+}
+
+// Start registers a query of owner under id. The returned context is cancelled by
+// Cancel; done must be called when the query finished.
+func (t *QueryTracker) Start(ctx context.Context, id, owner string) (context.Context, func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.running[id]; ok {
+		return nil, nil, ErrQueryRunning
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	t.running[id] = trackedQuery{owner: owner, cancel: cancel}
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.running, id)
+		t.mu.Unlock()
+		cancel()
+	}, nil
+}
+
+// Cancel stops a running query of owner, reporting whether one was found
+func (t *QueryTracker) Cancel(id, owner string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	query, ok := t.running[id]
+	if !ok || query.owner != owner {
+		return false
+	}
+	query.cancel()
+	return true
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadOnlyStatements(t *testing.T) {
+	mysql := mysqlDialect.syntax
+	for _, tc := range []struct {
+		script  string
+		allowed bool
+	}{
+		{"SELECT * FROM users", true},
+		{"  -- comment\n(SELECT 1) UNION (SELECT 2)", true},
+		{"WITH recent AS (SELECT * FROM orders) SELECT * FROM recent", true},
+		{"SHOW TABLES", true},
+		{"EXPLAIN SELECT 1", true},
+		{"DESCRIBE users", true},
+		{"DESC users", true},
+		{"VALUES (1), (2)", true},
+		{"TABLE users", true},
+
+		// MySQL statements committing implicitly, which a read-only transaction misses
+		{"LOCK TABLES users WRITE", false},
+		{"ANALYZE TABLE users", false},
+		{"OPTIMIZE TABLE users", false},
+		{"FLUSH PRIVILEGES", false},
+		{"CREATE TABLE copy AS SELECT * FROM users", false},
+		{"GRANT ALL ON *.* TO 'x'", false},
+		{"SET GLOBAL read_only = 0", false},
+		{"LOAD DATA INFILE '/etc/passwd' INTO TABLE users", false},
+		{"CALL cleanup()", false},
+		{"HANDLER users OPEN", false},
+		{"DO SLEEP(1)", false},
+		{"# comment\nINSERT INTO users VALUES (1)", false},
+		{"/* SELECT */ DELETE FROM users", false},
+		{"SELECT * FROM users INTO OUTFILE '/tmp/users'", false},
+		{"SELECT 'x' INTO DUMPFILE '/tmp/x'", false},
+
+		// Statements of the other engines
+		{"COPY users TO '/tmp/users'", false},
+		{"ATTACH DATABASE '/tmp/x.db' AS x", false},
+		{"VACUUM INTO '/tmp/x.db'", false},
+		{"PRAGMA query_only = OFF", false},
+	} {
+		statements := splitStatements(tc.script, mysql)
+		if len(statements) != 1 {
+			t.Fatalf("%q split into %d statements", tc.script, len(statements))
+		}
+		err := checkStatement(statements[0], true)
+		if tc.allowed && err != nil {
+			t.Errorf("%q was refused: %v", tc.script, err)
+		}
+		if !tc.allowed && !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%q was allowed with read-only access", tc.script)
+		}
+		if err := checkStatement(statements[0], false); tc.allowed && err != nil {
+			t.Errorf("%q was refused with write access: %v", tc.script, err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// respError is an error reply sent by a RESP server
+type respError string
+
+func (e respError) Error() string {
+	return string(e)
+}
+
+// respClient is a minimal RESP2 client speaking over a single TCP connection
+type respClient struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+func dialRESP(ctx context.Context, address string) (*respClient, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &respClient{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}, nil
+}
+
+// Do sends a command and reads its reply. Replies are decoded as string
+// (simple and bulk strings), int64, nil or []interface{}.
+func (c *respClient) Do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.setDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := c.writeCommand(args); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// Transaction runs the commands atomically inside MULTI/EXEC and returns the EXEC reply
+func (c *respClient) Transaction(ctx context.Context, commands ...[]string) ([]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.setDeadline(ctx); err != nil {
+		return nil, err
+	}
+
+	batch := append([][]string{{"MULTI"}}, commands...)
+	batch = append(batch, []string{"EXEC"})
+	for _, args := range batch {
+		if err := c.writeCommand(args); err != nil {
+			return nil, err
+		}
+	}
+
+	// MULTI and every queued command answer +OK / +QUEUED or an error
+	var queueErr error
+	for range batch[:len(batch)-1] {
+		if _, err := c.readReply(); err != nil && queueErr == nil {
+			queueErr = err
+		}
+	}
+
+	reply, err := c.readReply()
+	if queueErr != nil {
+		return nil, queueErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	results, ok := reply.([]interface{})
+	if !ok {
+		return nil, errors.New("resp: transaction aborted")
+	}
+	for _, result := range results {
+		if replyErr, isErr := result.(respError); isErr {
+			return results, replyErr
+		}
+	}
+	return results, nil
+}
+
+// setDeadline applies the context deadline, defaulting to 10 seconds
+func (c *respClient) setDeadline(ctx context.Context) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	return c.conn.SetDeadline(deadline)
+}
+
+func (c *respClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *respClient) writeCommand(args []string) error {
+	fmt.Fprintf(c.writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return c.writer.Flush()
+}
+
+func (c *respClient) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("resp: malformed line")
+	}
+	return line[:len(line)-2], nil
+}
+
+func (c *respClient) readReply() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("resp: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, respError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("resp: invalid bulk length: %v", err)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("resp: invalid array length: %v", err)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := c.readReply()
+			if err != nil {
+				// Error replies nested in arrays (e.g. EXEC) are returned in place
+				var replyErr respError
+				if !errors.As(err, &replyErr) {
+					return nil, err
+				}
+				item = replyErr
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("resp: unexpected reply type %q", line[0])
+	}
+}
+
+// respString converts a reply to a string
+func respString(reply interface{}, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch v := reply.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case nil:
+		return "", ErrNotFound
+	default:
+		return "", fmt.Errorf("resp: unexpected reply %T", reply)
+	}
+}
+
+// respInt converts a reply to an integer
+func respInt(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	default:
+		return 0, fmt.Errorf("resp: unexpected reply %T", reply)
+	}
+}
+
+// respStrings converts an array reply to a string slice
+func respStrings(reply interface{}, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		if reply == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("resp: unexpected reply %T", reply)
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		value, err := respString(item, nil)
+		if err != nil && err != ErrNotFound {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
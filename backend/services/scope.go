@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrOutOfScope is returned when a written record would not match the scope it must
+// stay in
+var ErrOutOfScope = errors.New("record is outside the rows you can access")
+
+// scopeVariable matches ${name} references in the string values of row filters
+var scopeVariable = regexp.MustCompile(`\$\{([A-Za-z0-9_.]+)\}`)
+
+// ParseRowFilter parses a JSON filter tree restricting rows, replacing ${name}
+// references in its string values by the given variables
+func ParseRowFilter(data []byte, variables map[string]string) (*FilterGroup, error) {
+	group, err := ParseFilterJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := group.expand(variables); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// expand substitutes variables in the string operands of the group
+func (g *FilterGroup) expand(variables map[string]string) error {
+	for i := range g.Filters {
+		filter := &g.Filters[i]
+		value, err := expandValue(filter.Value, variables)
+		if err != nil {
+			return err
+		}
+		filter.Value = value
+		for j, item := range filter.Values {
+			if filter.Values[j], err = expandValue(item, variables); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range g.Groups {
+		if err := g.Groups[i].expand(variables); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expandValue(value interface{}, variables map[string]string) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	var unknown string
+	expanded := scopeVariable.ReplaceAllStringFunc(text, func(reference string) string {
+		name := scopeVariable.FindStringSubmatch(reference)[1]
+		replacement, ok := variables[name]
+		if !ok && unknown == "" {
+			unknown = name
+		}
+		return replacement
+	})
+	if unknown != "" {
+		return nil, fmt.Errorf("%w: unknown variable ${%s} in row filter", ErrInvalidQuery, unknown)
+	}
+	return expanded, nil
+}
+
+// AndFilters combines filter groups with AND, skipping nil ones
+func AndFilters(groups ...*FilterGroup) *FilterGroup {
+	var combined []FilterGroup
+	for _, group := range groups {
+		if group != nil {
+			combined = append(combined, *group)
+		}
+	}
+	switch len(combined) {
+	case 0:
+		return nil
+	case 1:
+		return &combined[0]
+	default:
+		return &FilterGroup{Groups: combined}
+	}
+}
+
+// Matches evaluates the group against a document the way a database would: a
+// comparison with a missing or null field is never true
+func (g FilterGroup) Matches(doc Document) bool {
+	for _, filter := range g.Filters {
+		if filter.matches(doc) == g.Or {
+			return g.Or
+		}
+	}
+	for _, group := range g.Groups {
+		if group.Matches(doc) == g.Or {
+			return g.Or
+		}
+	}
+	// Empty groups match everything
+	return !g.Or || len(g.Filters)+len(g.Groups) == 0
+}
+
+func (f Filter) matches(doc Document) bool {
+	value := documentField(doc, f.Column)
+	if f.Operator == OpIs {
+		return f.matchesIs(value) != f.Negate
+	}
+	if value == nil {
+		return false
+	}
+
+	var matched bool
+	switch f.Operator {
+	case OpEq:
+		matched = compareValues(value, f.Value) == 0
+	case OpNeq:
+		matched = compareValues(value, f.Value) != 0
+	case OpGt:
+		matched = compareValues(value, f.Value) > 0
+	case OpGte:
+		matched = compareValues(value, f.Value) >= 0
+	case OpLt:
+		matched = compareValues(value, f.Value) < 0
+	case OpLte:
+		matched = compareValues(value, f.Value) <= 0
+	case OpLike, OpIlike:
+		pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(f.text()), `\*`, ".*") + "$"
+		if f.Operator == OpIlike {
+			pattern = "(?i)" + pattern
+		}
+		matched = regexp.MustCompile(pattern).MatchString(valueText(value))
+	case OpIn:
+		for _, item := range f.Values {
+			if compareValues(value, item) == 0 {
+				matched = true
+				break
+			}
+		}
+	}
+	return matched != f.Negate
+}
+
+func (f Filter) matchesIs(value interface{}) bool {
+	switch f.text() {
+	case "null":
+		return value == nil
+	case "true":
+		return valueText(value) == "true" || valueText(value) == "1"
+	default:
+		return valueText(value) == "false" || valueText(value) == "0"
+	}
+}
+
+// documentField returns the value of a field, following dotted paths into nested
+// documents
+func documentField(doc Document, field string) interface{} {
+	if value, ok := doc[field]; ok {
+		return value
+	}
+	var current interface{} = map[string]interface{}(doc)
+	for _, part := range strings.Split(field, ".") {
+		nested, ok := current.(map[string]interface{})
+		if !ok {
+			if document, isDocument := current.(Document); isDocument {
+				nested = document
+			} else {
+				return nil
+			}
+		}
+		current = nested[part]
+	}
+	return current
+}
+
+// compareValues orders two values numerically when both are numbers, or numeric
+// strings compared with a number, and as text otherwise
+func compareValues(a, b interface{}) int {
+	x, xNumber := valueNumber(a)
+	y, yNumber := valueNumber(b)
+	if xNumber && yNumber {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(valueText(a), valueText(b))
+}
+
+func valueNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func valueText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ScopedConn is implemented by sessions that check written records against a scope
+// themselves, with the semantics the scope has when reading
+type ScopedConn interface {
+	InsertScoped(ctx context.Context, collection string, doc Document, scope *FilterGroup) (interface{}, error)
+	UpdateScoped(ctx context.Context, collection string, key RecordKey, doc Document) (int64, error)
+}
+
+// InsertScoped inserts a document that must match the scope, if any. Sessions other
+// than ScopedConn ones are checked with FilterGroup.Matches before writing, whose
+// comparisons are case-sensitive and convert numeric strings to numbers, so they can
+// differ from the database's.
+func InsertScoped(ctx context.Context, conn Conn, collection string, doc Document, scope *FilterGroup) (interface{}, error) {
+	if scope == nil {
+		return conn.Insert(ctx, collection, doc)
+	}
+	if scoped, ok := conn.(ScopedConn); ok {
+		return scoped.InsertScoped(ctx, collection, doc, scope)
+	}
+	if !scope.Matches(doc) {
+		return nil, ErrOutOfScope
+	}
+	return conn.Insert(ctx, collection, doc)
+}
+
+// UpdateScoped updates a record limited to the Scope of its key, failing when the
+// changed record would no longer match it. Sessions other than ScopedConn ones are
+// checked as in InsertScoped.
+func UpdateScoped(ctx context.Context, conn Conn, collection string, key RecordKey, doc Document) (int64, error) {
+	if key.Scope == nil {
+		return conn.Update(ctx, collection, key, doc)
+	}
+	if scoped, ok := conn.(ScopedConn); ok {
+		return scoped.UpdateScoped(ctx, collection, key, doc)
+	}
+
+	current, err := conn.Get(ctx, collection, key)
+	if err != nil {
+		return 0, err
+	}
+	updated := make(Document, len(current)+len(doc))
+	for field, value := range current {
+		updated[field] = value
+	}
+	for field, value := range doc {
+		updated[field] = value
+	}
+	if !key.Scope.Matches(updated) {
+		return 0, ErrOutOfScope
+	}
+	return conn.Update(ctx, collection, key, doc)
+}
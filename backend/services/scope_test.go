@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"db-manager-backend/models"
+)
+
+// openScopeDatabase opens a SQLite database whose region column ignores case and whose
+// code column keeps numeric strings as text
+func openScopeDatabase(t *testing.T) Conn {
+	t.Helper()
+	dir := t.TempDir()
+	SetSQLiteDataDir(dir)
+	t.Cleanup(func() { SetSQLiteDataDir("data") })
+
+	setup, err := sql.Open("sqlite", filepath.Join(dir, "scope.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer setup.Close()
+	if _, err := setup.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, region TEXT COLLATE NOCASE, code TEXT);
+		INSERT INTO orders VALUES (1, 'eu', '7'), (2, 'us', '7')`); err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err := GetDriver("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := driver.Open(context.Background(), &models.DatabaseConnection{Type: "sqlite", Database: "scope.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func scope(t *testing.T, filter string) *FilterGroup {
+	t.Helper()
+	group, err := ParseRowFilter([]byte(filter), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return group
+}
+
+// TestScopedWritesFollowTheDatabase checks that written records are accepted exactly
+// when the database returns them under the scope. FilterGroup.Matches compares case
+// sensitively and converts numeric strings, which the columns below do not.
+func TestScopedWritesFollowTheDatabase(t *testing.T) {
+	ctx := context.Background()
+	conn := openScopeDatabase(t)
+	eu := scope(t, `{"field": "region", "operator": "eq", "value": "eu"}`)
+	seven := scope(t, `{"field": "code", "operator": "eq", "value": 7}`)
+
+	for _, test := range []struct {
+		name    string
+		scope   *FilterGroup
+		doc     Document
+		inScope bool
+		differs bool // Matches disagrees with the database
+	}{
+		{"same case", eu, Document{"id": 10, "region": "eu"}, true, false},
+		{"other case", eu, Document{"id": 11, "region": "EU"}, true, true},
+		{"other region", eu, Document{"id": 12, "region": "us"}, false, false},
+		{"generated key", eu, Document{"region": "Eu"}, true, true},
+		{"number as text", seven, Document{"id": 13, "code": "7"}, true, false},
+		{"padded number", seven, Document{"id": 14, "code": "07"}, false, true},
+	} {
+		if (test.scope.Matches(test.doc) != test.inScope) != test.differs {
+			t.Errorf("%s: Matches(%v) is %v", test.name, test.doc, test.scope.Matches(test.doc))
+		}
+
+		_, err := InsertScoped(ctx, conn, "orders", test.doc, test.scope)
+		if test.inScope && err != nil {
+			t.Errorf("%s: inserting %v failed: %v", test.name, test.doc, err)
+		}
+		if !test.inScope && !errors.Is(err, ErrOutOfScope) {
+			t.Errorf("%s: inserting %v returned %v, want ErrOutOfScope", test.name, test.doc, err)
+		}
+	}
+
+	count, err := conn.Count(ctx, "orders", FindOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 6 {
+		t.Fatalf("the table has %d records, want the 2 first ones and the 4 inserted in scope", count)
+	}
+
+	key := IDKey("1")
+	key.Scope = eu
+	if _, err := UpdateScoped(ctx, conn, "orders", key, Document{"region": "EU"}); err != nil {
+		t.Fatalf("changing the case of the region failed: %v", err)
+	}
+	if _, err := UpdateScoped(ctx, conn, "orders", key, Document{"region": "us"}); !errors.Is(err, ErrOutOfScope) {
+		t.Fatalf("moving the record out of the scope returned %v, want ErrOutOfScope", err)
+	}
+	// Moving the key keeps the record in scope
+	if _, err := UpdateScoped(ctx, conn, "orders", key, Document{"id": 20}); err != nil {
+		t.Fatalf("changing the key failed: %v", err)
+	}
+	doc, err := conn.Get(ctx, "orders", IDKey("20"))
+	if err != nil || doc["region"] != "EU" {
+		t.Fatalf("the record is %v (%v), want the region kept after the rolled back update", doc, err)
+	}
+
+	key = IDKey("2")
+	key.Scope = seven
+	if _, err := UpdateScoped(ctx, conn, "orders", key, Document{"code": "007"}); !errors.Is(err, ErrOutOfScope) {
+		t.Fatalf("padding the code returned %v, want ErrOutOfScope", err)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"db-manager-backend/models"
+)
+
+// SSL modes accepted on DatabaseConnection.SSLMode, following libpq semantics
+const (
+	SSLModeDisable    = "disable"
+	SSLModeRequire    = "require"
+	SSLModeVerifyCA   = "verify-ca"
+	SSLModeVerifyFull = "verify-full"
+)
+
+// sslMode returns the normalized SSL mode of a connection
+func sslMode(conn *models.DatabaseConnection) (string, error) {
+	switch conn.SSLMode {
+	case "", SSLModeDisable:
+		return SSLModeDisable, nil
+	case SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull:
+		return conn.SSLMode, nil
+	default:
+		return "", fmt.Errorf("unsupported ssl_mode: %s", conn.SSLMode)
+	}
+}
+
+// AuthMethodConnectionString selects the raw ConnectionString instead of host/port fields
+const AuthMethodConnectionString = "connection_string"
+
+// usesConnectionString reports whether the raw connection string replaces host/port fields
+func usesConnectionString(conn *models.DatabaseConnection) bool {
+	if conn.AuthMethod == "" {
+		return conn.ConnectionString != ""
+	}
+	return conn.AuthMethod == AuthMethodConnectionString
+}
+
+// buildTLSConfig translates the connection SSL settings into a TLS client configuration.
+// It returns nil when SSL is disabled. PEM material is taken inline from SSLCert,
+// SSLKey and SSLRootCert; without a root certificate the system pool is used.
+func buildTLSConfig(conn *models.DatabaseConnection) (*tls.Config, error) {
+	mode, err := sslMode(conn)
+	if err != nil || mode == SSLModeDisable {
+		return nil, err
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if conn.SSLCert != "" || conn.SSLKey != "" {
+		if conn.SSLCert == "" || conn.SSLKey == "" {
+			return nil, errors.New("ssl_cert and ssl_key must be provided together")
+		}
+		cert, err := tls.X509KeyPair([]byte(conn.SSLCert), []byte(conn.SSLKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	var roots *x509.CertPool
+	if conn.SSLRootCert != "" {
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(conn.SSLRootCert)) {
+			return nil, errors.New("invalid ssl_root_cert: no PEM certificates found")
+		}
+	}
+
+	// As in libpq, "require" with a root certificate behaves like "verify-ca"
+	if mode == SSLModeRequire && roots != nil {
+		mode = SSLModeVerifyCA
+	}
+
+	switch mode {
+	case SSLModeRequire:
+		// Encrypt only, the server certificate is not verified
+		cfg.InsecureSkipVerify = true
+	case SSLModeVerifyCA:
+		// Verify the chain but not the host name
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = verifyChain(roots)
+	case SSLModeVerifyFull:
+		cfg.RootCAs = roots
+	}
+
+	return cfg, nil
+}
+
+// verifyChain checks the server certificate chain against roots without hostname verification
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server presented no certificate")
+		}
+
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, cert)
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
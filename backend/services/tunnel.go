@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"db-manager-backend/models"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshKeepAliveInterval is how often idle tunnels probe the bastion host
+const sshKeepAliveInterval = 30 * time.Second
+
+// sshTunnel forwards a local loopback port to the database through an SSH client
+type sshTunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	target   string
+	done     chan struct{}
+	once     sync.Once
+
+	key  string
+	refs int // sessions using the tunnel, guarded by the tunnels lock
+}
+
+// tunnels shares one live tunnel per bastion/credentials/target combination between
+// the sessions using it. A tunnel is closed when its last session releases it.
+var tunnels = struct {
+	sync.Mutex
+	m       map[string]*sshTunnel
+	dialing map[string]chan struct{} // closed once the dial in progress for a key ends
+}{m: make(map[string]*sshTunnel), dialing: make(map[string]chan struct{})}
+
+// usesSSHTunnel reports whether the connection goes through a bastion host
+func usesSSHTunnel(conn *models.DatabaseConnection) bool {
+	return conn.SSHHost != ""
+}
+
+// withSSHTunnel returns a copy of the connection whose host and port point to a local
+// forward of the database address, and a function releasing the tunnel to call once
+// the session opened on it is closed. Connections without SSH settings are returned
+// as is. TLS host name verification (verify-full) is checked against the loopback
+// address, so verify-ca should be used for tunnelled connections.
+func withSSHTunnel(ctx context.Context, conn *models.DatabaseConnection) (*models.DatabaseConnection, func(), error) {
+	if !usesSSHTunnel(conn) {
+		return conn, func() {}, nil
+	}
+	if usesConnectionString(conn) {
+		return nil, nil, errors.New("SSH tunnels require host and port fields instead of a connection string")
+	}
+
+	tunnel, err := acquireSSHTunnel(ctx, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	local := tunnel.listener.Addr().(*net.TCPAddr)
+	tunnelled := *conn
+	tunnelled.Host = local.IP.String()
+	tunnelled.Port = local.Port
+
+	var once sync.Once
+	return &tunnelled, func() { once.Do(tunnel.release) }, nil
+}
+
+// sshTunnelKey identifies a tunnel without keeping the secrets themselves in memory
+func sshTunnelKey(conn *models.DatabaseConnection) string {
+	hash := sha256.New()
+	for _, part := range []string{
+		conn.SSHHost, strconv.Itoa(sshPort(conn)), conn.SSHUser, conn.SSHPassword,
+		conn.SSHPrivateKey, conn.SSHHostFingerprint, conn.Host, strconv.Itoa(conn.Port),
+	} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func sshPort(conn *models.DatabaseConnection) int {
+	if conn.SSHPort == 0 {
+		return 22
+	}
+	return conn.SSHPort
+}
+
+// acquireSSHTunnel takes a reference on the live tunnel of the connection, dialing it
+// first if needed. Only one dial runs per tunnel so concurrent sessions share it, and
+// dials of other tunnels do not wait for it.
+func acquireSSHTunnel(ctx context.Context, conn *models.DatabaseConnection) (*sshTunnel, error) {
+	key := sshTunnelKey(conn)
+
+	var dialing chan struct{}
+	for dialing == nil {
+		tunnels.Lock()
+		if tunnel, exists := tunnels.m[key]; exists && tunnel.alive() {
+			tunnel.refs++
+			tunnels.Unlock()
+			return tunnel, nil
+		}
+		pending, busy := tunnels.dialing[key]
+		if !busy {
+			dialing = make(chan struct{})
+			tunnels.dialing[key] = dialing
+		}
+		tunnels.Unlock()
+
+		if busy {
+			select {
+			case <-pending:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	tunnel, err := dialSSHTunnel(ctx, conn)
+
+	tunnels.Lock()
+	delete(tunnels.dialing, key)
+	close(dialing)
+	if err == nil {
+		tunnel.key = key
+		tunnel.refs = 1
+		tunnels.m[key] = tunnel
+	}
+	tunnels.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Forget the tunnel once the SSH connection drops
+	go func() {
+		<-tunnel.done
+		tunnels.Lock()
+		if tunnels.m[key] == tunnel {
+			delete(tunnels.m, key)
+		}
+		tunnels.Unlock()
+	}()
+
+	return tunnel, nil
+}
+
+// release drops one reference, closing the tunnel once no session uses it
+func (t *sshTunnel) release() {
+	tunnels.Lock()
+	t.refs--
+	last := t.refs == 0
+	if last && tunnels.m[t.key] == t {
+		delete(tunnels.m, t.key)
+	}
+	tunnels.Unlock()
+
+	if last {
+		t.close()
+	}
+}
+
+// sshClientConfig builds authentication and host key verification settings
+func sshClientConfig(conn *models.DatabaseConnection) (*ssh.ClientConfig, error) {
+	if conn.SSHUser == "" {
+		return nil, errors.New("SSH user is required")
+	}
+
+	var auth []ssh.AuthMethod
+	if conn.SSHPrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(conn.SSHPrivateKey))
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && conn.SSHPassword != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(conn.SSHPrivateKey), []byte(conn.SSHPassword))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	} else if conn.SSHPassword != "" {
+		auth = append(auth, ssh.Password(conn.SSHPassword))
+	} else {
+		return nil, errors.New("SSH password or private key is required")
+	}
+
+	return &ssh.ClientConfig{
+		User:            conn.SSHUser,
+		Auth:            auth,
+		HostKeyCallback: sshHostKeyCallback(conn.SSHHostFingerprint),
+		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// sshHostKeyCallback pins the bastion host key to the configured fingerprint.
+// Without a fingerprint the connection is refused, reporting the presented one
+// so it can be checked and saved.
+func sshHostKeyCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		presented := ssh.FingerprintSHA256(key)
+		if fingerprint == "" {
+			return fmt.Errorf("unknown SSH host key %s for %s, set ssh_host_fingerprint to trust it", presented, hostname)
+		}
+		if fingerprint != presented && fingerprint != ssh.FingerprintLegacyMD5(key) {
+			return fmt.Errorf("SSH host key mismatch for %s: got %s", hostname, presented)
+		}
+		return nil
+	}
+}
+
+// dialSSHTunnel connects to the bastion host and starts forwarding a loopback port
+func dialSSHTunnel(ctx context.Context, conn *models.DatabaseConnection) (*sshTunnel, error) {
+	config, err := sshClientConfig(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	address := net.JoinHostPort(conn.SSHHost, strconv.Itoa(sshPort(conn)))
+	var dialer net.Dialer
+	tcpConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach SSH host %s: %v", address, err)
+	}
+
+	// The handshake does not take a context, bound it with the context deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		tcpConn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(tcpConn, address, config)
+	if err != nil {
+		tcpConn.Close()
+		return nil, fmt.Errorf("SSH handshake with %s failed: %v", address, err)
+	}
+	tcpConn.SetDeadline(time.Time{})
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	tunnel := &sshTunnel{
+		client:   client,
+		listener: listener,
+		target:   net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port)),
+		done:     make(chan struct{}),
+	}
+	go tunnel.serve()
+	go tunnel.keepAlive()
+	go func() {
+		client.Wait()
+		tunnel.close()
+	}()
+
+	log.Printf("SSH tunnel %s -> %s via %s opened", listener.Addr(), tunnel.target, address)
+	return tunnel, nil
+}
+
+func (t *sshTunnel) alive() bool {
+	select {
+	case <-t.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (t *sshTunnel) close() {
+	t.once.Do(func() {
+		close(t.done)
+		t.listener.Close()
+		t.client.Close()
+		log.Printf("SSH tunnel %s -> %s closed", t.listener.Addr(), t.target)
+	})
+}
+
+// serve accepts local connections and forwards each through the SSH client
+func (t *sshTunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			t.close()
+			return
+		}
+		go t.forward(local)
+	}
+}
+
+func (t *sshTunnel) forward(local net.Conn) {
+	defer local.Close()
+
+	remote, err := t.client.Dial("tcp", t.target)
+	if err != nil {
+		log.Printf("SSH tunnel failed to reach %s: %v", t.target, err)
+		return
+	}
+	defer remote.Close()
+
+	copied := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		copied <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		copied <- struct{}{}
+	}()
+
+	// Either side closing ends the forwarded connection
+	<-copied
+}
+
+// keepAlive detects dead SSH connections so they are not reused, and keeps idle ones
+// open while sessions still use them
+func (t *sshTunnel) keepAlive() {
+	ticker := time.NewTicker(sshKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if _, _, err := t.client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				t.close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"db-manager-backend/models"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeSSH is an in-process bastion host accepting password logins and forwarding
+// direct-tcpip channels
+type fakeSSH struct {
+	listener    net.Listener
+	config      *ssh.ServerConfig
+	fingerprint string
+
+	handshakes atomic.Int32
+	mu         sync.Mutex
+	open       map[*ssh.ServerConn]bool
+}
+
+func newFakeSSH(t *testing.T, password string) *fakeSSH {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, given []byte) (*ssh.Permissions, error) {
+			if meta.User() == "tunnel" && string(given) == password {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSSH{
+		listener:    listener,
+		config:      config,
+		fingerprint: ssh.FingerprintSHA256(signer.PublicKey()),
+		open:        make(map[*ssh.ServerConn]bool),
+	}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (s *fakeSSH) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSSH) handle(conn net.Conn) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s.handshakes.Add(1)
+	s.mu.Lock()
+	s.open[serverConn] = true
+	s.mu.Unlock()
+
+	go func() {
+		for req := range reqs {
+			if req.WantReply {
+				req.Reply(req.Type == "keepalive@openssh.com", nil)
+			}
+		}
+	}()
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+			continue
+		}
+		go forwardDirectTCPIP(newChannel)
+	}
+
+	s.mu.Lock()
+	delete(s.open, serverConn)
+	s.mu.Unlock()
+}
+
+// forwardDirectTCPIP connects a direct-tcpip channel to the address it asks for
+func forwardDirectTCPIP(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		remote.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	go func() {
+		io.Copy(channel, remote)
+		channel.CloseWrite()
+	}()
+	io.Copy(remote, channel)
+	remote.Close()
+}
+
+// sessions returns the number of SSH connections the server still has open
+func (s *fakeSSH) sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.open)
+}
+
+func (s *fakeSSH) tunnel(conn *models.DatabaseConnection, password string) *models.DatabaseConnection {
+	address := s.listener.Addr().(*net.TCPAddr)
+	tunnelled := *conn
+	tunnelled.SSHHost = address.IP.String()
+	tunnelled.SSHPort = address.Port
+	tunnelled.SSHUser = "tunnel"
+	tunnelled.SSHPassword = password
+	tunnelled.SSHHostFingerprint = s.fingerprint
+	return &tunnelled
+}
+
+// newEchoServer returns the address of a TCP server echoing what it reads
+func newEchoServer(t *testing.T) *net.TCPAddr {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().(*net.TCPAddr)
+}
+
+func echoThrough(t *testing.T, conn *models.DatabaseConnection) {
+	t.Helper()
+	local, err := net.DialTimeout("tcp", net.JoinHostPort(conn.Host, strconv.Itoa(conn.Port)), time.Second)
+	if err != nil {
+		t.Fatalf("dial tunnel: %v", err)
+	}
+	defer local.Close()
+	local.SetDeadline(time.Now().Add(5 * time.Second))
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(time.Now().UnixNano()))
+	if _, err := local.Write(message); err != nil {
+		t.Fatal(err)
+	}
+	echoed := make([]byte, len(message))
+	if _, err := io.ReadFull(local, echoed); err != nil {
+		t.Fatalf("read through tunnel: %v", err)
+	}
+	if string(echoed) != string(message) {
+		t.Fatalf("tunnel echoed %x, want %x", echoed, message)
+	}
+}
+
+// waitFor polls a condition that background goroutines make true
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func tunnelCount() int {
+	tunnels.Lock()
+	defer tunnels.Unlock()
+	return len(tunnels.m)
+}
+
+func TestSSHTunnelForwardsAndClosesWithItsLastSession(t *testing.T) {
+	server := newFakeSSH(t, "secret")
+	echo := newEchoServer(t)
+	conn := server.tunnel(&models.DatabaseConnection{Host: echo.IP.String(), Port: echo.Port}, "secret")
+
+	first, releaseFirst, err := withSSHTunnel(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, releaseSecond, err := withSSHTunnel(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Port != second.Port || server.handshakes.Load() != 1 {
+		t.Fatalf("sessions of the same connection should share one tunnel, got ports %d and %d after %d handshakes",
+			first.Port, second.Port, server.handshakes.Load())
+	}
+	echoThrough(t, first)
+
+	// Releasing twice must not drop the reference of the other session
+	releaseFirst()
+	releaseFirst()
+	echoThrough(t, second)
+
+	releaseSecond()
+	waitFor(t, "the SSH connection to close", func() bool { return server.sessions() == 0 })
+	if tunnelCount() != 0 {
+		t.Fatal("a released tunnel is still registered")
+	}
+	if local, err := net.DialTimeout("tcp", net.JoinHostPort(second.Host, strconv.Itoa(second.Port)), time.Second); err == nil {
+		local.Close()
+		t.Fatal("the local forward still accepts connections")
+	}
+}
+
+func TestSSHTunnelDialsOncePerKey(t *testing.T) {
+	server := newFakeSSH(t, "secret")
+	echo := newEchoServer(t)
+	conn := server.tunnel(&models.DatabaseConnection{Host: echo.IP.String(), Port: echo.Port}, "secret")
+
+	var wg sync.WaitGroup
+	releases := make(chan func(), 8)
+	for i := 0; i < cap(releases); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, release, err := withSSHTunnel(context.Background(), conn)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			releases <- release
+		}()
+	}
+	wg.Wait()
+	close(releases)
+
+	if got := server.handshakes.Load(); got != 1 {
+		t.Fatalf("concurrent sessions dialed %d tunnels", got)
+	}
+	for release := range releases {
+		release()
+	}
+	waitFor(t, "the SSH connection to close", func() bool { return server.sessions() == 0 })
+}
+
+func TestSSHTunnelRejectsUnknownHostKeys(t *testing.T) {
+	server := newFakeSSH(t, "secret")
+	echo := newEchoServer(t)
+	conn := server.tunnel(&models.DatabaseConnection{Host: echo.IP.String(), Port: echo.Port}, "secret")
+
+	conn.SSHHostFingerprint = "SHA256:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	if _, _, err := withSSHTunnel(context.Background(), conn); err == nil {
+		t.Fatal("a mismatching host key was accepted")
+	}
+	conn.SSHHostFingerprint = ""
+	if _, _, err := withSSHTunnel(context.Background(), conn); err == nil {
+		t.Fatal("a host key was trusted without a fingerprint")
+	}
+	conn.SSHHostFingerprint = server.fingerprint
+	conn.SSHPassword = "wrong"
+	if _, _, err := withSSHTunnel(context.Background(), conn); err == nil {
+		t.Fatal("a wrong SSH password was accepted")
+	}
+	if tunnelCount() != 0 {
+		t.Fatal("a failed dial left a tunnel registered")
+	}
+}
+
+func TestSessionsCloseTheirTunnels(t *testing.T) {
+	server := newFakeSSH(t, "secret")
+	redis := newFakeRedis(t, "")
+	conn := server.tunnel(redis.connection(""), "secret")
+
+	session, release, err := NewDatabaseService().Open(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Ping(context.Background()); err != nil {
+		t.Fatalf("ping through the tunnel: %v", err)
+	}
+	if server.sessions() != 1 {
+		t.Fatalf("%d SSH connections open, want 1", server.sessions())
+	}
+
+	release()
+	waitFor(t, "the SSH connection to close", func() bool { return server.sessions() == 0 })
+	if tunnelCount() != 0 {
+		t.Fatal("the tunnel is still registered")
+	}
+}
+
+func TestPoolClosesTunnelsWithTheirSessions(t *testing.T) {
+	server := newFakeSSH(t, "secret")
+	redis := newFakeRedis(t, "")
+	conn := server.tunnel(redis.connection(""), "secret")
+	conn.ID = uuid.New()
+
+	manager := NewConnectionManager(NewDatabaseService(), 10, time.Hour)
+	defer manager.Close()
+
+	session, release, err := manager.Acquire(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Ping(context.Background()); err != nil {
+		t.Fatalf("ping through the tunnel: %v", err)
+	}
+
+	// The session is still in use, so invalidating it must keep its tunnel open
+	manager.Invalidate(conn.ID.String())
+	if err := session.Ping(context.Background()); err != nil {
+		t.Fatalf("ping after invalidating: %v", err)
+	}
+	if server.sessions() != 1 {
+		t.Fatalf("%d SSH connections open, want 1", server.sessions())
+	}
+
+	release()
+	waitFor(t, "the SSH connection to close", func() bool { return server.sessions() == 0 })
+
+	// Testing a connection does not keep its tunnel either
+	if err := manager.Check(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the SSH connection to close", func() bool { return server.sessions() == 0 })
+	if server.handshakes.Load() != 2 {
+		t.Fatalf("%d handshakes, want 2", server.handshakes.Load())
+	}
+}
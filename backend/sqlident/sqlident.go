@@ -0,0 +1,118 @@
+// Package sqlident quotes and validates SQL identifiers such as table and column
+// names. Identifiers are always quoted, so names coming from URLs or JSON keys can
+// never be read as SQL, and checked against the catalog of the database before use.
+package sqlident
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalid is returned for names that cannot be used as an identifier
+var ErrInvalid = errors.New("invalid identifier")
+
+// Dialect describes how an SQL engine quotes identifiers and which names it accepts
+type Dialect struct {
+	name            string
+	quote           string
+	maxLength       int  // 0 for no limit
+	maxBytes        bool // maxLength counts bytes instead of characters
+	bmpOnly         bool // characters outside the Basic Multilingual Plane are rejected
+	noTrailingSpace bool
+}
+
+var (
+	// MySQL quotes with backticks. Names are at most 64 characters, cannot end with a
+	// space and cannot contain supplementary characters.
+	MySQL = Dialect{name: "mysql", quote: "`", maxLength: 64, bmpOnly: true, noTrailingSpace: true}
+	// Postgres quotes with double quotes. Longer names than 63 bytes would be truncated
+	// by the server, so they are rejected.
+	Postgres = Dialect{name: "postgres", quote: `"`, maxLength: 63, maxBytes: true}
+	// SQLite quotes with double quotes and has no length limit
+	SQLite = Dialect{name: "sqlite", quote: `"`}
+)
+
+// ForDriver returns the dialect of a database type
+func ForDriver(databaseType string) (Dialect, bool) {
+	switch strings.ToLower(databaseType) {
+	case "mysql", "mariadb":
+		return MySQL, true
+	case "postgres", "postgresql", "cockroachdb":
+		return Postgres, true
+	case "sqlite", "sqlite3":
+		return SQLite, true
+	}
+	return Dialect{}, false
+}
+
+// String returns the name of the dialect
+func (d Dialect) String() string {
+	return d.name
+}
+
+// Validate checks that name can be used as an identifier of the dialect
+func (d Dialect) Validate(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name is empty", ErrInvalid)
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("%w: %q is not valid UTF-8", ErrInvalid, name)
+	}
+	if strings.ContainsRune(name, 0) {
+		return fmt.Errorf("%w: %q contains a NUL character", ErrInvalid, name)
+	}
+
+	length := utf8.RuneCountInString(name)
+	if d.maxBytes {
+		length = len(name)
+	}
+	if d.maxLength > 0 && length > d.maxLength {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalid, name, d.maxLength)
+	}
+	if d.noTrailingSpace && strings.HasSuffix(name, " ") {
+		return fmt.Errorf("%w: %q ends with a space", ErrInvalid, name)
+	}
+	if d.bmpOnly {
+		for _, r := range name {
+			if r > 0xFFFF {
+				return fmt.Errorf("%w: %q contains characters %s does not support", ErrInvalid, name, d.name)
+			}
+		}
+	}
+	return nil
+}
+
+// Quote returns name as a quoted identifier, doubling quote characters inside it.
+// The result is a single identifier whatever the name contains; call Validate
+// first to reject names the server would refuse.
+func (d Dialect) Quote(name string) string {
+	return d.quote + strings.ReplaceAll(name, d.quote, d.quote+d.quote) + d.quote
+}
+
+// QuoteList quotes every name and joins them with commas
+func (d Dialect) QuoteList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = d.Quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Resolve returns the spelling of name in catalog: the exact match, or otherwise the
+// only entry equal to it ignoring case. Ambiguous and unknown names are not resolved.
+func Resolve(name string, catalog []string) (string, bool) {
+	match := ""
+	matches := 0
+	for _, entry := range catalog {
+		if entry == name {
+			return entry, true
+		}
+		if strings.EqualFold(entry, name) {
+			match = entry
+			matches++
+		}
+	}
+	return match, matches == 1
+}
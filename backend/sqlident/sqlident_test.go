@@ -0,0 +1,192 @@
+package sqlident
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite"
+)
+
+var dialects = []Dialect{MySQL, Postgres, SQLite}
+
+// Names that would break out of naive quoting
+var hostileNames = []string{
+	"users",
+	`"`,
+	"`",
+	`""`,
+	"``",
+	`a"b`,
+	"a`b",
+	`users"; DROP TABLE users; --`,
+	"users`; DROP TABLE users; -- ",
+	`x" UNION SELECT password FROM users --`,
+	`\`,
+	`\"`,
+	"\\`",
+	"'",
+	"/*",
+	"--",
+	"a\nb",
+	"a\rb\t",
+	" leading",
+	"ünïcödé",
+	"表",
+	"😀",
+	strings.Repeat(`"`, 70),
+}
+
+// unquote reads one quoted identifier from the start of sql, the way an SQL lexer
+// does: a quote character ends it unless it is doubled. It returns the name and
+// the rest of the input after the closing quote.
+func unquote(quote byte, sql string) (name, rest string, ok bool) {
+	if len(sql) == 0 || sql[0] != quote {
+		return "", "", false
+	}
+	var b strings.Builder
+	for i := 1; i < len(sql); i++ {
+		if sql[i] != quote {
+			b.WriteByte(sql[i])
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote {
+			b.WriteByte(quote)
+			i++
+			continue
+		}
+		return b.String(), sql[i+1:], true
+	}
+	return "", "", false
+}
+
+func FuzzQuote(f *testing.F) {
+	for _, name := range hostileNames {
+		f.Add(name)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		for _, d := range dialects {
+			quoted := d.Quote(name)
+			got, rest, ok := unquote(d.quote[0], quoted)
+			if !ok {
+				t.Fatalf("%s: %q is not a closed identifier", d, quoted)
+			}
+			// Anything after the closing quote would be read as SQL
+			if rest != "" {
+				t.Fatalf("%s: %q leaves %q outside of the identifier", d, quoted, rest)
+			}
+			if got != name {
+				t.Fatalf("%s: %q reads back as %q, want %q", d, quoted, got, name)
+			}
+		}
+	})
+}
+
+func FuzzQuoteList(f *testing.F) {
+	for _, name := range hostileNames {
+		f.Add(name, "id")
+	}
+	f.Fuzz(func(t *testing.T, first, second string) {
+		for _, d := range dialects {
+			list := d.QuoteList([]string{first, second})
+
+			name, rest, ok := unquote(d.quote[0], list)
+			if !ok || name != first {
+				t.Fatalf("%s: %q does not start with %q", d, list, first)
+			}
+			rest, found := strings.CutPrefix(rest, ", ")
+			if !found {
+				t.Fatalf("%s: %q does not separate the names with a comma", d, list)
+			}
+			name, rest, ok = unquote(d.quote[0], rest)
+			if !ok || name != second || rest != "" {
+				t.Fatalf("%s: %q does not end with %q", d, list, second)
+			}
+		}
+	})
+}
+
+// FuzzSQLiteQuote runs quoted names through the SQLite parser, so that the check does
+// not rely on the test's understanding of the quoting rules
+func FuzzSQLiteQuote(f *testing.F) {
+	for _, name := range hostileNames {
+		f.Add(name)
+	}
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	f.Fuzz(func(t *testing.T, name string) {
+		if SQLite.Validate(name) != nil {
+			return
+		}
+		// A name escaping its quotes would change the statement: add a column, hide
+		// the sentinel in a comment or fail to parse
+		rows, err := db.Query("SELECT 1 AS " + SQLite.Quote(name) + `, 2 AS "sentinel"`)
+		if err != nil {
+			t.Fatalf("%q: %v", name, err)
+		}
+		defer rows.Close()
+		columns, err := rows.Columns()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(columns) != 2 || columns[0] != name || columns[1] != "sentinel" {
+			t.Fatalf("%q: got columns %q", name, columns)
+		}
+	})
+}
+
+func FuzzValidate(f *testing.F) {
+	for _, name := range hostileNames {
+		f.Add(name)
+	}
+	f.Add("")
+	f.Add("a\x00b")
+	f.Add("\xff")
+	f.Add("trailing ")
+	f.Fuzz(func(t *testing.T, name string) {
+		for _, d := range dialects {
+			if d.Validate(name) != nil {
+				continue
+			}
+			if name == "" || !utf8.ValidString(name) || strings.ContainsRune(name, 0) {
+				t.Fatalf("%s accepted %q", d, name)
+			}
+			if d.noTrailingSpace && strings.HasSuffix(name, " ") {
+				t.Fatalf("%s accepted %q with a trailing space", d, name)
+			}
+		}
+	})
+}
+
+func FuzzResolve(f *testing.F) {
+	f.Add("users", "Users", "orders")
+	f.Add("USERS", "users", "Users")
+	f.Add("x", "y", "z")
+	f.Fuzz(func(t *testing.T, name, first, second string) {
+		catalog := []string{first, second}
+		resolved, ok := Resolve(name, catalog)
+		if !ok {
+			if name == first || name == second {
+				t.Fatalf("%q was not resolved in %q", name, catalog)
+			}
+			return
+		}
+		if resolved != first && resolved != second {
+			t.Fatalf("%q resolved to %q, which is not in %q", name, resolved, catalog)
+		}
+		if !strings.EqualFold(resolved, name) {
+			t.Fatalf("%q resolved to %q", name, resolved)
+		}
+		// Exact matches win over case-insensitive ones
+		if (name == first || name == second) && resolved != name {
+			t.Fatalf("%q resolved to %q despite an exact match", name, resolved)
+		}
+	})
+}
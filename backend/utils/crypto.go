@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// masterKeySize is the AES-256 key length expected for master and data keys
+const masterKeySize = 32
+
+// Keyring holds the versioned master keys used to wrap per-record data keys
+type Keyring struct {
+	current int
+	keys    map[int][]byte
+}
+
+var (
+	credentialKeyring   = &Keyring{keys: map[int][]byte{}}
+	credentialKeyringMu sync.RWMutex
+)
+
+// SetCredentialKeyring installs the keyring used by the model encryption hooks
+func SetCredentialKeyring(keyring *Keyring) {
+	credentialKeyringMu.Lock()
+	defer credentialKeyringMu.Unlock()
+	credentialKeyring = keyring
+}
+
+// CredentialKeyring returns the keyring used by the model encryption hooks
+func CredentialKeyring() *Keyring {
+	credentialKeyringMu.RLock()
+	defer credentialKeyringMu.RUnlock()
+	return credentialKeyring
+}
+
+// ParseKeyring parses master keys given as comma or newline separated
+// "version:base64key" entries. A bare base64 key is version 1. The highest
+// version becomes the current key, older ones are kept for decryption.
+func ParseKeyring(spec string) (*Keyring, error) {
+	keyring := &Keyring{keys: map[int][]byte{}}
+
+	entries := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		version := 1
+		encoded := entry
+		if idx := strings.Index(entry, ":"); idx >= 0 {
+			v, err := strconv.Atoi(entry[:idx])
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("invalid master key version %q", entry[:idx])
+			}
+			version = v
+			encoded = entry[idx+1:]
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("master key version %d is not valid base64: %v", version, err)
+		}
+		if len(key) != masterKeySize {
+			return nil, fmt.Errorf("master key version %d must be %d bytes, got %d", version, masterKeySize, len(key))
+		}
+		if _, exists := keyring.keys[version]; exists {
+			return nil, fmt.Errorf("duplicate master key version %d", version)
+		}
+
+		keyring.keys[version] = key
+		if version > keyring.current {
+			keyring.current = version
+		}
+	}
+
+	return keyring, nil
+}
+
+// Enabled reports whether a master key is configured
+func (k *Keyring) Enabled() bool {
+	return k.current > 0
+}
+
+// CurrentVersion returns the version of the master key used for new data keys
+func (k *Keyring) CurrentVersion() int {
+	return k.current
+}
+
+// NewDataKey generates a data key and returns it together with its wrapped form.
+// additionalData binds the wrapped key to its owner and must be given again to unwrap it.
+func (k *Keyring) NewDataKey(additionalData []byte) ([]byte, string, error) {
+	if !k.Enabled() {
+		return nil, "", errors.New("no master key configured")
+	}
+
+	dataKey := make([]byte, masterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, "", err
+	}
+
+	wrapped, err := Seal(k.keys[k.current], dataKey, additionalData)
+	if err != nil {
+		return nil, "", err
+	}
+	return dataKey, wrapped, nil
+}
+
+// UnwrapDataKey decrypts a data key wrapped by the given master key version
+func (k *Keyring) UnwrapDataKey(version int, wrapped string, additionalData []byte) ([]byte, error) {
+	masterKey, ok := k.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("master key version %d is not configured", version)
+	}
+
+	dataKey, err := Unseal(masterKey, wrapped, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %v", err)
+	}
+	return dataKey, nil
+}
+
+// Seal encrypts plaintext with AES-GCM under a fresh random nonce and returns
+// base64(nonce || ciphertext). additionalData is authenticated but not encrypted.
+func Seal(key, plaintext, additionalData []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, additionalData)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Unseal reverses Seal
+func Unseal(key []byte, encoded string, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
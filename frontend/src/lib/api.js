@@ -63,6 +63,21 @@ class ApiClient {
         return response.data;
     }
 
+    async updateConnection(id, connectionData) {
+        const response = await this.client.put(`/database/${id}`, connectionData);
+        return response.data;
+    }
+
+    async getConnectionHistory(id) {
+        const response = await this.client.get(`/database/${id}/history`);
+        return response.data;
+    }
+
+    async getConnectionHealth(id, limit = 100) {
+        const response = await this.client.get(`/database/${id}/health`, { params: { limit } });
+        return response.data;
+    }
+
     async getConnections() {
         const response = await this.client.get('/database');
         return response.data;
@@ -78,6 +93,107 @@ class ApiClient {
         return response.data;
     }
 
+    // Key-value browsing methods (Redis)
+    async getKeys(databaseId, pattern = '*', cursor = '', count = 100) {
+        const params = new URLSearchParams({ database_id: databaseId, pattern, cursor, count });
+        const response = await this.client.get(`/database-management/keys?${params}`);
+        return response.data;
+    }
+
+    async getKey(databaseId, key) {
+        const response = await this.client.get(
+            `/database-management/keys/${encodeURIComponent(key)}?database_id=${databaseId}`
+        );
+        return response.data;
+    }
+
+    async runQuery(databaseId, query, options = {}) {
+        const response = await this.client.post('/database-management/query', {
+            database_id: databaseId,
+            query,
+            ...options
+        });
+        return response.data;
+    }
+
+    async findNative(databaseId, collection, query = {}) {
+        const response = await this.client.post(
+            `/database-management/collections/${encodeURIComponent(collection)}/find`,
+            { database_id: databaseId, ...query }
+        );
+        return response.data;
+    }
+
+    async aggregateNative(databaseId, collection, pipeline, options = {}) {
+        const response = await this.client.post(
+            `/database-management/collections/${encodeURIComponent(collection)}/aggregate`,
+            { database_id: databaseId, pipeline, ...options }
+        );
+        return response.data;
+    }
+
+    async explainQuery(databaseId, query, analyze = false) {
+        const response = await this.client.post('/database-management/explain', {
+            database_id: databaseId,
+            query,
+            analyze
+        });
+        return response.data;
+    }
+
+    async explainDocuments(databaseId, collection, params = {}) {
+        const response = await this.client.get(
+            `/database-management/collections/${encodeURIComponent(collection)}/documents/explain`,
+            { params: { database_id: databaseId, ...params } }
+        );
+        return response.data;
+    }
+
+    async cancelQuery(queryId) {
+        const response = await this.client.delete(`/database-management/query/${encodeURIComponent(queryId)}`);
+        return response.data;
+    }
+
+    async getSavedQueries(databaseId = '') {
+        const response = await this.client.get('/database-management/saved-queries', {
+            params: databaseId ? { database_id: databaseId } : {}
+        });
+        return response.data;
+    }
+
+    async getSavedQuery(id) {
+        const response = await this.client.get(`/database-management/saved-queries/${id}`);
+        return response.data;
+    }
+
+    async createSavedQuery(data) {
+        const response = await this.client.post('/database-management/saved-queries', data);
+        return response.data;
+    }
+
+    async updateSavedQuery(id, data) {
+        const response = await this.client.put(`/database-management/saved-queries/${id}`, data);
+        return response.data;
+    }
+
+    async deleteSavedQuery(id) {
+        const response = await this.client.delete(`/database-management/saved-queries/${id}`);
+        return response.data;
+    }
+
+    async getQueryHistory(databaseId = '', limit = 100) {
+        const params = databaseId ? { database_id: databaseId, limit } : { limit };
+        const response = await this.client.get('/database-management/query-history', { params });
+        return response.data;
+    }
+
+    async clearQueryHistory(databaseId = '') {
+        const response = await this.client.delete('/database-management/query-history', {
+            params: databaseId ? { database_id: databaseId } : {}
+        });
+        return response.data;
+    }
+
     // API management methods
     async createAPIKey(data) {
         const response = await this.client.post('/api-management/keys', data);
@@ -94,6 +210,13 @@ class ApiClient {
         return response.data;
     }
 
+    async updateAPIKeyRowFilters(id, rowFilters = {}) {
+        const response = await this.client.put(`/api-management/keys/${id}/row-filters`, {
+            row_filters: rowFilters
+        });
+        return response.data;
+    }
+
     async deleteAPIKey(id) {
         const response = await this.client.delete(`/api-management/keys/${id}`);
         return response.data;
@@ -165,6 +288,15 @@ class ApiClient {
         return response.data;
     }
 
+    async updateAccess(databaseId, userId, changes) {
+        const response = await this.client.patch('/sharing/access', {
+            database_id: databaseId,
+            user_id: userId,
+            ...changes
+        });
+        return response.data;
+    }
+
     async revokeAccess(databaseId, userId) {
         const response = await this.client.delete('/sharing/access', {
             data: { database_id: databaseId, user_id: userId }
@@ -172,6 +304,24 @@ class ApiClient {
         return response.data;
     }
 
+    async updateAccessGrants(databaseId, userId, grants = []) {
+        const response = await this.client.put('/sharing/access/grants', {
+            database_id: databaseId,
+            user_id: userId,
+            grants
+        });
+        return response.data;
+    }
+
+    async updateAccessRowFilters(databaseId, userId, rowFilters = {}) {
+        const response = await this.client.put('/sharing/access/row-filters', {
+            database_id: databaseId,
+            user_id: userId,
+            row_filters: rowFilters
+        });
+        return response.data;
+    }
+
     async revokeInvitation(invitationId) {
         const response = await this.client.delete(`/sharing/invitations/${invitationId}`);
         return response.data;
@@ -183,6 +333,34 @@ class ApiClient {
         });
         return response.data;
     }
+
+    async transferOwnership(databaseId, userId) {
+        const response = await this.client.post('/sharing/transfers', {
+            database_id: databaseId,
+            user_id: userId
+        });
+        return response.data;
+    }
+
+    async getTransfers() {
+        const response = await this.client.get('/sharing/transfers');
+        return response.data;
+    }
+
+    async acceptTransfer(id) {
+        const response = await this.client.post(`/sharing/transfers/${id}/accept`);
+        return response.data;
+    }
+
+    async declineTransfer(id) {
+        const response = await this.client.post(`/sharing/transfers/${id}/decline`);
+        return response.data;
+    }
+
+    async cancelTransfer(id) {
+        const response = await this.client.delete(`/sharing/transfers/${id}`);
+        return response.data;
+    }
 }
 
 export const apiClient = new ApiClient();